@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"modernc.org/sqlite"
+)
+
+const backupUsage = `usage: string_analyzer backup [-db path] <file>
+
+Writes a consistent copy of the database to file, which must not exist.
+The server may keep running.
+`
+
+const restoreUsage = `usage: string_analyzer restore [-db path] [-force] <file>
+
+Replaces the database with the backup in file after checking its schema.
+Stop the server first. -force overwrites an existing database.
+`
+
+// openExisting opens the SQLite database at path without creating it.
+func openExisting(path string, readOnly bool) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	q := url.Values{"mode": {"rw"}, "_pragma": {"busy_timeout(5000)"}}
+	if readOnly {
+		q.Set("mode", "ro")
+		q.Add("_pragma", "query_only(1)")
+	}
+	db, err := sql.Open("sqlite", fileURI(path, q))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// checkSchema returns the schema version of a database written by this
+// program, or an error if its migration history does not match ours or is
+// newer than this binary.
+func checkSchema(ctx context.Context, db *sql.DB) (int, error) {
+	if ok, err := hasMigrationsTable(ctx, db); err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, errors.New("no schema_migrations table; run migrate up on a database from before migrations")
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version, name FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	version := 0
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&version, &name); err != nil {
+			return 0, err
+		}
+		if version > latestVersion() {
+			return 0, fmt.Errorf("schema version %d is newer than this binary's %d", version, latestVersion())
+		}
+		if version < 1 || migrations[version-1].Name != name {
+			return 0, fmt.Errorf("unknown migration %d %q", version, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, errors.New("no migrations applied")
+	}
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA quick_check`).Scan(&result); err != nil {
+		return 0, err
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", result)
+	}
+	return version, nil
+}
+
+// runBackup implements the backup subcommand and returns the exit code.
+// VACUUM INTO copies a single read transaction, so writers carry on and the
+// copy is compacted. The copy is checked when it is restored, not here.
+func runBackup(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, backupUsage) }
+	dbPath := fs.String("db", defaultDBPath, "SQLite database file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	dest := fs.Arg(0)
+	if _, err := os.Stat(dest); err == nil {
+		fmt.Fprintf(stderr, "backup: %s already exists\n", dest)
+		return 1
+	}
+
+	// query_only would also forbid writing the copy
+	db, err := openExisting(*dbPath, false)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "backed up %s to %s\n", *dbPath, dest)
+	return 0
+}
+
+// runRestore implements the restore subcommand and returns the exit code.
+// The backup is copied page by page with SQLite's online backup API, which
+// replaces the target in one transaction.
+func runRestore(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, restoreUsage) }
+	dbPath := fs.String("db", defaultDBPath, "SQLite database file")
+	force := fs.Bool("force", false, "overwrite an existing database")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	src := fs.Arg(0)
+	ctx := context.Background()
+
+	backup, err := openExisting(src, true)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	version, err := checkSchema(ctx, backup)
+	backup.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "restore: %s: %v\n", src, err)
+		return 1
+	}
+
+	if _, err := os.Stat(*dbPath); err == nil && !*force {
+		fmt.Fprintf(stderr, "restore: %s already exists; use -force to overwrite it\n", *dbPath)
+		return 1
+	}
+	db, err := sql.Open("sqlite", fileURI(*dbPath, url.Values{"_pragma": {"busy_timeout(5000)"}}))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+	if err := restoreFrom(ctx, db, src); err != nil {
+		fmt.Fprintf(stderr, "restore: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "restored %s from %s (schema version %d)\n", *dbPath, src, version)
+	if version < latestVersion() {
+		fmt.Fprintf(stdout, "the server migrates it to version %d when it starts\n", latestVersion())
+	}
+	return 0
+}
+
+// restoreFrom overwrites the database behind db with the one at src.
+func restoreFrom(ctx context.Context, db *sql.DB, src string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		rc, ok := driverConn.(interface {
+			NewRestore(string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("the SQLite driver does not support the backup API")
+		}
+		b, err := rc.NewRestore(src)
+		if err != nil {
+			return err
+		}
+		if _, err := b.Step(-1); err != nil {
+			b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand runs a subcommand and returns its exit code and combined output.
+func runCommand(run func([]string, io.Writer, io.Writer) int, args ...string) (int, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "live.db")
+	backup := filepath.Join(dir, "backup.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { store.Close() }()
+	if err := store.Create(ctx, newResource("racecar")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The store stays open, as it would in a running server
+	if code, out := runCommand(runBackup, "-db", path, backup); code != 0 || !strings.Contains(out, "backed up") {
+		t.Fatalf("backup (%d): %s", code, out)
+	}
+	if code, out := runCommand(runBackup, "-db", path, backup); code != 1 || !strings.Contains(out, "already exists") {
+		t.Errorf("Expected backup to refuse an existing file (%d): %s", code, out)
+	}
+	if err := store.Create(ctx, newResource("after backup")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	if code, out := runCommand(runRestore, "-db", path, backup); code != 1 || !strings.Contains(out, "-force") {
+		t.Errorf("Expected restore to refuse overwriting without -force (%d): %s", code, out)
+	}
+	if code, out := runCommand(runRestore, "-db", path, "-force", backup); code != 0 {
+		t.Fatalf("restore (%d): %s", code, out)
+	}
+	if store, err = NewSQLiteStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.Exists(ctx, "racecar"); !ok {
+		t.Error("Expected the backed-up string to be restored")
+	}
+	if ok, _ := store.Exists(ctx, "after backup"); ok {
+		t.Error("Expected the string created after the backup to be gone")
+	}
+
+	fresh := filepath.Join(dir, "fresh.db")
+	if code, out := runCommand(runRestore, "-db", fresh, backup); code != 0 {
+		t.Errorf("restore to a new file (%d): %s", code, out)
+	}
+}
+
+func TestRestoreValidatesSchema(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.db")
+
+	junk := filepath.Join(dir, "junk.db")
+	if err := os.WriteFile(junk, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty, emptyPath := openTestDB(t)
+	if _, err := empty.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	newer, newerPath := openTestDB(t)
+	if _, err := migrateUp(context.Background(), newer, latestVersion(), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newer.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from_the_future', '')`, latestVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	for src, want := range map[string]string{
+		junk:                             "not a database",
+		emptyPath:                        "no schema_migrations table",
+		newerPath:                        "newer than this binary",
+		filepath.Join(dir, "missing.db"): "no such file",
+	} {
+		if code, out := runCommand(runRestore, "-db", target, src); code != 1 || !strings.Contains(out, want) {
+			t.Errorf("restore %s: expected %q (%d): %s", filepath.Base(src), want, code, out)
+		}
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("Expected a rejected restore to leave no database behind")
+	}
+	for _, args := range [][]string{{}, {"a", "b"}} {
+		if code, _ := runCommand(runRestore, args...); code != 2 {
+			t.Errorf("restore %v: expected usage error exit code 2, got %d", args, code)
+		}
+		if code, _ := runCommand(runBackup, args...); code != 2 {
+			t.Errorf("backup %v: expected usage error exit code 2, got %d", args, code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, v := range []string{"racecar", "hello world", "level"} {
+		if err := store.Create(ctx, newResource(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code, out := runCommand(runVerify, "-db", path); code != 0 || !strings.Contains(out, "checked 3 strings: 0 corrupt, 0 drifted") {
+		t.Fatalf("verify of a clean database (%d): %s", code, out)
+	}
+
+	if _, err := store.db.Exec(`UPDATE strings SET sha256_hash = 'bad' WHERE value = 'racecar'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.db.Exec(`UPDATE strings SET char_freq_map = '{"l":2}', word_count = 5 WHERE value = 'level'`); err != nil {
+		t.Fatal(err)
+	}
+	code, out := runCommand(runVerify, "-db", path)
+	if code != 1 || !strings.Contains(out, "checked 3 strings: 1 corrupt, 1 drifted") {
+		t.Fatalf("verify of a damaged database (%d): %s", code, out)
+	}
+	for _, want := range []string{
+		`corrupt default`, `"racecar": sha256_hash does not match`,
+		`drift   default`, `"level": word_count, char_freq_map differ`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in verify output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "hello world") {
+		t.Errorf("Expected the intact row not to be reported:\n%s", out)
+	}
+
+	if code, _ := runCommand(runVerify, "-db", filepath.Join(t.TempDir(), "missing.db")); code != 1 {
+		t.Errorf("Expected verify of a missing database to fail, got %d", code)
+	}
+}
+
+func TestCommandsEscapePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "live.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(context.Background(), newResource("racecar")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Unescaped, "?" and "#" would start the URI's query and fragment
+	odd := filepath.Join(dir, "copy?mode=memory#1.db")
+	if code, out := runCommand(runBackup, "-db", path, odd); code != 0 {
+		t.Fatalf("backup (%d): %s", code, out)
+	}
+	if code, out := runCommand(runVerify, "-db", odd); code != 0 || !strings.Contains(out, "checked 1 strings") {
+		t.Errorf("verify of %s (%d): %s", filepath.Base(odd), code, out)
+	}
+	if code, out := runCommand(runRestore, "-db", filepath.Join(dir, "restored?.db"), odd); code != 0 {
+		t.Errorf("restore from %s (%d): %s", filepath.Base(odd), code, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "restored?.db")); err != nil {
+		t.Errorf("Expected the restore to write the named file: %v", err)
+	}
+}
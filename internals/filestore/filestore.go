@@ -0,0 +1,626 @@
+// Package filestore is a handlers.StringStore kept in a single append-only
+// JSON-lines file. Every write appends one line, a deletion appends a
+// tombstone, and the file can be read and diffed by hand. On startup the log
+// is replayed into an in-memory index (an unpersisted memstore.Store), which
+// serves all reads. Compaction rewrites the file with one line per live
+// resource.
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+)
+
+// SyncPolicy controls when appended lines are fsynced.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs before every write returns.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs in the background every Options.SyncInterval;
+	// a crash can lose writes from the last interval.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the OS.
+	SyncNever SyncPolicy = "never"
+)
+
+// Defaults used by Open for zero Options fields.
+const (
+	DefaultSyncInterval    = time.Second
+	DefaultCompactInterval = 10 * time.Minute
+	// DefaultCompactRatio compacts once dead lines outnumber live ones.
+	DefaultCompactRatio = 1.0
+)
+
+// Options configure Open. Only Path is required.
+type Options struct {
+	Path         string
+	Sync         SyncPolicy // default SyncInterval
+	SyncInterval time.Duration
+	// CompactInterval is how often the log is checked for compaction;
+	// negative disables background compaction.
+	CompactInterval time.Duration
+	// CompactRatio is the number of dead lines per live resource above which
+	// a check compacts the log.
+	CompactRatio float64
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Path == "" {
+		return o, errors.New("filestore: Options.Path is required")
+	}
+	switch o.Sync {
+	case "":
+		o.Sync = SyncInterval
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return o, fmt.Errorf("filestore: unknown sync policy %q (want always, interval or never)", o.Sync)
+	}
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = DefaultSyncInterval
+	}
+	if o.CompactInterval == 0 {
+		o.CompactInterval = DefaultCompactInterval
+	}
+	if o.CompactRatio <= 0 {
+		o.CompactRatio = DefaultCompactRatio
+	}
+	return o, nil
+}
+
+// record is one line of the log: a put of Resource, or a tombstone for the
+// resource with ID and Value.
+type record struct {
+	Op       string                   `json:"op"`
+	ID       string                   `json:"id,omitempty"`
+	Value    string                   `json:"value,omitempty"`
+	Resource *handlers.StringResource `json:"resource,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// Store implements handlers.StringStore, handlers.ReanalysisStore,
+// handlers.TrashStore, handlers.RetentionStore and handlers.AnnotationStore.
+type Store struct {
+	opts  Options
+	index *memstore.Store
+
+	// mu serializes writes, so checking the index, appending and applying
+	// happen as one step. Reads go straight to the index.
+	mu    sync.Mutex
+	f     *os.File // nil once closed
+	lines int      // lines in the log, live or dead
+	dirty bool     // appended since the last fsync
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open replays the log at opts.Path, creating it if missing, and starts the
+// background sync and compaction loops. Close must be called to stop them.
+func Open(opts Options) (*Store, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{opts: opts, index: memstore.New(), stop: make(chan struct{})}
+	if err := s.replay(); err != nil {
+		return nil, fmt.Errorf("filestore: replaying %s: %w", opts.Path, err)
+	}
+	s.f, err = os.OpenFile(opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Sync == SyncInterval {
+		s.every(opts.SyncInterval, s.Sync)
+	}
+	if opts.CompactInterval > 0 {
+		s.every(opts.CompactInterval, s.maybeCompact)
+	}
+	return s, nil
+}
+
+// replay rebuilds the index from the log. A torn final line, left by a crash
+// mid-append, is truncated away; a bad line anywhere else is an error.
+func (s *Store) replay() error {
+	f, err := os.Open(s.opts.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		var rec record
+		if jerr := json.Unmarshal(bytes.TrimSpace(line), &rec); jerr != nil || !rec.valid() {
+			if err == io.EOF || isLast(r) {
+				slog.Warn("truncating torn filestore record", "path", s.opts.Path, "offset", offset)
+				return os.Truncate(s.opts.Path, offset)
+			}
+			return fmt.Errorf("line %d is corrupt", s.lines+1)
+		}
+		if err := s.apply(ctx, rec); err != nil {
+			return fmt.Errorf("line %d: %w", s.lines+1, err)
+		}
+		s.lines++
+		offset += int64(len(line))
+	}
+}
+
+func (rec record) valid() bool {
+	switch rec.Op {
+	case opPut:
+		return rec.Resource != nil
+	case opDelete:
+		return true
+	}
+	return false
+}
+
+// isLast reports whether r has no more data.
+func isLast(r *bufio.Reader) bool {
+	_, err := r.Peek(1)
+	return err == io.EOF
+}
+
+// apply updates the index with rec. Puts replace, so replaying a put for an
+// existing value (an UpdateProperties) is last-write-wins.
+func (s *Store) apply(ctx context.Context, rec record) error {
+	switch rec.Op {
+	case opPut:
+		err := s.index.Delete(ctx, rec.Resource.Value)
+		if err != nil && !errors.Is(err, handlers.ErrNotFound) {
+			return err
+		}
+		return s.index.Create(ctx, rec.Resource)
+	case opDelete:
+		err := s.index.Delete(ctx, rec.Value)
+		if errors.Is(err, handlers.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown op %q", rec.Op)
+}
+
+// appendRecord writes rec as one line and applies it to the index. Callers
+// hold mu.
+func (s *Store) appendRecord(ctx context.Context, rec record) error {
+	if s.f == nil {
+		return fmt.Errorf("%w: store is closed", handlers.ErrUnavailable)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: appending to %s: %v", handlers.ErrUnavailable, s.opts.Path, err)
+	}
+	s.lines++
+	s.dirty = true
+	if s.opts.Sync == SyncAlways {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+	}
+	// The line is written; the index must follow it even if ctx has expired
+	return s.apply(context.WithoutCancel(ctx), rec)
+}
+
+func (s *Store) syncLocked() error {
+	if s.f == nil || !s.dirty {
+		return nil
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("%w: syncing %s: %v", handlers.ErrUnavailable, s.opts.Path, err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// Sync fsyncs any lines appended since the last sync.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncLocked()
+}
+
+// every runs fn every interval until Close.
+func (s *Store) every(interval time.Duration, fn func() error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-t.C:
+				if err := fn(); err != nil {
+					slog.Error("filestore background task failed", "path", s.opts.Path, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Store) maybeCompact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	live := s.index.Len()
+	if float64(s.lines-live) <= s.opts.CompactRatio*float64(max(live, 1)) {
+		return nil
+	}
+	return s.compactLocked()
+}
+
+// Compact rewrites the log with one line per live resource, in creation
+// order. Writes wait until it finishes; reads are not blocked.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compactLocked()
+}
+
+func (s *Store) compactLocked() error {
+	if s.f == nil {
+		return fmt.Errorf("%w: store is closed", handlers.ErrUnavailable)
+	}
+	ctx := context.Background()
+	// Trashed resources are live until purged
+	live, _, err := s.index.List(ctx, map[string]any{"include_deleted": true}, s.index.Len(), 0)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.opts.Path + ".compact"
+	if err := writeLog(tmp, live); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.opts.Path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(s.opts.Path)); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: reopening %s: %v", handlers.ErrUnavailable, s.opts.Path, err)
+	}
+	slog.Info("compacted filestore", "path", s.opts.Path, "lines_before", s.lines, "lines_after", len(live))
+	s.f.Close()
+	s.f = f
+	s.lines = len(live)
+	s.dirty = false
+	return nil
+}
+
+// writeLog writes one put line per resource to path and fsyncs it.
+func writeLog(path string, resources []handlers.StringResource) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range resources {
+		if err := enc.Encode(record{Op: opPut, Resource: &resources[i]}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Close stops the background loops, fsyncs and closes the log. Writes after
+// Close fail with handlers.ErrUnavailable; reads keep working.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.f == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.stop)
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.syncLocked()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
+
+// --- handlers.StringStore ---
+
+func (s *Store) Create(ctx context.Context, sr *handlers.StringResource) error {
+	_, created, err := s.CreateIfAbsent(ctx, sr)
+	if err == nil && !created {
+		return handlers.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.index.Get(ctx, sr.Value)
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, handlers.ErrNotFound) {
+		return nil, false, err
+	}
+	if err := s.appendRecord(ctx, record{Op: opPut, Resource: sr}); err != nil {
+		return nil, false, err
+	}
+	return sr, true, nil
+}
+
+func (s *Store) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	return s.index.Get(ctx, value)
+}
+
+func (s *Store) GetByID(ctx context.Context, id string) (*handlers.StringResource, error) {
+	return s.index.GetByID(ctx, id)
+}
+
+func (s *Store) Exists(ctx context.Context, value string) (bool, error) {
+	return s.index.Exists(ctx, value)
+}
+
+func (s *Store) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	return s.index.List(ctx, filters, limit, offset)
+}
+
+func (s *Store) Delete(ctx context.Context, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sr, err := s.index.Get(ctx, value)
+	if err != nil {
+		return err
+	}
+	return s.appendRecord(ctx, record{Op: opDelete, ID: sr.ID, Value: sr.Value})
+}
+
+func (s *Store) DeleteByID(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sr, err := s.index.GetByID(ctx, id)
+	if errors.Is(err, handlers.ErrAmbiguous) || (err == nil && sr.ID != id) {
+		return handlers.ErrNotFound // full IDs only
+	}
+	if err != nil {
+		return err
+	}
+	return s.appendRecord(ctx, record{Op: opDelete, ID: sr.ID, Value: sr.Value})
+}
+
+// --- handlers.TrashStore ---
+
+func (s *Store) Trash(ctx context.Context, value string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sr, err := s.index.Get(ctx, value)
+	if err == nil && sr.DeletedAt != nil {
+		err = handlers.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	sr.DeletedAt = &at
+	return s.appendRecord(ctx, record{Op: opPut, Resource: sr})
+}
+
+func (s *Store) Restore(ctx context.Context, value string) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sr, err := s.index.Get(ctx, value)
+	if err == nil && sr.DeletedAt == nil {
+		err = handlers.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sr.DeletedAt = nil
+	if err := s.appendRecord(ctx, record{Op: opPut, Resource: sr}); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// Purge appends a tombstone for every resource trashed before cutoff.
+func (s *Store) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trashed, _, err := s.index.List(ctx, map[string]any{"deleted": true}, s.index.Len(), 0)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, sr := range trashed {
+		if !sr.DeletedAt.Before(before) {
+			continue
+		}
+		if err := s.appendRecord(ctx, record{Op: opDelete, ID: sr.ID, Value: sr.Value}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// --- handlers.RetentionStore ---
+
+// DeleteExpired drops expired resources from the index without writing
+// tombstones: their puts stay expired when replayed, and compaction leaves
+// them out of the rewritten log.
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index.DeleteExpired(ctx, now, limit)
+}
+
+func (s *Store) DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, _, err := s.index.List(ctx, map[string]any{"include_deleted": true, "created_before": cutoff}, limit, 0)
+	if err != nil {
+		return 0, err
+	}
+	return s.deleteAll(ctx, old)
+}
+
+func (s *Store) DeleteOldest(ctx context.Context, keep, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	filters := map[string]any{"include_deleted": true}
+	_, total, err := s.index.List(ctx, filters, 0, 0)
+	if err != nil || total <= keep {
+		return 0, err
+	}
+	oldest, _, err := s.index.List(ctx, filters, min(total-keep, limit), 0)
+	if err != nil {
+		return 0, err
+	}
+	return s.deleteAll(ctx, oldest)
+}
+
+// deleteAll appends a tombstone for each resource. Callers hold mu.
+func (s *Store) deleteAll(ctx context.Context, resources []handlers.StringResource) (int, error) {
+	for i, sr := range resources {
+		if err := s.appendRecord(ctx, record{Op: opDelete, ID: sr.ID, Value: sr.Value}); err != nil {
+			return i, err
+		}
+	}
+	return len(resources), nil
+}
+
+// --- handlers.AnnotationStore ---
+
+func (s *Store) Annotate(ctx context.Context, value string, patch handlers.AnnotationPatch) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sr, err := s.index.Get(ctx, value)
+	if err == nil && sr.DeletedAt != nil {
+		err = handlers.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := patch.Apply(sr); err != nil {
+		return nil, err
+	}
+	if err := s.appendRecord(ctx, record{Op: opPut, Resource: sr}); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+func (s *Store) TagCounts(ctx context.Context) ([]handlers.TagCount, error) {
+	return s.index.TagCounts(ctx)
+}
+
+// --- handlers.ReanalysisStore ---
+
+func (s *Store) ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]handlers.StringResource, int, error) {
+	return s.index.ListStale(ctx, filters, version, afterID, limit)
+}
+
+func (s *Store) UpdateProperties(ctx context.Context, sr *handlers.StringResource) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, err := s.index.GetByID(ctx, sr.ID)
+	if errors.Is(err, handlers.ErrAmbiguous) || (err == nil && old.ID != sr.ID) {
+		return handlers.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	old.Properties = sr.Properties
+	old.AnalyzerVersion = sr.AnalyzerVersion
+	return s.appendRecord(ctx, record{Op: opPut, Resource: old})
+}
@@ -0,0 +1,174 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/storetest"
+)
+
+func openTest(t *testing.T, path string, opts Options) *Store {
+	t.Helper()
+	opts.Path = path
+	if opts.CompactInterval == 0 {
+		opts.CompactInterval = -1
+	}
+	s, err := Open(opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(string(policy), func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) handlers.StringStore {
+				return openTest(t, filepath.Join(t.TempDir(), "strings.jsonl"), Options{Sync: policy})
+			})
+		})
+	}
+}
+
+func newResource(value string) *handlers.StringResource {
+	props := handlers.ComputeProperties(value)
+	return &handlers.StringResource{ID: props.SHA256Hash, Value: value, Properties: props,
+		CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), AnalyzerVersion: handlers.AnalyzerVersion}
+}
+
+func lines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestReplayAndCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strings.jsonl")
+	ctx := context.Background()
+	s := openTest(t, path, Options{Sync: SyncAlways})
+
+	for _, v := range []string{"racecar", "hello", "noon"} {
+		if err := s.Create(ctx, newResource(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	stale := newResource("noon")
+	stale.AnalyzerVersion = 7
+	if err := s.UpdateProperties(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	got := lines(t, path)
+	if len(got) != 5 || !strings.HasPrefix(got[3], `{"op":"delete","id":"`) {
+		t.Fatalf("log after 3 puts, a delete and an update:\n%s", strings.Join(got, "\n"))
+	}
+
+	// Reopen: tombstones and the later put win
+	s.Close()
+	s = openTest(t, path, Options{})
+	if _, err := s.Get(ctx, "hello"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("deleted value replayed: %v", err)
+	}
+	if sr, err := s.Get(ctx, "noon"); err != nil || sr.AnalyzerVersion != 7 {
+		t.Errorf("Get(noon) after replay = %+v, %v; want analyzer_version 7", sr, err)
+	}
+
+	// Trashed resources survive compaction
+	if err := s.Trash(ctx, "racecar", time.Now().UTC().Truncate(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if got := lines(t, path); len(got) != 2 {
+		t.Errorf("log after compaction has %d lines, want 2:\n%s", len(got), strings.Join(got, "\n"))
+	}
+	// The reopened file handle still appends
+	if err := s.Create(ctx, newResource("level")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s = openTest(t, path, Options{})
+	if _, total, _ := s.List(ctx, nil, 10, 0); total != 2 {
+		t.Errorf("total after compaction and reopen = %d, want 2", total)
+	}
+	if sr, err := s.Get(ctx, "racecar"); err != nil || sr.DeletedAt == nil {
+		t.Errorf("trashed value after reopen = %+v, %v; want deleted_at set", sr, err)
+	}
+	if err := s.Create(ctx, newResource("late")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := s.Create(ctx, newResource("closed")); !errors.Is(err, handlers.ErrUnavailable) {
+		t.Errorf("Create after Close: expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestBackgroundCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strings.jsonl")
+	ctx := context.Background()
+	s := openTest(t, path, Options{CompactInterval: 10 * time.Millisecond, CompactRatio: 1})
+
+	if err := s.Create(ctx, newResource("keep")); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if err := s.Create(ctx, newResource("churn")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(ctx, "churn"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		n := s.lines
+		s.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("log still has %d lines, want 1 after background compaction", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTornAndCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	good := `{"op":"put","resource":{"id":"01","value":"a"}}` + "\n"
+
+	torn := filepath.Join(dir, "torn.jsonl")
+	os.WriteFile(torn, []byte(good+`{"op":"put","reso`), 0o644)
+	s := openTest(t, torn, Options{})
+	if _, err := s.Get(context.Background(), "a"); err != nil {
+		t.Errorf("record before torn tail lost: %v", err)
+	}
+	if got := lines(t, torn); len(got) != 1 {
+		t.Errorf("torn tail not truncated: %q", got)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.jsonl")
+	os.WriteFile(corrupt, []byte(good+"garbage\n"+good), 0o644)
+	if _, err := Open(Options{Path: corrupt}); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+
+	if _, err := Open(Options{Path: filepath.Join(dir, "x.jsonl"), Sync: "sometimes"}); err == nil {
+		t.Error("expected an error for an unknown sync policy")
+	}
+}
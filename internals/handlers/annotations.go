@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AnnotationStore is implemented by stores that keep user tags and metadata
+// next to each resource. Such stores persist StringResource.Tags and
+// Metadata on Create and support the tag and meta.<key> list filters (see
+// MatchesFilters).
+type AnnotationStore interface {
+	// Annotate applies patch to the live resource with this value and
+	// returns it, or returns ErrNotFound if there is none. The current
+	// annotations are read and written under one lock or transaction, so
+	// concurrent patches to different metadata keys all take effect.
+	Annotate(ctx context.Context, value string, patch AnnotationPatch) (*StringResource, error)
+	// TagCounts returns every tag on a live resource with the number of
+	// live resources carrying it, most used first.
+	TagCounts(ctx context.Context) ([]TagCount, error)
+}
+
+// TagCount is one entry of GET /tags.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type TagsResponse struct {
+	Data  []TagCount `json:"data"`
+	Count int        `json:"count"`
+}
+
+// StringUpdateRequest is the body of PATCH /strings/{string_value}. Tags,
+// when present, replace the current set; Metadata is a JSON merge patch
+// (RFC 7396) applied to the current object, so null removes a key and a
+// null document removes them all.
+type StringUpdateRequest struct {
+	Tags     *[]string       `json:"tags"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// AnnotationPatch is a change to the tags and metadata of a resource, as
+// requested by PATCH /strings/{string_value}.
+type AnnotationPatch struct {
+	// Tags, when non-nil, replace the current set. The handler has already
+	// normalized them.
+	Tags *[]string
+	// ClearMetadata drops the current metadata before Metadata is merged.
+	ClearMetadata bool
+	// Metadata is a JSON merge patch (RFC 7396) applied to the metadata.
+	Metadata map[string]any
+}
+
+// Apply updates the tags and metadata of sr in place. It never modifies
+// the maps and slices sr held before, so sr may be a shallow copy. It
+// returns an ErrInvalid error if the merged metadata breaks the limits.
+func (p AnnotationPatch) Apply(sr *StringResource) error {
+	metadata := sr.Metadata
+	if p.ClearMetadata {
+		metadata = nil
+	}
+	if p.Metadata != nil {
+		metadata = mergePatch(metadata, p.Metadata)
+	} else {
+		metadata = CloneMetadata(metadata)
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	if msg := checkMetadata(metadata); msg != "" {
+		return invalidError(msg)
+	}
+	if p.Tags != nil {
+		sr.Tags = slices.Clone(*p.Tags)
+	}
+	sr.Metadata = metadata
+	return nil
+}
+
+// Limits on user annotations, checked on create and update.
+const (
+	MaxTags          = 32
+	MaxTagLength     = 64
+	MaxMetadataBytes = 8 << 10
+)
+
+// normalizeTags trims tags, drops duplicates and sorts them. On invalid
+// input it returns a message for a 400 response.
+func normalizeTags(tags []string) ([]string, string) {
+	if len(tags) == 0 {
+		return nil, ""
+	}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, "Tags must not be empty"
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, fmt.Sprintf("Tags must be at most %d characters", MaxTagLength)
+		}
+		if strings.ContainsFunc(tag, unicode.IsControl) {
+			return nil, "Tags must not contain control characters"
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > MaxTags {
+		return nil, fmt.Sprintf("At most %d tags are allowed", MaxTags)
+	}
+	return out, ""
+}
+
+// checkMetadata validates a metadata object, returning a message for a 400
+// response if it is unusable.
+func checkMetadata(metadata map[string]any) string {
+	for key := range metadata {
+		if key == "" {
+			return "Metadata keys must not be empty"
+		}
+	}
+	if b, _ := json.Marshal(metadata); len(b) > MaxMetadataBytes {
+		return fmt.Sprintf("Metadata must be at most %d bytes of JSON", MaxMetadataBytes)
+	}
+	return ""
+}
+
+// MetaText is the text a meta.<key> filter compares against: strings as
+// they are, anything else as JSON (so meta.priority=3 matches the number 3).
+func MetaText(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// CloneMetadata deep-copies a decoded JSON object.
+func CloneMetadata(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = cloneJSON(v)
+	}
+	return c
+}
+
+func cloneJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return CloneMetadata(v)
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = cloneJSON(e)
+		}
+		return c
+	}
+	return v
+}
+
+// mergePatch applies an RFC 7396 merge patch to target and returns the
+// result; target is not modified.
+func mergePatch(target, patch map[string]any) map[string]any {
+	out := CloneMetadata(target)
+	if out == nil {
+		out = make(map[string]any)
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(out, k)
+		case map[string]any:
+			sub, _ := out[k].(map[string]any)
+			out[k] = mergePatch(sub, v)
+		default:
+			out[k] = cloneJSON(v)
+		}
+	}
+	return out
+}
+
+// PATCH /strings/{string_value}
+func (h *Handler) UpdateString(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only PATCH is allowed")
+		return
+	}
+	store := h.storeFor(r)
+	as, ok := store.(AnnotationStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not support tags or metadata")
+		return
+	}
+
+	value, ok := valueFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req StringUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Tags == nil && len(req.Metadata) == 0 {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Nothing to update: set tags or metadata")
+		return
+	}
+	var patch AnnotationPatch
+	if req.Tags != nil {
+		tags, msg := normalizeTags(*req.Tags)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, "Bad Request", msg)
+			return
+		}
+		patch.Tags = &tags
+	}
+	switch {
+	case bytes.Equal(req.Metadata, []byte("null")):
+		patch.ClearMetadata = true // "metadata": null
+	case len(req.Metadata) > 0:
+		if err := json.Unmarshal(req.Metadata, &patch.Metadata); err != nil || patch.Metadata == nil {
+			writeError(w, http.StatusBadRequest, "Bad Request", "metadata must be a JSON object")
+			return
+		}
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	updated, err := as.Annotate(ctx, value, patch)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	slog.Info("string annotated", "id", updated.ID, "value", updated.Value, "tags", len(updated.Tags), "metadata_keys", len(updated.Metadata))
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// GET /tags
+func (h *Handler) ListTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
+		return
+	}
+	as, ok := h.storeFor(r).(AnnotationStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not support tags or metadata")
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	counts, err := as.TagCounts(ctx)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if counts == nil {
+		counts = []TagCount{}
+	}
+	writeJSON(w, http.StatusOK, TagsResponse{Data: counts, Count: len(counts)})
+}
+
+// SortTagCounts orders counts most used first, then by tag, as TagCounts
+// requires.
+func SortTagCounts(counts []TagCount) {
+	slices.SortFunc(counts, func(a, b TagCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+}
@@ -0,0 +1,140 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+)
+
+// patch sends body to PATCH /strings/{value} and returns the status and
+// decoded JSON response.
+func patch(t *testing.T, server *httptest.Server, value, body string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+"/strings/"+value, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("PATCH %s: %v", value, err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func TestAnnotations(t *testing.T) {
+	server := httptest.NewServer(handlers.SetupRoutes(memstore.New()))
+	defer server.Close()
+
+	code, body := post(t, server, `{"value":"racecar","tags":[" fast ","car","fast"],"metadata":{"source":"crawler","rank":{"a":1,"b":2}}}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST with tags: %d %v", code, body)
+	}
+	if tags, _ := json.Marshal(body["tags"]); string(tags) != `["car","fast"]` {
+		t.Errorf("tags = %s, want normalized [car fast]", tags)
+	}
+	post(t, server, `{"value":"level","tags":["car"],"metadata":{"source":"import","priority":3}}`)
+	post(t, server, `{"value":"plain"}`)
+
+	t.Run("merge patch", func(t *testing.T) {
+		code, body := patch(t, server, "racecar", `{"metadata":{"source":null,"rank":{"b":null,"c":3},"owner":"me"}}`)
+		if code != http.StatusOK {
+			t.Fatalf("PATCH: %d %v", code, body)
+		}
+		if meta, _ := json.Marshal(body["metadata"]); string(meta) != `{"owner":"me","rank":{"a":1,"c":3}}` {
+			t.Errorf("metadata = %s", meta)
+		}
+		if tags, _ := json.Marshal(body["tags"]); string(tags) != `["car","fast"]` {
+			t.Errorf("tags changed by a metadata-only patch: %s", tags)
+		}
+
+		code, body = patch(t, server, "racecar", `{"tags":["palindrome"],"metadata":null}`)
+		if code != http.StatusOK || body["metadata"] != nil {
+			t.Fatalf("PATCH clearing metadata: %d %v", code, body)
+		}
+		if tags, _ := json.Marshal(body["tags"]); string(tags) != `["palindrome"]` {
+			t.Errorf("tags = %s, want [palindrome]", tags)
+		}
+		if code, body := patch(t, server, "racecar", `{"tags":[]}`); code != http.StatusOK || body["tags"] != nil {
+			t.Errorf("PATCH clearing tags: %d %v", code, body)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		cases := []struct {
+			value, body string
+			want        int
+		}{
+			{"level", `{}`, http.StatusBadRequest},
+			{"level", `not json`, http.StatusBadRequest},
+			{"level", `{"metadata":[1,2]}`, http.StatusBadRequest},
+			{"level", `{"tags":["  "]}`, http.StatusBadRequest},
+			{"level", `{"tags":["` + strings.Repeat("x", handlers.MaxTagLength+1) + `"]}`, http.StatusBadRequest},
+			{"level", `{"metadata":{"":1}}`, http.StatusBadRequest},
+			{"level", `{"metadata":{"big":"` + strings.Repeat("x", handlers.MaxMetadataBytes) + `"}}`, http.StatusBadRequest},
+			{"missing", `{"tags":["x"]}`, http.StatusNotFound},
+		}
+		for _, tc := range cases {
+			if code, _ := patch(t, server, tc.value, tc.body); code != tc.want {
+				t.Errorf("PATCH %s %s: status %d, want %d", tc.value, tc.body, code, tc.want)
+			}
+		}
+		if code, _ := post(t, server, `{"value":"x","tags":["a\u0000b"]}`); code != http.StatusBadRequest {
+			t.Errorf("POST with a control character in a tag: status %d, want 400", code)
+		}
+	})
+
+	t.Run("filters and tag counts", func(t *testing.T) {
+		patch(t, server, "plain", `{"tags":["car","plain"]}`)
+		lists := map[string]float64{
+			"/strings/list?tag=car":                   2,
+			"/strings/list?tag=plain":                 1,
+			"/strings/list?meta.source=import":        1,
+			"/strings/list?meta.priority=3":           1,
+			"/strings/list?tag=car&meta.source=other": 0,
+		}
+		for path, want := range lists {
+			if code, body := do(t, server, http.MethodGet, path); code != http.StatusOK || body["count"] != want {
+				t.Errorf("GET %s: %d, count %v, want %v", path, code, body["count"], want)
+			}
+		}
+		if code, _ := do(t, server, http.MethodGet, "/strings/list?meta.=x"); code != http.StatusBadRequest {
+			t.Errorf("GET with an empty meta key: status %d, want 400", code)
+		}
+		for _, path := range []string{"/strings/list?tag=", "/strings/list?tag=%20"} {
+			if code, body := do(t, server, http.MethodGet, path); code != http.StatusBadRequest || body["message"] != "Tags must not be empty" {
+				t.Errorf("GET %s: %d %v, want 400", path, code, body)
+			}
+		}
+
+		code, body := do(t, server, http.MethodGet, "/tags")
+		if code != http.StatusOK || body["count"] != float64(2) {
+			t.Fatalf("GET /tags: %d %v", code, body)
+		}
+		if data, _ := json.Marshal(body["data"]); string(data) != `[{"count":2,"tag":"car"},{"count":1,"tag":"plain"}]` {
+			t.Errorf("GET /tags data = %s", data)
+		}
+	})
+}
+
+// TestAnnotationsUnsupported checks that a store without annotations refuses
+// them rather than dropping them.
+func TestAnnotationsUnsupported(t *testing.T) {
+	server, store := setupTestServer()
+	defer server.Close()
+	seedStore(store, "hello")
+	if code, _ := post(t, server, `{"value":"tagged","tags":["a"]}`); code != http.StatusNotImplemented {
+		t.Errorf("POST with tags: status %d, want 501", code)
+	}
+	if code, _ := patch(t, server, "hello", `{"tags":["a"]}`); code != http.StatusNotImplemented {
+		t.Errorf("PATCH: status %d, want 501", code)
+	}
+	if code, _ := do(t, server, http.MethodGet, "/tags"); code != http.StatusNotImplemented {
+		t.Errorf("GET /tags: status %d, want 501", code)
+	}
+}
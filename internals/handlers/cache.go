@@ -0,0 +1,43 @@
+package handlers
+
+import "net/http"
+
+// CacheCounters count lookups of one kind of cache entry.
+type CacheCounters struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Coalesced counts misses that waited for an identical in-flight load
+	// instead of querying the store themselves.
+	Coalesced uint64 `json:"coalesced"`
+}
+
+// CacheStats is a snapshot of a caching store's metrics, served by
+// GET /admin/cache.
+type CacheStats struct {
+	Get           CacheCounters `json:"get"`
+	List          CacheCounters `json:"list"`
+	Evictions     uint64        `json:"evictions"`
+	Invalidations uint64        `json:"invalidations"`
+	Entries       int           `json:"entries"`
+	Bytes         int64         `json:"bytes"`
+}
+
+// CacheReporter is optionally implemented by stores that cache results.
+type CacheReporter interface {
+	CacheStats() CacheStats
+}
+
+// GET /admin/cache reports the store's cache metrics.
+func (h *Handler) HandleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed for this path")
+		return
+	}
+	reporter, ok := h.store.(CacheReporter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store is not cached")
+		return
+	}
+	writeJSON(w, http.StatusOK, reporter.CacheStats())
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventStore is implemented by stores that keep an audit trail: every
+// change to a resource is recorded, in the same transaction as the change,
+// as an Event that is never updated afterwards. Events outlive the
+// resource, so the history of a value that was deleted and created again
+// is complete.
+type EventStore interface {
+	// Events returns a page of the events matching filter in the order
+	// they were recorded, and how many match in total.
+	Events(ctx context.Context, filter EventFilter, limit, offset int) ([]Event, int, error)
+}
+
+// Event types.
+const (
+	EventCreate = "create"
+	// EventUpdate records re-analysis and edits of tags or metadata.
+	EventUpdate = "update"
+	// EventDelete records a client delete: a move to the trash, or a
+	// permanent delete on a store without one.
+	EventDelete  = "delete"
+	EventRestore = "restore"
+	// EventPurge records a permanent delete by a background job: trash
+	// purging, retention or expiry.
+	EventPurge = "purge"
+)
+
+var eventTypes = map[string]bool{
+	EventCreate: true, EventUpdate: true, EventDelete: true, EventRestore: true, EventPurge: true,
+}
+
+// Event is one change to a resource. Before is nil for EventCreate and
+// After is nil once the resource is gone for good.
+type Event struct {
+	ID       int64           `json:"id"`
+	Type     string          `json:"type"`
+	Value    string          `json:"value"`
+	StringID string          `json:"string_id"`
+	Actor    string          `json:"actor"`
+	At       time.Time       `json:"at"`
+	Before   *StringResource `json:"before"`
+	After    *StringResource `json:"after"`
+}
+
+// EventFilter selects events; zero fields match everything.
+type EventFilter struct {
+	Value string
+	Type  string
+	Actor string
+	// Since is inclusive and Until exclusive.
+	Since time.Time
+	Until time.Time
+	// AfterID skips events up to and including this ID, so a client can
+	// follow the feed from the last event it saw.
+	AfterID int64
+}
+
+type EventsResponse struct {
+	Data  []Event `json:"data"`
+	Count int     `json:"count"`
+}
+
+// ActorHeader names who is making a request, for the audit trail. The API
+// has no authentication, so the actor is recorded as the client's claim.
+const ActorHeader = "X-Actor"
+
+// SystemActorPrefix starts the actors of background jobs. Clients cannot
+// claim it, so events recorded under it were made by the server.
+const SystemActorPrefix = "system:"
+
+// DefaultActor is recorded for changes made without a known actor.
+const DefaultActor = "anonymous"
+
+// MaxActorLength caps the recorded actor; longer ActorHeader values are
+// cut short.
+const MaxActorLength = 128
+
+// Actors recorded for changes made by the background jobs.
+const (
+	ActorReaper     = SystemActorPrefix + "reaper"
+	ActorPurger     = SystemActorPrefix + "trash-purge"
+	ActorReanalysis = SystemActorPrefix + "reanalysis"
+)
+
+// actorKey is the context key of the actor set by WithActor.
+type actorKey struct{}
+
+// WithActor returns a context whose store calls are recorded as made by
+// actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, or DefaultActor.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return DefaultActor
+}
+
+// requestActor returns the actor claimed by r's ActorHeader. A claim to be
+// a background job is ignored, leaving DefaultActor.
+func requestActor(r *http.Request) string {
+	actor := strings.TrimSpace(r.Header.Get(ActorHeader))
+	if strings.HasPrefix(actor, SystemActorPrefix) {
+		return ""
+	}
+	if len(actor) > MaxActorLength {
+		actor = strings.ToValidUTF8(actor[:MaxActorLength], "")
+	}
+	return actor
+}
+
+// parseEventFilter reads the type, actor, value, since, until and after_id
+// query parameters. On invalid input it returns a message for a 400
+// response.
+func parseEventFilter(query url.Values) (EventFilter, string) {
+	f := EventFilter{
+		Value: query.Get("value"),
+		Type:  query.Get("type"),
+		Actor: query.Get("actor"),
+	}
+	if f.Type != "" && !eventTypes[f.Type] {
+		return f, "Invalid type value (create, update, delete, restore or purge)"
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if val := query.Get(p.name); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return f, "Invalid " + p.name + " value (expected RFC3339)"
+			}
+			*p.t = t
+		}
+	}
+	if val := query.Get("after_id"); val != "" {
+		id, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || id < 0 {
+			return f, "Invalid after_id value"
+		}
+		f.AfterID = id
+	}
+	return f, ""
+}
+
+// eventStore returns the EventStore serving r, or writes a 501 response
+// and returns ok=false.
+func (h *Handler) eventStore(w http.ResponseWriter, r *http.Request) (EventStore, bool) {
+	events, ok := h.storeFor(r).(EventStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not keep an audit trail")
+	}
+	return events, ok
+}
+
+// GET /events
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
+		return
+	}
+	events, ok := h.eventStore(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter, msg := parseEventFilter(query)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
+		return
+	}
+	limit, offset, msg := parsePage(query)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
+		return
+	}
+	h.writeEvents(w, r, events, filter, limit, offset, false)
+}
+
+// GET /strings/{string_value}/history
+func (h *Handler) StringHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
+		return
+	}
+	events, ok := h.eventStore(w, r)
+	if !ok {
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/strings/"), "/history")
+	value, err := url.PathUnescape(path)
+	if err != nil || value == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid string value in path")
+		return
+	}
+	limit, offset, msg := parsePage(r.URL.Query())
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
+		return
+	}
+	h.writeEvents(w, r, events, EventFilter{Value: value}, limit, offset, true)
+}
+
+// writeEvents writes a page of events. With notFound, a value without any
+// events gets a 404 rather than an empty page.
+func (h *Handler) writeEvents(w http.ResponseWriter, r *http.Request, events EventStore, filter EventFilter, limit, offset int, notFound bool) {
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	data, count, err := events.Events(ctx, filter, limit, offset)
+	if err == nil && count == 0 && notFound {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if data == nil {
+		data = []Event{}
+	}
+	writeJSON(w, http.StatusOK, EventsResponse{Data: data, Count: count})
+}
@@ -0,0 +1,49 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+func TestEventsNotSupported(t *testing.T) {
+	server, _ := setupTestServer()
+	defer server.Close()
+
+	for _, path := range []string{"/events", "/strings/racecar/history", "/ns/default/events"} {
+		if code, body := do(t, server, http.MethodGet, path); code != http.StatusNotImplemented {
+			t.Errorf("GET %s: %d %v, want 501", path, code, body)
+		}
+	}
+	if code, body := do(t, server, http.MethodPost, "/events"); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /events: %d %v, want 405", code, body)
+	}
+}
+
+func TestValueNamedHistory(t *testing.T) {
+	server, _ := setupTestServer()
+	defer server.Close()
+
+	if code, _ := post(t, server, `{"value": "history"}`); code != http.StatusCreated {
+		t.Fatalf("POST: status %d", code)
+	}
+	code, body := do(t, server, http.MethodGet, "/strings/history")
+	if code != http.StatusOK || body["value"] != "history" {
+		t.Errorf("GET /strings/history: %d %v, want the stored string", code, body)
+	}
+}
+
+func TestActorFrom(t *testing.T) {
+	ctx := context.Background()
+	if got := handlers.ActorFrom(ctx); got != handlers.DefaultActor {
+		t.Errorf("ActorFrom(empty) = %q, want %q", got, handlers.DefaultActor)
+	}
+	if got := handlers.ActorFrom(handlers.WithActor(ctx, "")); got != handlers.DefaultActor {
+		t.Errorf("ActorFrom(\"\") = %q, want %q", got, handlers.DefaultActor)
+	}
+	if got := handlers.ActorFrom(handlers.WithActor(ctx, "alice")); got != "alice" {
+		t.Errorf("ActorFrom(alice) = %q, want alice", got)
+	}
+}
@@ -2,17 +2,22 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	// Import the package we are testing
 	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/nlquery"
+	"github.com/kodevoid/string_analyzer/internals/storetest"
 )
 
 // --- Test Setup ---
@@ -30,44 +35,127 @@ func NewInMemoryStore() *InMemoryStore {
 	}
 }
 
-func (s *InMemoryStore) Create(sr *handlers.StringResource) error {
+func (s *InMemoryStore) Create(ctx context.Context, sr *handlers.StringResource) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, exists := s.store[sr.Value]; exists {
-		return fmt.Errorf("string already exists")
+		return handlers.ErrConflict
 	}
 	s.store[sr.Value] = sr
 	return nil
 }
 
-func (s *InMemoryStore) Get(value string) (*handlers.StringResource, error) {
+func (s *InMemoryStore) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	res, exists := s.store[value]
 	if !exists {
-		return nil, fmt.Errorf("string not found")
+		return nil, handlers.ErrNotFound
 	}
 	return res, nil
 }
 
-func (s *InMemoryStore) Delete(value string) error {
+func (s *InMemoryStore) Delete(ctx context.Context, value string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, exists := s.store[value]; !exists {
-		return fmt.Errorf("string not found")
+		return handlers.ErrNotFound
 	}
 	delete(s.store, value)
 	return nil
 }
 
-func (s *InMemoryStore) Exists(value string) bool {
+func (s *InMemoryStore) Exists(ctx context.Context, value string) (bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	_, exists := s.store[value]
-	return exists
+	return exists, nil
+}
+
+func (s *InMemoryStore) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, exists := s.store[sr.Value]; exists {
+		return existing, false, nil
+	}
+	s.store[sr.Value] = sr
+	return sr, true, nil
+}
+
+func (s *InMemoryStore) GetByID(ctx context.Context, id string) (*handlers.StringResource, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found *handlers.StringResource
+	for _, res := range s.store {
+		if strings.HasPrefix(res.ID, id) {
+			if found != nil {
+				return nil, handlers.ErrAmbiguous
+			}
+			found = res
+		}
+	}
+	if found == nil {
+		return nil, handlers.ErrNotFound
+	}
+	return found, nil
+}
+
+func (s *InMemoryStore) DeleteByID(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for value, res := range s.store {
+		if res.ID == id {
+			delete(s.store, value)
+			return nil
+		}
+	}
+	return handlers.ErrNotFound
 }
 
-func (s *InMemoryStore) List(filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+func (s *InMemoryStore) ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]handlers.StringResource, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var stale []handlers.StringResource
+	for _, res := range s.store {
+		if res.AnalyzerVersion < version && s.matchesFilters(res, filters) {
+			stale = append(stale, *res)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].ID < stale[j].ID })
+	total := len(stale)
+	i := sort.Search(len(stale), func(i int) bool { return stale[i].ID > afterID })
+	stale = stale[i:]
+	if len(stale) > limit {
+		stale = stale[:limit]
+	}
+	return stale, total, nil
+}
+
+func (s *InMemoryStore) UpdateProperties(ctx context.Context, sr *handlers.StringResource) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for value, res := range s.store {
+		if res.ID == sr.ID {
+			updated := *res
+			updated.Properties = sr.Properties
+			updated.AnalyzerVersion = sr.AnalyzerVersion
+			s.store[value] = &updated
+			return nil
+		}
+	}
+	return handlers.ErrNotFound
+}
+
+func (s *InMemoryStore) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	var allResults []handlers.StringResource
@@ -76,6 +164,8 @@ func (s *InMemoryStore) List(filters map[string]any, limit, offset int) ([]handl
 			allResults = append(allResults, *res)
 		}
 	}
+	// Map order is random; pages must be stable
+	sort.Slice(allResults, func(i, j int) bool { return allResults[i].Value < allResults[j].Value })
 	totalCount := len(allResults)
 	start := offset
 	end := offset + limit
@@ -113,29 +203,48 @@ func (s *InMemoryStore) matchesFilters(res *handlers.StringResource, filters map
 			if _, exists := res.Properties.CharacterFrequencyMap[char]; !exists {
 				return false
 			}
+		case "created_after":
+			if res.CreatedAt.Before(val.(time.Time)) {
+				return false
+			}
+		case "created_before":
+			if !res.CreatedAt.Before(val.(time.Time)) {
+				return false
+			}
 		}
 	}
 	return true
 }
 
+// TestInMemoryStoreConformance keeps the test double honest: handler tests
+// are only meaningful if it behaves like the real stores.
+func TestInMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.StringStore { return NewInMemoryStore() })
+}
+
 // setupTestServer creates a new server and store for each test to ensure isolation.
-func setupTestServer() (*httptest.Server, *InMemoryStore) {
+func setupTestServer(opts ...handlers.Option) (*httptest.Server, *InMemoryStore) {
 	store := NewInMemoryStore()
 	// Use the SetupRoutes function from the handlers package
-	router := handlers.SetupRoutes(store)
+	router := handlers.SetupRoutes(store, opts...)
 	server := httptest.NewServer(router)
 	return server, store
 }
 
 // seedStore is a helper to populate the store for list/filter tests
 func seedStore(store *InMemoryStore, values ...string) {
+	seedStoreAt(store, time.Now(), values...)
+}
+
+// seedStoreAt is like seedStore but stamps every resource with createdAt
+func seedStoreAt(store *InMemoryStore, createdAt time.Time, values ...string) {
 	for _, val := range values {
 		props := handlers.ComputeProperties(val)
-		_ = store.Create(&handlers.StringResource{
+		_ = store.Create(context.Background(), &handlers.StringResource{
 			ID:         props.SHA256Hash,
 			Value:      val,
 			Properties: props,
-			CreatedAt:  time.Now(),
+			CreatedAt:  createdAt,
 		})
 	}
 }
@@ -211,6 +320,10 @@ func TestCreateString(t *testing.T) {
 		if errResp.Error != "Conflict" {
 			t.Errorf("Expected error 'Conflict', got '%s'", errResp.Error)
 		}
+		existing, _ := store.Get(context.Background(), value)
+		if errResp.ID != existing.ID {
+			t.Errorf("Expected existing ID '%s' in body, got '%s'", existing.ID, errResp.ID)
+		}
 	})
 
 	t.Run("400 Bad Request - missing value", func(t *testing.T) {
@@ -295,7 +408,7 @@ func TestDeleteString(t *testing.T) {
 
 	t.Run("204 No Content - deleted", func(t *testing.T) {
 		// Verify it exists first
-		if !store.Exists(value) {
+		if exists, _ := store.Exists(context.Background(), value); !exists {
 			t.Fatal("Test setup failed: string was not seeded")
 		}
 
@@ -311,7 +424,7 @@ func TestDeleteString(t *testing.T) {
 		}
 
 		// Verify it's gone from the store
-		if store.Exists(value) {
+		if exists, _ := store.Exists(context.Background(), value); exists {
 			t.Error("Expected string to be deleted from store, but it still exists")
 		}
 	})
@@ -505,6 +618,60 @@ func TestFilterByNaturalLanguage(t *testing.T) {
 		}
 	})
 
+	t.Run("typos are corrected and reported", func(t *testing.T) {
+		query := url.QueryEscape("palindrms lenght more than 7")
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?query=" + query)
+		nl, _ := decodeNL(resp)
+
+		if nl.Count != 1 { // "A man..."
+			t.Errorf("Expected count 1, got %d", nl.Count)
+		}
+		if len(nl.InterpretedQuery.Corrections) != 2 {
+			t.Fatalf("Expected 2 corrections, got %v", nl.InterpretedQuery.Corrections)
+		}
+		if c := nl.InterpretedQuery.Corrections[1]; c.Original != "lenght" || c.Corrected != "length" {
+			t.Errorf("Expected correction lenght -> length, got %v", c)
+		}
+	})
+
+	t.Run("French via Accept-Language", func(t *testing.T) {
+		query := url.QueryEscape("chaînes palindromes de plus de 5 caractères")
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/strings/filter-by-natural-language?query="+query, nil)
+		req.Header.Set("Accept-Language", "fr-FR,fr;q=0.9,en;q=0.5")
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		nl, _ := decodeNL(resp)
+
+		if nl.InterpretedQuery.Language != "fr" {
+			t.Errorf("Expected language fr, got %q", nl.InterpretedQuery.Language)
+		}
+		if nl.Count != 2 { // racecar, "A man..."
+			t.Errorf("Expected count 2, got %d", nl.Count)
+		}
+	})
+
+	t.Run("Spanish via lang parameter", func(t *testing.T) {
+		query := url.QueryEscape("cadenas de una sola palabra")
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?lang=es&query=" + query)
+		nl, _ := decodeNL(resp)
+
+		if nl.InterpretedQuery.Language != "es" {
+			t.Errorf("Expected language es, got %q", nl.InterpretedQuery.Language)
+		}
+		if nl.Count != 3 { // racecar, test, madam
+			t.Errorf("Expected count 3, got %d", nl.Count)
+		}
+	})
+
+	t.Run("400 Bad Request - unsupported lang", func(t *testing.T) {
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?lang=de&query=palindrome")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
 	t.Run("400 Bad Request - no query", func(t *testing.T) {
 		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?query=")
 		if resp.StatusCode != http.StatusBadRequest {
@@ -512,3 +679,486 @@ func TestFilterByNaturalLanguage(t *testing.T) {
 		}
 	})
 }
+
+func TestFilterByNaturalLanguageTime(t *testing.T) {
+	// Fixed clock: 2025-10-22 15:00 UTC
+	now := time.Date(2025, time.October, 22, 15, 0, 0, 0, time.UTC)
+	server, store := setupTestServer(handlers.WithClock(func() time.Time { return now }))
+	defer server.Close()
+
+	seedStoreAt(store, now.Add(-1*time.Hour), "one hour ago")
+	seedStoreAt(store, now.Add(-5*time.Hour), "five hours ago")
+	seedStoreAt(store, now.AddDate(0, 0, -1), "yesterday afternoon")
+	seedStoreAt(store, time.Date(2025, time.September, 15, 12, 0, 0, 0, time.UTC), "mid september")
+
+	decodeNL := func(resp *http.Response) handlers.NaturalLanguageResponse {
+		var nlResp handlers.NaturalLanguageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&nlResp); err != nil {
+			t.Fatalf("failed to decode natural language response: %v", err)
+		}
+		return nlResp
+	}
+
+	tests := []struct {
+		query         string
+		expectedCount int
+		filter        string
+		expectedTime  time.Time
+	}{
+		{"strings added today", 2, "created_after", time.Date(2025, time.October, 22, 0, 0, 0, 0, time.UTC)},
+		{"created in the last 3 hours", 1, "created_after", now.Add(-3 * time.Hour)},
+		{"strings since yesterday", 3, "created_after", time.Date(2025, time.October, 21, 0, 0, 0, 0, time.UTC)},
+		{"strings before October 2025", 1, "created_before", time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC)},
+		{"strings added yesterday", 1, "created_before", time.Date(2025, time.October, 22, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			resp, err := server.Client().Get(server.URL + "/strings/filter-by-natural-language?query=" + url.QueryEscape(tc.query))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			nl := decodeNL(resp)
+			if nl.Count != tc.expectedCount {
+				t.Errorf("Expected count %d, got %d", tc.expectedCount, nl.Count)
+			}
+			raw, ok := nl.InterpretedQuery.ParsedFilters[tc.filter].(string)
+			if !ok {
+				t.Fatalf("Expected parsed filter %s, got %v", tc.filter, nl.InterpretedQuery.ParsedFilters)
+			}
+			got, err := time.Parse(time.RFC3339, raw)
+			if err != nil || !got.Equal(tc.expectedTime) {
+				t.Errorf("Expected %s=%s, got %s", tc.filter, tc.expectedTime.Format(time.RFC3339), raw)
+			}
+		})
+	}
+
+	t.Run("GET /strings/list - created_after", func(t *testing.T) {
+		after := url.QueryEscape(now.Add(-2 * time.Hour).Format(time.RFC3339))
+		resp, _ := server.Client().Get(server.URL + "/strings/list?created_after=" + after)
+		var list handlers.ListResponse
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if list.Count != 1 {
+			t.Errorf("Expected count 1, got %d", list.Count)
+		}
+	})
+
+	t.Run("GET /strings/list - 400 invalid created_before", func(t *testing.T) {
+		resp, _ := server.Client().Get(server.URL + "/strings/list?created_before=yesterday")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+}
+
+// explainingStore adds a canned QueryExplainer implementation to the in-memory store
+type explainingStore struct {
+	*InMemoryStore
+	gotFilters map[string]any
+}
+
+func (s *explainingStore) ExplainList(ctx context.Context, filters map[string]any, limit, offset int) (*handlers.QueryPlan, error) {
+	s.gotFilters = filters
+	return &handlers.QueryPlan{SQL: "SELECT ...", Args: []any{1}}, nil
+}
+
+func TestExplainNaturalLanguage(t *testing.T) {
+	server, store := setupTestServer()
+	defer server.Close()
+	seedStore(store, "racecar")
+
+	decodeExplain := func(resp *http.Response) handlers.ExplainResponse {
+		var explain handlers.ExplainResponse
+		if err := json.NewDecoder(resp.Body).Decode(&explain); err != nil {
+			t.Fatalf("failed to decode explain response: %v", err)
+		}
+		return explain
+	}
+
+	t.Run("parse tree and spans", func(t *testing.T) {
+		query := url.QueryEscape("palindromes longer than 3 chars")
+		resp, err := server.Client().Get(server.URL + "/strings/filter-by-natural-language/explain?query=" + query)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		explain := decodeExplain(resp)
+
+		if len(explain.ParseTree) != 2 {
+			t.Fatalf("Expected 2 clauses, got %+v", explain.ParseTree)
+		}
+		length := explain.ParseTree[1]
+		if length.Text != "longer than 3" || length.Start != 12 || length.End != 25 {
+			t.Errorf("Unexpected length clause %+v", length)
+		}
+		if len(explain.MatchedSpans) != 4 { // palindromes, longer, 3, chars
+			t.Errorf("Expected 4 matched spans, got %+v", explain.MatchedSpans)
+		}
+		if explain.QueryPlan != nil {
+			t.Errorf("Expected no query plan from a store without QueryExplainer, got %+v", explain.QueryPlan)
+		}
+	})
+
+	t.Run("query plan from store", func(t *testing.T) {
+		store := &explainingStore{InMemoryStore: NewInMemoryStore()}
+		server := httptest.NewServer(handlers.SetupRoutes(store))
+		defer server.Close()
+
+		query := url.QueryEscape("single word palindromes")
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language/explain?query=" + query)
+		explain := decodeExplain(resp)
+
+		if explain.QueryPlan == nil || explain.QueryPlan.SQL != "SELECT ..." {
+			t.Fatalf("Expected query plan from store, got %+v", explain.QueryPlan)
+		}
+		if store.gotFilters["word_count"] != 1 || store.gotFilters["is_palindrome"] != true {
+			t.Errorf("Expected parsed filters passed to ExplainList, got %v", store.gotFilters)
+		}
+	})
+
+	t.Run("400 Bad Request - no query", func(t *testing.T) {
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language/explain")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+}
+
+// failingExtractor simulates an unreachable model backend
+type failingExtractor struct{}
+
+func (failingExtractor) Extract(ctx context.Context, req nlquery.Request) (*nlquery.Result, error) {
+	return nil, fmt.Errorf("%w: connection refused", nlquery.ErrBackend)
+}
+
+func TestNaturalLanguageExtractor(t *testing.T) {
+	t.Run("default rule parser reports its source", func(t *testing.T) {
+		server, _ := setupTestServer()
+		defer server.Close()
+
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?query=palindromes")
+		var nl handlers.NaturalLanguageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&nl); err != nil {
+			t.Fatal(err)
+		}
+		if nl.InterpretedQuery.Source != nlquery.SourceRules {
+			t.Errorf("Expected source %q, got %q", nlquery.SourceRules, nl.InterpretedQuery.Source)
+		}
+	})
+
+	t.Run("502 Bad Gateway - backend failure", func(t *testing.T) {
+		server, _ := setupTestServer(handlers.WithExtractor(failingExtractor{}))
+		defer server.Close()
+
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?query=palindromes")
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("Expected status %d, got %d", http.StatusBadGateway, resp.StatusCode)
+		}
+	})
+
+	t.Run("combined extractor falls back to rules", func(t *testing.T) {
+		combined := &nlquery.Combined{Rules: nlquery.RuleExtractor{}, Model: failingExtractor{}}
+		server, store := setupTestServer(handlers.WithExtractor(combined))
+		defer server.Close()
+		seedStore(store, "racecar", "hello")
+
+		resp, _ := server.Client().Get(server.URL + "/strings/filter-by-natural-language?query=palindromes")
+		var nl handlers.NaturalLanguageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&nl); err != nil {
+			t.Fatal(err)
+		}
+		if nl.Count != 1 || len(nl.InterpretedQuery.Warnings) != 1 {
+			t.Errorf("Expected 1 result and a fallback warning, got count=%d warnings=%v", nl.Count, nl.InterpretedQuery.Warnings)
+		}
+	})
+}
+
+// slowStore blocks every call until the context is done, like a stuck database
+type slowStore struct {
+	*InMemoryStore
+}
+
+func (s *slowStore) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *slowStore) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	<-ctx.Done()
+	return nil, 0, ctx.Err()
+}
+
+func TestStoreTimeout(t *testing.T) {
+	store := &slowStore{InMemoryStore: NewInMemoryStore()}
+	server := httptest.NewServer(handlers.SetupRoutes(store, handlers.WithStoreTimeout(20*time.Millisecond)))
+	defer server.Close()
+
+	for _, path := range []string{"/strings/list", "/strings/hello", "/strings/filter-by-natural-language?query=palindromes"} {
+		t.Run("504 Gateway Timeout - "+path, func(t *testing.T) {
+			resp, err := server.Client().Get(server.URL + path)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusGatewayTimeout {
+				t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// racingStore reports a unique-constraint violation instead of the existing
+// resource, like a backend that lost an insert race it could not resolve.
+type racingStore struct {
+	*InMemoryStore
+}
+
+func (s *racingStore) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	return nil, false, fmt.Errorf("%w: UNIQUE constraint failed: strings.value", handlers.ErrConflict)
+}
+
+// unavailableStore fails every read like a locked or closed database.
+type unavailableStore struct {
+	*InMemoryStore
+}
+
+func (s *unavailableStore) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	return nil, fmt.Errorf("%w: database is locked", handlers.ErrUnavailable)
+}
+
+func TestStoreErrors(t *testing.T) {
+	t.Run("409 Conflict - store reports ErrConflict", func(t *testing.T) {
+		store := &racingStore{InMemoryStore: NewInMemoryStore()}
+		seedStore(store.InMemoryStore, "racecar")
+		server := httptest.NewServer(handlers.SetupRoutes(store))
+		defer server.Close()
+
+		resp, _ := server.Client().Post(server.URL+"/strings", "application/json", bytes.NewBufferString(`{"value": "racecar"}`))
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, resp.StatusCode)
+		}
+	})
+
+	t.Run("concurrent duplicate POSTs", func(t *testing.T) {
+		server, _ := setupTestServer()
+		defer server.Close()
+
+		const n = 20
+		codes := make(chan int, n)
+		var wg sync.WaitGroup
+		for range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := server.Client().Post(server.URL+"/strings", "application/json", bytes.NewBufferString(`{"value": "same"}`))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				codes <- resp.StatusCode
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		created := 0
+		for code := range codes {
+			switch code {
+			case http.StatusCreated:
+				created++
+			case http.StatusConflict:
+			default:
+				t.Errorf("Expected only 201 or 409, got %d", code)
+			}
+		}
+		if created != 1 {
+			t.Errorf("Expected exactly one 201, got %d", created)
+		}
+	})
+
+	t.Run("503 Service Unavailable", func(t *testing.T) {
+		store := &unavailableStore{InMemoryStore: NewInMemoryStore()}
+		server := httptest.NewServer(handlers.SetupRoutes(store))
+		defer server.Close()
+
+		resp, err := server.Client().Get(server.URL + "/strings/hello")
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+		}
+		var body handlers.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		if strings.Contains(body.Message, "database is locked") {
+			t.Errorf("Expected the store error to stay server-side, got message %q", body.Message)
+		}
+	})
+}
+
+func TestStringByID(t *testing.T) {
+	server, store := setupTestServer()
+	defer server.Close()
+	seedStore(store, "racecar")
+	racecar, _ := store.Get(context.Background(), "racecar")
+
+	// Two IDs sharing the prefix "abcd" to exercise ambiguity
+	for _, id := range []string{"abcd01", "abcd02"} {
+		_ = store.Create(context.Background(), &handlers.StringResource{ID: id, Value: "value-" + id})
+	}
+
+	get := func(path string) *http.Response {
+		resp, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("200 OK - full ID and short prefixes", func(t *testing.T) {
+		for _, id := range []string{racecar.ID, racecar.ID[:7], strings.ToUpper(racecar.ID[:8])} {
+			resp := get("/strings/id/" + id)
+			var resource handlers.StringResource
+			_ = json.NewDecoder(resp.Body).Decode(&resource)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resource.Value != "racecar" {
+				t.Errorf("%s: expected racecar, got status %d value %q", id, resp.StatusCode, resource.Value)
+			}
+		}
+	})
+
+	t.Run("409 Conflict - ambiguous prefix", func(t *testing.T) {
+		resp := get("/strings/id/abcd")
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, resp.StatusCode)
+		}
+		if resp := get("/strings/id/abcd01"); resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected longer prefix to resolve, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("400 Bad Request - invalid ID", func(t *testing.T) {
+		for _, id := range []string{"abc", "xyz123", strings.Repeat("a", 65)} {
+			if resp := get("/strings/id/" + id); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", id, http.StatusBadRequest, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("404 Not Found", func(t *testing.T) {
+		if resp := get("/strings/id/ffff0000"); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("204 No Content - delete by prefix", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/strings/id/"+racecar.ID[:10], nil)
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+		}
+		if exists, _ := store.Exists(context.Background(), "racecar"); exists {
+			t.Error("Expected racecar to be deleted")
+		}
+
+		req, _ = http.NewRequest(http.MethodDelete, server.URL+"/strings/id/abcd", nil)
+		resp, _ = server.Client().Do(req)
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected ambiguous delete to be refused with %d, got %d", http.StatusConflict, resp.StatusCode)
+		}
+	})
+}
+
+func TestLookupByBody(t *testing.T) {
+	server, store := setupTestServer()
+	defer server.Close()
+	long := strings.Repeat("abc", 10000)
+	seedStore(store, "list", "lookup", "a/b/c", "100%", "what?", "list/x", long)
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	valueOf := func(resp *http.Response) string {
+		var resource handlers.StringResource
+		_ = json.NewDecoder(resp.Body).Decode(&resource)
+		return resource.Value
+	}
+
+	t.Run("200 OK - lookup by body", func(t *testing.T) {
+		for _, value := range []string{"list", "lookup", "a/b/c", "100%", long} {
+			body, _ := json.Marshal(handlers.StringLookupRequest{Value: value})
+			resp := do(http.MethodPost, "/strings/lookup", string(body))
+			if resp.StatusCode != http.StatusOK || valueOf(resp) != value {
+				t.Errorf("%.20q: expected 200 with the value, got %d", value, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("escaped paths decode exactly once", func(t *testing.T) {
+		for path, want := range map[string]string{
+			"/strings/a%2Fb%2Fc": "a/b/c",
+			"/strings/100%25":    "100%",
+			"/strings/what%3F":   "what?",
+			"/strings/list%2Fx":  "list/x",
+		} {
+			resp := do(http.MethodGet, path, "")
+			if got := valueOf(resp); resp.StatusCode != http.StatusOK || got != want {
+				t.Errorf("%s: expected %q, got status %d value %q", path, want, resp.StatusCode, got)
+			}
+		}
+	})
+
+	t.Run("reserved names address endpoints", func(t *testing.T) {
+		resp := do(http.MethodGet, "/strings/list", "")
+		var list handlers.ListResponse
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || list.Count != 7 {
+			t.Errorf("Expected /strings/list to list all 7 strings, got %+v (%v)", list, err)
+		}
+		for _, path := range []string{"/strings/list/x", "/strings/lookup/x", "/strings/filter-by-natural-language/x"} {
+			if resp := do(http.MethodGet, path, ""); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, resp.StatusCode)
+			}
+		}
+		if resp := do(http.MethodGet, "/strings/lookup", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected GET /strings/lookup to be %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+		}
+	})
+
+	t.Run("204 No Content - delete by body", func(t *testing.T) {
+		if resp := do(http.MethodPost, "/strings/delete", `{"value": "list"}`); resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+		}
+		if resp := do(http.MethodPost, "/strings/lookup", `{"value": "list"}`); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected deleted value to be %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+		if resp := do(http.MethodPost, "/strings/delete", `{"value": "list"}`); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected second delete to be %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("400 Bad Request - invalid body", func(t *testing.T) {
+		for _, body := range []string{`{}`, `not json`} {
+			if resp := do(http.MethodPost, "/strings/lookup", body); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, resp.StatusCode)
+			}
+		}
+	})
+}
@@ -1,22 +1,40 @@
 package handlers
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	// "fmt" // <-- Replaced with slog
 	"log/slog" // <-- ADDED: Proper structured logging
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/kodevoid/string_analyzer/internals/nlquery"
 )
 
 // Models
 type StringCreateRequest struct {
 	Value string `json:"value"`
+	// TTL (a Go duration such as "24h") or ExpiresAt optionally limits how
+	// long the string is kept; at most one may be set.
+	TTL       string     `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Tags and Metadata are free-form user annotations (see AnnotationStore).
+	Tags     []string       `json:"tags,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// StringLookupRequest is the body of POST /strings/lookup and
+// POST /strings/delete.
+type StringLookupRequest struct {
+	Value string `json:"value"`
 }
 
 type Properties struct {
@@ -33,12 +51,48 @@ type StringResource struct {
 	Value      string     `json:"value"`
 	Properties Properties `json:"properties"`
 	CreatedAt  time.Time  `json:"created_at"`
+	// AnalyzerVersion is the ComputeProperties version that produced
+	// Properties; rows below AnalyzerVersion are re-analyzed in the background.
+	AnalyzerVersion int `json:"analyzer_version"`
+	// DeletedAt is set while the resource is in the trash (see TrashStore).
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ExpiresAt, if set, is when the resource stops being visible; the
+	// Reaper deletes it some time after that.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Tags are sorted and unique; Metadata is any JSON object.
+	Tags     []string       `json:"tags,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Expired reports whether sr has expired at now. Stores treat expired
+// resources as absent even before they are deleted.
+func Expired(sr *StringResource, now time.Time) bool {
+	return sr.ExpiresAt != nil && !sr.ExpiresAt.After(now)
+}
+
+// nowKey is the context key of the time set by WithNow.
+type nowKey struct{}
+
+// WithNow returns a context whose store calls take now as the current time,
+// e.g. to decide which resources have expired.
+func WithNow(ctx context.Context, now time.Time) context.Context {
+	return context.WithValue(ctx, nowKey{}, now)
+}
+
+// NowFrom returns the time set by WithNow, or the wall clock.
+func NowFrom(ctx context.Context) time.Time {
+	if now, ok := ctx.Value(nowKey{}).(time.Time); ok {
+		return now
+	}
+	return time.Now()
 }
 
 type ErrorResponse struct {
 	Status  int    `json:"status"`
 	Error   string `json:"error"`
 	Message string `json:"message"`
+	// ID of the existing resource, set on 409 responses from POST /strings.
+	ID string `json:"id,omitempty"`
 }
 
 type ListResponse struct {
@@ -55,26 +109,153 @@ type NaturalLanguageResponse struct {
 
 type InterpretedQuery struct {
 	Original      string         `json:"original"`
+	Language      string         `json:"language"`
 	ParsedFilters map[string]any `json:"parsed_filters"`
+	// Corrections lists typos that were matched to known keywords, so
+	// clients can show "did you mean" hints.
+	Corrections []nlquery.Correction `json:"corrections,omitempty"`
+	// Source is the extractor that produced the filters: rules, model or merged.
+	Source    string             `json:"source,omitempty"`
+	Conflicts []nlquery.Conflict `json:"conflicts,omitempty"`
+	Warnings  []string           `json:"warnings,omitempty"`
+}
+
+// ExplainResponse is returned by the natural language explain endpoint.
+type ExplainResponse struct {
+	InterpretedQuery InterpretedQuery `json:"interpreted_query"`
+	// ParseTree lists the rules that fired, in query order, with the spans
+	// and terms they consumed and the filters they produced.
+	ParseTree []nlquery.Clause `json:"parse_tree"`
+	// MatchedSpans lists every recognised word or phrase with its character
+	// offsets in the original query, whether or not a rule used it.
+	MatchedSpans []nlquery.Term `json:"matched_spans"`
+	// Unmatched lists the words the parser ignored.
+	Unmatched []nlquery.Term `json:"unmatched"`
+	// QueryPlan is nil when the store cannot explain its queries.
+	QueryPlan *QueryPlan `json:"query_plan"`
 }
 
-// Storage interface - implement with your choice of DB
+// QueryPlan describes how a store would run a List call, without running
+// it. It has no row count: computing one means running the query.
+type QueryPlan struct {
+	SQL      string   `json:"sql"`
+	CountSQL string   `json:"count_sql"`
+	Args     []any    `json:"args"`
+	Plan     []string `json:"plan,omitempty"`
+}
+
+// Sentinel errors returned (possibly wrapped) by StringStore implementations.
+// Handlers map them to status codes with errors.Is.
+var (
+	// ErrNotFound: no string with the requested value exists (404).
+	ErrNotFound = errors.New("string not found")
+	// ErrConflict: the value is already stored, e.g. a concurrent Create won (409).
+	ErrConflict = errors.New("string already exists")
+	// ErrUnavailable: the backend is temporarily unable to serve, e.g. the
+	// database is locked or closed (503).
+	ErrUnavailable = errors.New("store unavailable")
+	// ErrAmbiguous: an ID prefix matches more than one string (409).
+	ErrAmbiguous = errors.New("ambiguous id prefix")
+	// ErrQuotaExceeded: the namespace already holds its maximum number of
+	// strings (403).
+	ErrQuotaExceeded = errors.New("namespace quota exceeded")
+	// ErrNotSupported: the store, or a store it wraps, lacks an optional
+	// feature (501).
+	ErrNotSupported = errors.New("not supported by the store")
+	// ErrInvalid: the change is not allowed, e.g. merged metadata would
+	// exceed its size limit (400). The error's message is shown to clients.
+	ErrInvalid = errors.New("invalid input")
+)
+
+// invalidError is an ErrInvalid with a message for the response.
+type invalidError string
+
+func (e invalidError) Error() string        { return string(e) }
+func (e invalidError) Is(target error) bool { return target == ErrInvalid }
+
+// MinIDPrefix is the shortest ID prefix accepted by /strings/id/{id}, as
+// with git's short hashes.
+const MinIDPrefix = 4
+
+// Storage interface - implement with your choice of DB.
+// Every method takes the request context; implementations should stop work
+// and return ctx.Err() (possibly wrapped) once it is cancelled or expires.
 type StringStore interface {
-	Create(sr *StringResource) error
-	Get(value string) (*StringResource, error)
-	Delete(value string) error
-	List(filters map[string]any, limit, offset int) ([]StringResource, int, error)
-	Exists(value string) bool
+	Create(ctx context.Context, sr *StringResource) error
+	Get(ctx context.Context, value string) (*StringResource, error)
+	Delete(ctx context.Context, value string) error
+	List(ctx context.Context, filters map[string]any, limit, offset int) ([]StringResource, int, error)
+	Exists(ctx context.Context, value string) (bool, error)
+	// CreateIfAbsent atomically stores sr unless its value already exists.
+	// It returns the stored resource, which is the existing one when
+	// created is false.
+	CreateIfAbsent(ctx context.Context, sr *StringResource) (stored *StringResource, created bool, err error)
+	// GetByID looks a resource up by its full ID or by a lowercase hex
+	// prefix of it; a prefix matching several IDs yields ErrAmbiguous.
+	GetByID(ctx context.Context, id string) (*StringResource, error)
+	// DeleteByID removes the resource with exactly this (full) ID.
+	DeleteByID(ctx context.Context, id string) error
+}
+
+// QueryExplainer is optionally implemented by stores that can describe a List
+// call (generated query, parameters, row estimate) without fetching data.
+type QueryExplainer interface {
+	ExplainList(ctx context.Context, filters map[string]any, limit, offset int) (*QueryPlan, error)
 }
 
 type Handler struct {
-	store StringStore
+	store        StringStore
+	now          func() time.Time
+	extractor    nlquery.Extractor
+	storeTimeout time.Duration
+	reanalysis   *Reanalysis
+}
+
+// DefaultStoreTimeout bounds every store call made while serving a request.
+const DefaultStoreTimeout = 5 * time.Second
+
+// Option configures optional Handler behaviour.
+type Option func(*Handler)
+
+// WithClock overrides the clock used for created_at and expires_at
+// timestamps, for deciding what has expired (see WithNow) and for resolving
+// relative time phrases ("today", "last 3 hours") in natural language
+// queries. Mainly useful for deterministic tests.
+func WithClock(now func() time.Time) Option {
+	return func(h *Handler) {
+		h.now = now
+	}
 }
 
-func NewHandler(store StringStore) *Handler {
-	return &Handler{store: store}
+// WithExtractor replaces the rule-based parser used by the natural language
+// endpoints, e.g. with an nlquery.Combined backed by a model server.
+func WithExtractor(e nlquery.Extractor) Option {
+	return func(h *Handler) {
+		h.extractor = e
+	}
 }
 
+// WithStoreTimeout sets the deadline applied to store calls for each request.
+// Zero disables it, leaving only client cancellation.
+func WithStoreTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.storeTimeout = d
+	}
+}
+
+func NewHandler(store StringStore, opts ...Option) *Handler {
+	h := &Handler{store: store, now: time.Now, extractor: nlquery.RuleExtractor{}, storeTimeout: DefaultStoreTimeout}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// AnalyzerVersion identifies the current ComputeProperties logic. Bump it
+// whenever the computed properties change so that stored rows are
+// re-analyzed (see Reanalysis).
+const AnalyzerVersion = 1
+
 // Helper functions
 func ComputeProperties(value string) Properties {
 	hash := sha256.Sum256([]byte(value))
@@ -155,6 +336,63 @@ func writeError(w http.ResponseWriter, status int, errorType, message string) {
 	})
 }
 
+// storeContext derives the context for store calls from the request, so a
+// disconnected client cancels them, and applies the store timeout. The
+// request's ActorHeader goes along for stores that keep an audit trail, and
+// the handler's clock (see WithNow) for expiry.
+func (h *Handler) storeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := WithNow(WithActor(r.Context(), requestActor(r)), h.now())
+	if h.storeTimeout > 0 {
+		return context.WithTimeout(ctx, h.storeTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// writeContextError reports store errors caused by the request context:
+// 504 when the store deadline expired and 503 when the request was cancelled.
+// It returns false if err is unrelated to the context.
+func writeContextError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "Gateway Timeout", "Store deadline exceeded")
+		return true
+	case errors.Is(err, context.Canceled):
+		writeError(w, http.StatusServiceUnavailable, "Service Unavailable", "Request cancelled before the store responded")
+		return true
+	}
+	return false
+}
+
+// writeStoreError maps a store error to a status code: the sentinel errors
+// above, context deadline/cancellation, and 500 for anything else. 503 and
+// 500 responses get a fixed message, since the error may carry driver or
+// SQL details; the error itself is only logged.
+func writeStoreError(w http.ResponseWriter, err error) {
+	if writeContextError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, "Not Found", "String not found")
+	case errors.Is(err, ErrConflict):
+		writeError(w, http.StatusConflict, "Conflict", "String already exists")
+	case errors.Is(err, ErrAmbiguous):
+		writeError(w, http.StatusConflict, "Conflict", "ID prefix matches more than one string")
+	case errors.Is(err, ErrUnavailable):
+		slog.Error("store unavailable", "error", err)
+		writeError(w, http.StatusServiceUnavailable, "Service Unavailable", "The store is temporarily unavailable; try again later")
+	case errors.Is(err, ErrQuotaExceeded):
+		writeError(w, http.StatusForbidden, "Forbidden", err.Error())
+	case errors.Is(err, ErrNotSupported):
+		writeError(w, http.StatusNotImplemented, "Not Implemented", err.Error())
+	case errors.Is(err, ErrInvalid):
+		writeError(w, http.StatusBadRequest, "Bad Request", err.Error())
+	default:
+		slog.Error("store error", "error", err)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error", "The store failed to complete the request")
+	}
+}
+
 // POST /strings
 func (h *Handler) CreateString(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -173,22 +411,66 @@ func (h *Handler) CreateString(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if already exists
-	if h.store.Exists(req.Value) {
-		writeError(w, http.StatusConflict, "Conflict", "String already exists")
+	now := h.now().UTC()
+	expiresAt, status, msg := parseExpiry(&req, now)
+	if msg != "" {
+		writeError(w, status, http.StatusText(status), msg)
+		return
+	}
+	store := h.storeFor(r)
+	if _, ok := store.(RetentionStore); expiresAt != nil && !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not support expiry")
+		return
+	}
+	tags, msg := normalizeTags(req.Tags)
+	if msg == "" {
+		msg = checkMetadata(req.Metadata)
+	}
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
 		return
 	}
+	if _, ok := store.(AnnotationStore); (tags != nil || len(req.Metadata) > 0) && !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not support tags or metadata")
+		return
+	}
+	metadata := req.Metadata
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
 
 	props := ComputeProperties(req.Value)
 	resource := &StringResource{
-		ID:         props.SHA256Hash,
-		Value:      req.Value,
-		Properties: props,
-		CreatedAt:  time.Now().UTC(),
+		ID:              props.SHA256Hash,
+		Value:           req.Value,
+		Properties:      props,
+		CreatedAt:       now,
+		AnalyzerVersion: AnalyzerVersion,
+		ExpiresAt:       expiresAt,
+		Tags:            tags,
+		Metadata:        metadata,
 	}
 
-	if err := h.store.Create(resource); err != nil {
-		writeError(w, http.StatusInternalServerError, "Internal Server Error", err.Error())
+	// Check-and-insert in one store call so concurrent posts cannot race
+	stored, created, err := store.CreateIfAbsent(ctx, resource)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !created {
+		msg := "String already exists"
+		if stored.DeletedAt != nil {
+			msg = "String is in the trash; restore it with POST /strings/{string_value}/restore"
+		}
+		writeJSON(w, http.StatusConflict, ErrorResponse{
+			Status:  http.StatusConflict,
+			Error:   "Conflict",
+			Message: msg,
+			ID:      stored.ID,
+		})
 		return
 	}
 
@@ -206,15 +488,13 @@ func (h *Handler) GetString(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := strings.TrimPrefix(r.URL.Path, "/strings/")
-	if path == "" || path == r.URL.Path {
-		writeError(w, http.StatusBadRequest, "Bad Request", "Missing string value in path")
+	stringValue, ok := valueFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	stringValue, err := url.PathUnescape(path)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid URL encoding")
+	includeDeleted, ok := parseIncludeDeleted(w, r)
+	if !ok {
 		return
 	}
 
@@ -222,9 +502,15 @@ func (h *Handler) GetString(w http.ResponseWriter, r *http.Request) {
 	slog.Info("getting string", "value", stringValue)
 	// --- END ADDED ---
 
-	resource, err := h.store.Get(stringValue)
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	resource, err := h.storeFor(r).Get(ctx, stringValue)
+	if err == nil && resource.DeletedAt != nil && !includeDeleted {
+		err = ErrNotFound
+	}
 	if err != nil {
-		writeError(w, http.StatusNotFound, "Not Found", "String not found")
+		writeStoreError(w, err)
 		return
 	}
 
@@ -238,21 +524,16 @@ func (h *Handler) DeleteString(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := strings.TrimPrefix(r.URL.Path, "/strings/")
-	if path == "" || path == r.URL.Path {
-		writeError(w, http.StatusBadRequest, "Bad Request", "Missing string value in path")
+	stringValue, ok := valueFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	stringValue, err := url.PathUnescape(path)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid URL encoding")
-		return
-	}
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
 
-	err = h.store.Delete(stringValue)
-	if err != nil {
-		writeError(w, http.StatusNotFound, "Not Found", "String not found")
+	if err := h.delete(ctx, h.storeFor(r), stringValue); err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
@@ -271,14 +552,77 @@ func (h *Handler) ListStrings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	query := r.URL.Query()
+	filters, msg := parseFilters(query)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
+		return
+	}
+
+	limit, offset, msg := parsePage(query)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
+		return
+	}
+
+	// --- ADDED LOGGING ---
+	// Log the filters, but only if there are any
+	if len(filters) > 0 {
+		slog.Info("listing strings with filters", "filters", filters, "limit", limit, "offset", offset)
+	} else {
+		slog.Info("listing all strings", "limit", limit, "offset", offset)
+	}
+	// --- END ADDED ---
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	data, count, err := h.storeFor(r).List(ctx, filters, limit, offset)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	response := ListResponse{
+		Data:           data,
+		Count:          count,
+		FiltersApplied: filters,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// parsePage reads the limit (default 25, max 100) and offset (default 0)
+// parameters. On invalid input it returns a message for a 400 response.
+func parsePage(query url.Values) (limit, offset int, msg string) {
+	limit = 25
+	if val := query.Get("limit"); val != "" {
+		l, err := strconv.Atoi(val)
+		if err != nil || l < 1 || l > 100 {
+			return 0, 0, "Invalid limit value (1-100)"
+		}
+		limit = l
+	}
+
+	if val := query.Get("offset"); val != "" {
+		o, err := strconv.Atoi(val)
+		if err != nil || o < 0 {
+			return 0, 0, "Invalid offset value"
+		}
+		offset = o
+	}
+	return limit, offset, ""
+}
+
+// parseFilters reads the /strings/list filter parameters. On invalid input
+// it returns a message for a 400 response.
+func parseFilters(query url.Values) (map[string]any, string) {
 	filters := make(map[string]any)
 
 	// Parse is_palindrome
 	if val := query.Get("is_palindrome"); val != "" {
 		isPalin, err := strconv.ParseBool(val)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid is_palindrome value")
-			return
+			return nil, "Invalid is_palindrome value"
 		}
 		filters["is_palindrome"] = isPalin
 	}
@@ -287,8 +631,7 @@ func (h *Handler) ListStrings(w http.ResponseWriter, r *http.Request) {
 	if val := query.Get("min_length"); val != "" {
 		minLen, err := strconv.Atoi(val)
 		if err != nil || minLen < 0 {
-			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid min_length value")
-			return
+			return nil, "Invalid min_length value"
 		}
 		filters["min_length"] = minLen
 	}
@@ -297,8 +640,7 @@ func (h *Handler) ListStrings(w http.ResponseWriter, r *http.Request) {
 	if val := query.Get("max_length"); val != "" {
 		maxLen, err := strconv.Atoi(val)
 		if err != nil || maxLen < 0 {
-			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid max_length value")
-			return
+			return nil, "Invalid max_length value"
 		}
 		filters["max_length"] = maxLen
 	}
@@ -307,8 +649,7 @@ func (h *Handler) ListStrings(w http.ResponseWriter, r *http.Request) {
 	if val := query.Get("word_count"); val != "" {
 		wordCount, err := strconv.Atoi(val)
 		if err != nil || wordCount < 0 {
-			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid word_count value")
-			return
+			return nil, "Invalid word_count value"
 		}
 		filters["word_count"] = wordCount
 	}
@@ -316,177 +657,418 @@ func (h *Handler) ListStrings(w http.ResponseWriter, r *http.Request) {
 	// Parse contains_character
 	if val := query.Get("contains_character"); val != "" {
 		if len([]rune(val)) != 1 {
-			writeError(w, http.StatusBadRequest, "Bad Request", "contains_character must be exactly one character")
-			return
+			return nil, "contains_character must be exactly one character"
 		}
 		filters["contains_character"] = val
 	}
 
-	// Parse limit (default 25, max 100)
-	limit := 25
-	if val := query.Get("limit"); val != "" {
-		l, err := strconv.Atoi(val)
-		if err != nil || l < 1 || l > 100 {
-			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid limit value (1-100)")
-			return
+	// Parse created_after / created_before (RFC3339)
+	if val := query.Get("created_after"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return nil, "Invalid created_after value (expected RFC3339)"
 		}
-		limit = l
+		filters["created_after"] = t
+	}
+	if val := query.Get("created_before"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return nil, "Invalid created_before value (expected RFC3339)"
+		}
+		filters["created_before"] = t
 	}
 
-	// Parse offset (default 0)
-	offset := 0
-	if val := query.Get("offset"); val != "" {
-		o, err := strconv.Atoi(val)
-		if err != nil || o < 0 {
-			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid offset value")
-			return
+	// Parse tag and meta.<key> (see AnnotationStore)
+	if query.Has("tag") {
+		tag := strings.TrimSpace(query.Get("tag"))
+		if tag == "" {
+			return nil, "Tags must not be empty"
+		}
+		filters["tag"] = tag
+	}
+	for key, vals := range query {
+		if name, ok := strings.CutPrefix(key, "meta."); ok {
+			if name == "" {
+				return nil, "Invalid metadata filter: missing key after meta."
+			}
+			filters[key] = vals[0]
 		}
-		offset = o
 	}
 
-	// --- ADDED LOGGING ---
-	// Log the filters, but only if there are any
-	if len(filters) > 0 {
-		slog.Info("listing strings with filters", "filters", filters, "limit", limit, "offset", offset)
-	} else {
-		slog.Info("listing all strings", "limit", limit, "offset", offset)
+	// Trashed strings are only listed on request
+	if val := query.Get("include_deleted"); val != "" {
+		include, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, "Invalid include_deleted value"
+		}
+		if include {
+			filters["include_deleted"] = true
+		}
+	}
+
+	return filters, ""
+}
+
+// MatchesFilters reports whether sr satisfies every filter produced by
+// parseFilters. It is the reference semantics for stores that filter in Go
+// rather than in a query language.
+//
+// Trashed resources never match unless filters hold include_deleted=true,
+// and deleted=true matches only trashed ones (see TrashStore). Expired
+// resources (at now) never match. A meta.<key> filter matches when the top-level
+// metadata key holds a value whose MetaText equals the filter.
+func MatchesFilters(sr *StringResource, filters map[string]any, now time.Time) bool {
+	if sr.DeletedAt != nil && filters["include_deleted"] != true && filters["deleted"] != true {
+		return false
+	}
+	if Expired(sr, now) {
+		return false
+	}
+	for key, val := range filters {
+		switch key {
+		case "deleted":
+			if (sr.DeletedAt != nil) != val.(bool) {
+				return false
+			}
+		case "is_palindrome":
+			if sr.Properties.IsPalindrome != val.(bool) {
+				return false
+			}
+		case "min_length":
+			if sr.Properties.Length < val.(int) {
+				return false
+			}
+		case "max_length":
+			if sr.Properties.Length > val.(int) {
+				return false
+			}
+		case "word_count":
+			if sr.Properties.WordCount != val.(int) {
+				return false
+			}
+		case "contains_character":
+			if _, ok := sr.Properties.CharacterFrequencyMap[val.(string)]; !ok {
+				return false
+			}
+		case "created_after":
+			if sr.CreatedAt.Before(val.(time.Time)) {
+				return false
+			}
+		case "created_before":
+			if !sr.CreatedAt.Before(val.(time.Time)) {
+				return false
+			}
+		case "tag":
+			if !slices.Contains(sr.Tags, val.(string)) {
+				return false
+			}
+		default:
+			if name, ok := strings.CutPrefix(key, "meta."); ok {
+				v, present := sr.Metadata[name]
+				if !present || MetaText(v) != val.(string) {
+					return false
+				}
+			}
+		}
 	}
+	return true
+}
+
+// GET /strings/filter-by-natural-language
+func (h *Handler) FilterByNaturalLanguage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
+		return
+	}
+
+	query, parsed, ok := h.parseNaturalLanguage(w, r)
+	if !ok {
+		return
+	}
+	filters := parsed.Filters
+
+	// --- ADDED LOGGING ---
+	slog.Info("parsed natural language query", "original_query", query, "language", parsed.Language, "source", parsed.Source, "parsed_filters", filters, "corrections", parsed.Corrections, "conflicts", parsed.Conflicts)
 	// --- END ADDED ---
 
-	data, count, err := h.store.List(filters, limit, offset)
+	// Use default pagination
+	limit := 25
+	offset := 0
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	data, count, err := h.storeFor(r).List(ctx, filters, limit, offset)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Internal Server Error", err.Error())
+		writeStoreError(w, err)
 		return
 	}
 
-	response := ListResponse{
-		Data:           data,
-		Count:          count,
-		FiltersApplied: filters,
+	response := NaturalLanguageResponse{
+		Data:             data,
+		Count:            count,
+		InterpretedQuery: interpretedQuery(query, parsed),
 	}
 
 	writeJSON(w, http.StatusOK, response)
 }
 
-// GET /strings/filter-by-natural-language
-func (h *Handler) FilterByNaturalLanguage(w http.ResponseWriter, r *http.Request) {
+// GET /strings/filter-by-natural-language/explain
+func (h *Handler) ExplainNaturalLanguage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
 		return
 	}
 
+	query, parsed, ok := h.parseNaturalLanguage(w, r)
+	if !ok {
+		return
+	}
+
+	response := ExplainResponse{
+		InterpretedQuery: interpretedQuery(query, parsed),
+		ParseTree:        parsed.Clauses,
+		MatchedSpans:     parsed.Terms,
+		Unmatched:        parsed.Unmatched,
+	}
+
+	if explainer, ok := h.storeFor(r).(QueryExplainer); ok {
+		ctx, cancel := h.storeContext(r)
+		defer cancel()
+
+		// Same default pagination as FilterByNaturalLanguage
+		plan, err := explainer.ExplainList(ctx, parsed.Filters, 25, 0)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		response.QueryPlan = plan
+	}
+
+	slog.Info("explained natural language query", "original_query", query, "language", parsed.Language, "parsed_filters", parsed.Filters)
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// parseNaturalLanguage reads the query and language from the request and
+// parses it. On failure it writes the error response and returns ok=false.
+func (h *Handler) parseNaturalLanguage(w http.ResponseWriter, r *http.Request) (string, *nlquery.Result, bool) {
 	query := r.URL.Query().Get("query")
 	if query == "" {
 		writeError(w, http.StatusBadRequest, "Bad Request", "Missing required query parameter: query")
-		return
+		return "", nil, false
 	}
 
-	// Parse natural language query into filters
-	filters, err := parseNaturalLanguageQuery(query)
+	// Pick the grammar: explicit ?lang= wins, then Accept-Language, then English
+	var lang *nlquery.Language
+	if code := r.URL.Query().Get("lang"); code != "" {
+		l, ok := nlquery.Lookup(code)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Bad Request",
+				"Unsupported lang value (supported: "+strings.Join(nlquery.Languages(), ", ")+")")
+			return "", nil, false
+		}
+		lang = l
+	} else {
+		lang = nlquery.Negotiate(r.Header.Get("Accept-Language"))
+	}
+
+	parsed, err := h.extractor.Extract(r.Context(), nlquery.Request{Query: query, Language: lang, Now: h.now()})
 	if err != nil {
+		if errors.Is(err, nlquery.ErrBackend) {
+			writeError(w, http.StatusBadGateway, "Bad Gateway", "Intent extractor failed: "+err.Error())
+			return "", nil, false
+		}
 		writeError(w, http.StatusBadRequest, "Bad Request", "Unable to parse query: "+err.Error())
+		return "", nil, false
+	}
+	return query, parsed, true
+}
+
+func interpretedQuery(query string, parsed *nlquery.Result) InterpretedQuery {
+	return InterpretedQuery{
+		Original:      query,
+		Language:      parsed.Language,
+		ParsedFilters: parsed.Filters,
+		Corrections:   parsed.Corrections,
+		Source:        parsed.Source,
+		Conflicts:     parsed.Conflicts,
+		Warnings:      parsed.Warnings,
+	}
+}
+
+// valueFromPath extracts {string_value} from /strings/{string_value}. It
+// decodes the escaped path exactly once, so "%2F", "%3F" and "%25" in the
+// URL stand for a literal "/", "?" and "%" in the value.
+func valueFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/strings/")
+	if path == "" || path == r.URL.EscapedPath() {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Missing string value in path")
+		return "", false
+	}
+	value, err := url.PathUnescape(path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid URL encoding")
+		return "", false
+	}
+	return value, true
+}
+
+// POST /strings/lookup
+// Same as GET /strings/{string_value}, with the value in the JSON body so
+// that any string can be fetched regardless of length or characters.
+func (h *Handler) LookupString(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is allowed")
 		return
 	}
 
-	// --- ADDED LOGGING ---
-	slog.Info("parsed natural language query", "original_query", query, "parsed_filters", filters)
-	// --- END ADDED ---
+	includeDeleted, ok := parseIncludeDeleted(w, r)
+	if !ok {
+		return
+	}
+	value, ok := decodeLookupRequest(w, r)
+	if !ok {
+		return
+	}
 
-	// Use default pagination
-	limit := 25
-	offset := 0
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
 
-	data, count, err := h.store.List(filters, limit, offset)
+	resource, err := h.storeFor(r).Get(ctx, value)
+	if err == nil && resource.DeletedAt != nil && !includeDeleted {
+		err = ErrNotFound
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Internal Server Error", err.Error())
+		writeStoreError(w, err)
 		return
 	}
 
-	response := NaturalLanguageResponse{
-		Data:  data,
-		Count: count,
-		InterpretedQuery: InterpretedQuery{
-			Original:      query,
-			ParsedFilters: filters,
-		},
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// POST /strings/delete
+// Same as DELETE /strings/{string_value}, with the value in the JSON body.
+func (h *Handler) DeleteStringByValue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is allowed")
+		return
 	}
 
-	writeJSON(w, http.StatusOK, response)
+	value, ok := decodeLookupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	if err := h.delete(ctx, h.storeFor(r), value); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	slog.Info("string deleted", "value", value)
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// Simple natural language parser
-func parseNaturalLanguageQuery(query string) (map[string]any, error) {
-	filters := make(map[string]any)
-	lower := strings.ToLower(query)
-	words := strings.Fields(lower) // Get words for easier parsing
-
-	// Check for palindrome
-	// Use "palindrom" to catch "palindrome" and "palindromic"
-	if strings.Contains(lower, "palindrom") {
-		filters["is_palindrome"] = true
-	}
-
-	// Check for word count patterns
-	for i, word := range words {
-		if (word == "word" || word == "words") && i > 0 {
-			if count, err := strconv.Atoi(words[i-1]); err == nil {
-				// Handles: "5 words"
-				filters["word_count"] = count
-				break
-			} else if words[i-1] == "single" {
-				// Handles: "single word"
-				filters["word_count"] = 1
-				break
-			}
-		}
+func decodeLookupRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req StringLookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid JSON: "+err.Error())
+		return "", false
+	}
+	if req.Value == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Missing required field: value")
+		return "", false
 	}
+	return req.Value, true
+}
 
-	// Check for length patterns: "longer than 10", "length > 20", "shorter than 5"
-	for i, word := range words {
-		if word == "than" && i > 0 && i < len(words)-1 {
-			if length, err := strconv.Atoi(words[i+1]); err == nil {
-				if words[i-1] == "longer" {
-					filters["min_length"] = length + 1
-				} else if words[i-1] == "shorter" {
-					filters["max_length"] = length - 1
-				}
-			}
-		}
+// GET /strings/id/{id}
+func (h *Handler) GetStringByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
+		return
+	}
+
+	id, ok := parseIDPath(w, r)
+	if !ok {
+		return
+	}
+	includeDeleted, ok := parseIncludeDeleted(w, r)
+	if !ok {
+		return
 	}
 
-	// Check for "contains X" or "containing X" pattern
-	containsIndex := strings.Index(lower, "containing")
-	searchWord := "containing"
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
 
-	if containsIndex == -1 {
-		containsIndex = strings.Index(lower, "contains")
-		searchWord = "contains"
+	resource, err := h.storeFor(r).GetByID(ctx, id)
+	if err == nil && resource.DeletedAt != nil && !includeDeleted {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
 
-	if containsIndex != -1 {
-		// Get the part of the string *after* the search word
-		// e.g., from "strings containing the letter z", we get " the letter z"
-		remainingStr := lower[containsIndex+len(searchWord):]
+	writeJSON(w, http.StatusOK, resource)
+}
 
-		// Heuristic 1: Find "letter X"
-		// e.g., "... containing the letter z"
-		letterIndex := strings.Index(remainingStr, "letter ")
-		if letterIndex != -1 {
-			// "letter " is 7 chars. Get char after it.
-			charAfter := strings.TrimSpace(remainingStr[letterIndex+len("letter "):])
-			if len(charAfter) > 0 {
-				filters["contains_character"] = string([]rune(charAfter)[0])
-			}
-		} else {
-			// Heuristic 2: Find the last word of the *whole query* and check if 1 char
-			// e.g., "... contains z"
-			lastWord := words[len(words)-1]
-			if len([]rune(lastWord)) == 1 {
-				filters["contains_character"] = lastWord
-			}
-		}
-		// You could add more heuristics here, like for "contains 'a'"
+// DELETE /strings/id/{id}
+func (h *Handler) DeleteStringByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only DELETE is allowed")
+		return
 	}
 
-	return filters, nil
+	id, ok := parseIDPath(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	// Resolve a short prefix first so only an unambiguous match is deleted
+	store := h.storeFor(r)
+	resource, err := store.GetByID(ctx, id)
+	if err == nil && resource.DeletedAt != nil {
+		err = ErrNotFound
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if trash, ok := store.(TrashStore); ok {
+		err = trash.Trash(ctx, resource.Value, h.now().UTC())
+	} else {
+		err = store.DeleteByID(ctx, resource.ID)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	slog.Info("string deleted", "id", resource.ID, "value", resource.Value)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseIDPath extracts the {id} of /strings/id/{id}: a full SHA-256 hex ID or
+// a prefix of at least MinIDPrefix characters, folded to lowercase.
+func parseIDPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/strings/id/"))
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Missing id in path")
+		return "", false
+	}
+	if len(id) < MinIDPrefix || len(id) > sha256.Size*2 || strings.Trim(id, "0123456789abcdef") != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request",
+			"id must be "+strconv.Itoa(MinIDPrefix)+" to "+strconv.Itoa(sha256.Size*2)+" hexadecimal characters")
+		return "", false
+	}
+	return id, true
 }
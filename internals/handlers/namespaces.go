@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// NamespaceStore is implemented by stores that hold several independent
+// namespaces (tenants). Each namespace has its own set of values, so the
+// same value can be stored in two namespaces with unrelated tags, expiry
+// and trash state. The store itself is the DefaultNamespace, which always
+// exists.
+type NamespaceStore interface {
+	// In returns a view of the store confined to the named namespace: every
+	// StringStore method, and every optional interface the store implements,
+	// only sees and changes that namespace. In(DefaultNamespace) is the
+	// store itself. Writes to a namespace that does not exist fail with
+	// ErrNotFound; writes that would exceed its quota fail with
+	// ErrQuotaExceeded.
+	In(name string) StringStore
+	// CreateNamespace adds an empty namespace, or returns ErrConflict if
+	// one with this name exists.
+	CreateNamespace(ctx context.Context, ns Namespace) error
+	// GetNamespace returns the namespace with its current Count, or
+	// ErrNotFound.
+	GetNamespace(ctx context.Context, name string) (*Namespace, error)
+	// ListNamespaces returns every namespace, DefaultNamespace included,
+	// ordered by name.
+	ListNamespaces(ctx context.Context) ([]Namespace, error)
+	// SetNamespaceQuota changes MaxStrings and returns the namespace, or
+	// returns ErrNotFound. Strings already stored beyond a lowered quota
+	// are kept.
+	SetNamespaceQuota(ctx context.Context, name string, maxStrings int) (*Namespace, error)
+	// DeleteNamespace removes a namespace and everything stored in it, or
+	// returns ErrNotFound. DefaultNamespace cannot be deleted.
+	DeleteNamespace(ctx context.Context, name string) error
+}
+
+// Namespace is one tenant of a NamespaceStore.
+type Namespace struct {
+	Name string `json:"name"`
+	// MaxStrings caps how many strings the namespace holds, trashed ones
+	// included; 0 means unlimited.
+	MaxStrings int       `json:"max_strings"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Count is the number of strings held, trashed included and expired
+	// excluded; it is what MaxStrings is checked against.
+	Count int `json:"count"`
+}
+
+type NamespacesResponse struct {
+	Data  []Namespace `json:"data"`
+	Count int         `json:"count"`
+}
+
+// NamespaceCreateRequest is the body of POST /admin/namespaces.
+type NamespaceCreateRequest struct {
+	Name       string `json:"name"`
+	MaxStrings int    `json:"max_strings"`
+}
+
+// NamespaceUpdateRequest is the body of PATCH /admin/namespaces/{name}.
+type NamespaceUpdateRequest struct {
+	MaxStrings *int `json:"max_strings"`
+}
+
+// DefaultNamespace holds the strings of requests that name no namespace.
+const DefaultNamespace = "default"
+
+// NamespaceHeader selects the namespace of a request, as an alternative to
+// the /ns/{name} path prefix.
+const NamespaceHeader = "X-Namespace"
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidNamespace reports whether name can be used as a namespace: 1 to 63
+// lowercase letters, digits, '_' or '-', starting with a letter or digit.
+func ValidNamespace(name string) bool {
+	return namespacePattern.MatchString(name)
+}
+
+// scopeKey is the context key of the namespace view chosen by scope.
+type scopeKey struct{}
+
+// storeFor returns the store that serves r: the view of the request's
+// namespace, or the store itself for the default namespace.
+func (h *Handler) storeFor(r *http.Request) StringStore {
+	if store, ok := r.Context().Value(scopeKey{}).(StringStore); ok {
+		return store
+	}
+	return h.store
+}
+
+// scopedPath reports whether path addresses strings and so belongs to a
+// namespace. Admin endpoints are global.
+func scopedPath(path string) bool {
+	return path == "/strings" || strings.HasPrefix(path, "/strings/") || path == "/tags" || path == "/events"
+}
+
+// scope selects the namespace of each request to a scoped path, from a
+// /ns/{name} prefix or the X-Namespace header, and passes its view on to
+// the handlers through the request context (see storeFor).
+func (h *Handler) scope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(NamespaceHeader)
+		rest, prefixed := strings.CutPrefix(r.URL.EscapedPath(), "/ns/")
+		if !prefixed {
+			if scopedPath(r.URL.Path) {
+				h.serveIn(w, r, name, next)
+			} else {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+
+		segment, _, _ := strings.Cut(rest, "/")
+		if !ValidNamespace(segment) {
+			// Checked before stripping: valid names never need escaping,
+			// so the prefix is the same in the raw and decoded paths.
+			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid namespace name")
+			return
+		}
+		if name != "" && name != segment {
+			writeError(w, http.StatusBadRequest, "Bad Request",
+				"The "+NamespaceHeader+" header and the /ns/ path prefix name different namespaces")
+			return
+		}
+		http.StripPrefix("/ns/"+segment, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !scopedPath(r.URL.Path) {
+				writeError(w, http.StatusNotFound, "Not Found", "Only /strings, /tags and /events are served under /ns/{name}")
+				return
+			}
+			h.serveIn(w, r, segment, next)
+		})).ServeHTTP(w, r)
+	})
+}
+
+// serveIn serves r from the view of namespace name.
+func (h *Handler) serveIn(w http.ResponseWriter, r *http.Request, name string, next http.Handler) {
+	if name == "" || name == DefaultNamespace {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if !ValidNamespace(name) {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid namespace name")
+		return
+	}
+	ns, ok := h.store.(NamespaceStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not support namespaces")
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	_, err := ns.GetNamespace(ctx, name)
+	cancel()
+	if err != nil {
+		writeNamespaceError(w, err)
+		return
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey{}, ns.In(name))))
+}
+
+// writeNamespaceError is writeStoreError with messages about namespaces
+// rather than strings.
+func writeNamespaceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, "Not Found", "Namespace not found")
+	case errors.Is(err, ErrConflict):
+		writeError(w, http.StatusConflict, "Conflict", "Namespace already exists")
+	default:
+		writeStoreError(w, err)
+	}
+}
+
+// namespaceStore returns the store's NamespaceStore, or writes a 501
+// response and returns ok=false.
+func (h *Handler) namespaceStore(w http.ResponseWriter) (NamespaceStore, bool) {
+	ns, ok := h.store.(NamespaceStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store does not support namespaces")
+	}
+	return ns, ok
+}
+
+// GET /admin/namespaces lists namespaces; POST creates one.
+func (h *Handler) HandleNamespaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET and POST are allowed for this path")
+		return
+	}
+	ns, ok := h.namespaceStore(w)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		ctx, cancel := h.storeContext(r)
+		defer cancel()
+		list, err := ns.ListNamespaces(ctx)
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, NamespacesResponse{Data: list, Count: len(list)})
+		return
+	}
+
+	var req NamespaceCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid JSON: "+err.Error())
+		return
+	}
+	if !ValidNamespace(req.Name) {
+		writeError(w, http.StatusBadRequest, "Bad Request",
+			"Invalid namespace name (1 to 63 lowercase letters, digits, '_' or '-', starting with a letter or digit)")
+		return
+	}
+	if req.MaxStrings < 0 {
+		writeError(w, http.StatusBadRequest, "Bad Request", "max_strings must not be negative")
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+	created := Namespace{Name: req.Name, MaxStrings: req.MaxStrings, CreatedAt: h.now().UTC()}
+	if err := ns.CreateNamespace(ctx, created); err != nil {
+		writeNamespaceError(w, err)
+		return
+	}
+
+	slog.Info("namespace created", "namespace", created.Name, "max_strings", created.MaxStrings)
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// GET, PATCH and DELETE /admin/namespaces/{name}
+func (h *Handler) HandleNamespace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET, PATCH and DELETE are allowed for this path")
+		return
+	}
+	ns, ok := h.namespaceStore(w)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/admin/namespaces/")
+	if !ValidNamespace(name) {
+		writeError(w, http.StatusNotFound, "Not Found", "Namespace not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctx, cancel := h.storeContext(r)
+		defer cancel()
+		found, err := ns.GetNamespace(ctx, name)
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, found)
+
+	case http.MethodPatch:
+		var req NamespaceUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad Request", "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.MaxStrings == nil {
+			writeError(w, http.StatusBadRequest, "Bad Request", "Missing required field: max_strings")
+			return
+		}
+		if *req.MaxStrings < 0 {
+			writeError(w, http.StatusBadRequest, "Bad Request", "max_strings must not be negative")
+			return
+		}
+		ctx, cancel := h.storeContext(r)
+		defer cancel()
+		updated, err := ns.SetNamespaceQuota(ctx, name, *req.MaxStrings)
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+
+		slog.Info("namespace quota changed", "namespace", name, "max_strings", updated.MaxStrings)
+
+		writeJSON(w, http.StatusOK, updated)
+
+	case http.MethodDelete:
+		if name == DefaultNamespace {
+			writeError(w, http.StatusBadRequest, "Bad Request", "The default namespace cannot be deleted")
+			return
+		}
+		ctx, cancel := h.storeContext(r)
+		defer cancel()
+		if err := ns.DeleteNamespace(ctx, name); err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+
+		slog.Info("namespace deleted", "namespace", name)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// eachNamespace calls fn with the view of every namespace of store, or only
+// with store when it has no namespaces. Background jobs use it so that
+// retention and re-analysis apply to each namespace separately.
+func eachNamespace[S any](ctx context.Context, store S, fn func(view S) error) error {
+	ns, ok := any(store).(NamespaceStore)
+	if !ok {
+		return fn(store)
+	}
+	list, err := ns.ListNamespaces(ctx)
+	if errors.Is(err, ErrNotSupported) {
+		return fn(store)
+	}
+	if err != nil {
+		return err
+	}
+	for _, n := range list {
+		view, ok := ns.In(n.Name).(S)
+		if !ok {
+			return ErrNotSupported
+		}
+		if err := fn(view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+)
+
+// send sends a request with an optional JSON body and X-Namespace header
+// and returns the status and decoded JSON response.
+func send(t *testing.T, server *httptest.Server, method, path, namespace, body string) (int, map[string]any) {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, _ := http.NewRequest(method, server.URL+path, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if namespace != "" {
+		req.Header.Set(handlers.NamespaceHeader, namespace)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func TestNamespaces(t *testing.T) {
+	server := httptest.NewServer(handlers.SetupRoutes(memstore.New()))
+	defer server.Close()
+
+	code, body := send(t, server, http.MethodPost, "/admin/namespaces", "", `{"name":"acme","max_strings":2}`)
+	if code != http.StatusCreated || body["name"] != "acme" || body["max_strings"] != float64(2) {
+		t.Fatalf("POST /admin/namespaces: %d %v", code, body)
+	}
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"name":"acme"}`, http.StatusConflict},
+		{`{"name":"default"}`, http.StatusConflict},
+		{`{"name":"Not Valid"}`, http.StatusBadRequest},
+		{`{"name":"beta","max_strings":-1}`, http.StatusBadRequest},
+	} {
+		if code, body := send(t, server, http.MethodPost, "/admin/namespaces", "", tc.body); code != tc.want {
+			t.Errorf("POST /admin/namespaces %s: %d %v, want %d", tc.body, code, body, tc.want)
+		}
+	}
+
+	// The same value lives independently in each namespace.
+	if code, body := send(t, server, http.MethodPost, "/ns/acme/strings", "", `{"value":"racecar","tags":["acme"]}`); code != http.StatusCreated {
+		t.Fatalf("POST /ns/acme/strings: %d %v", code, body)
+	}
+	if code, body := post(t, server, `{"value":"racecar"}`); code != http.StatusCreated {
+		t.Fatalf("POST /strings in the default namespace: %d %v", code, body)
+	}
+	if code, body := send(t, server, http.MethodPost, "/strings", "acme", `{"value":"a/b"}`); code != http.StatusCreated {
+		t.Fatalf("POST /strings with %s: %d %v", handlers.NamespaceHeader, code, body)
+	}
+	if code, body := send(t, server, http.MethodPost, "/ns/acme/strings", "", `{"value":"level"}`); code != http.StatusForbidden {
+		t.Errorf("POST beyond the quota: %d %v, want 403", code, body)
+	}
+
+	if code, body := do(t, server, http.MethodGet, "/ns/acme/strings/list"); code != http.StatusOK || body["count"] != float64(2) {
+		t.Errorf("GET /ns/acme/strings/list: %d %v, want 2 strings", code, body)
+	}
+	if code, body := do(t, server, http.MethodGet, "/strings/list"); code != http.StatusOK || body["count"] != float64(1) {
+		t.Errorf("GET /strings/list: %d %v, want 1 string", code, body)
+	}
+	if code, _ := do(t, server, http.MethodGet, "/strings/a%2Fb"); code != http.StatusNotFound {
+		t.Errorf("GET /strings/a%%2Fb in the default namespace: %d, want 404", code)
+	}
+	if code, body := do(t, server, http.MethodGet, "/ns/acme/strings/a%2Fb"); code != http.StatusOK || body["value"] != "a/b" {
+		t.Errorf("GET /ns/acme/strings/a%%2Fb: %d %v", code, body)
+	}
+	if code, body := send(t, server, http.MethodGet, "/tags", "acme", ""); code != http.StatusOK || body["count"] != float64(1) {
+		t.Errorf("GET /tags in acme: %d %v, want 1 tag", code, body)
+	}
+	if code, body := do(t, server, http.MethodGet, "/ns/default/tags"); code != http.StatusOK || body["count"] != float64(0) {
+		t.Errorf("GET /ns/default/tags: %d %v, want no tags", code, body)
+	}
+
+	for _, tc := range []struct {
+		path, namespace string
+		want            int
+	}{
+		{"/ns/acme/strings/list", "other", http.StatusBadRequest},
+		{"/ns/missing/strings/list", "", http.StatusNotFound},
+		{"/strings/list", "missing", http.StatusNotFound},
+		{"/ns/Not%20Valid/strings/list", "", http.StatusBadRequest},
+		{"/ns/acme/admin/namespaces", "", http.StatusNotFound},
+	} {
+		if code, body := send(t, server, http.MethodGet, tc.path, tc.namespace, ""); code != tc.want {
+			t.Errorf("GET %s (namespace %q): %d %v, want %d", tc.path, tc.namespace, code, body, tc.want)
+		}
+	}
+
+	code, body = do(t, server, http.MethodGet, "/admin/namespaces")
+	if code != http.StatusOK || body["count"] != float64(2) {
+		t.Fatalf("GET /admin/namespaces: %d %v", code, body)
+	}
+	list := body["data"].([]any)
+	if acme := list[0].(map[string]any); acme["name"] != "acme" || acme["count"] != float64(2) {
+		t.Errorf("first namespace = %v, want acme with 2 strings", acme)
+	}
+
+	if code, body := send(t, server, http.MethodPatch, "/admin/namespaces/acme", "", `{"max_strings":3}`); code != http.StatusOK || body["max_strings"] != float64(3) {
+		t.Errorf("PATCH /admin/namespaces/acme: %d %v", code, body)
+	}
+	if code, body := send(t, server, http.MethodPatch, "/admin/namespaces/acme", "", `{}`); code != http.StatusBadRequest {
+		t.Errorf("PATCH without max_strings: %d %v, want 400", code, body)
+	}
+	if code, body := send(t, server, http.MethodPatch, "/admin/namespaces/missing", "", `{"max_strings":1}`); code != http.StatusNotFound {
+		t.Errorf("PATCH a missing namespace: %d %v, want 404", code, body)
+	}
+	if code, body := send(t, server, http.MethodPost, "/ns/acme/strings", "", `{"value":"level"}`); code != http.StatusCreated {
+		t.Errorf("POST after raising the quota: %d %v", code, body)
+	}
+
+	if code, body := do(t, server, http.MethodDelete, "/admin/namespaces/default"); code != http.StatusBadRequest {
+		t.Errorf("DELETE the default namespace: %d %v, want 400", code, body)
+	}
+	if code, body := do(t, server, http.MethodDelete, "/admin/namespaces/acme"); code != http.StatusNoContent {
+		t.Errorf("DELETE /admin/namespaces/acme: %d %v", code, body)
+	}
+	if code, _ := do(t, server, http.MethodGet, "/ns/acme/strings/list"); code != http.StatusNotFound {
+		t.Errorf("GET a deleted namespace: %d, want 404", code)
+	}
+	if code, _ := do(t, server, http.MethodDelete, "/admin/namespaces/acme"); code != http.StatusNotFound {
+		t.Errorf("DELETE a deleted namespace: %d, want 404", code)
+	}
+	if code, body := do(t, server, http.MethodGet, "/strings/racecar"); code != http.StatusOK {
+		t.Errorf("GET /strings/racecar after deleting acme: %d %v", code, body)
+	}
+}
+
+func TestNamespacesNotSupported(t *testing.T) {
+	server, _ := setupTestServer()
+	defer server.Close()
+
+	for _, path := range []string{"/admin/namespaces", "/ns/acme/strings/list"} {
+		if code, body := do(t, server, http.MethodGet, path); code != http.StatusNotImplemented {
+			t.Errorf("GET %s: %d %v, want 501", path, code, body)
+		}
+	}
+	if code, body := do(t, server, http.MethodGet, "/ns/default/strings/list"); code != http.StatusOK {
+		t.Errorf("GET /ns/default/strings/list: %d %v", code, body)
+	}
+}
+
+func TestReaperPerNamespace(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	store := memstore.New()
+	if err := store.CreateNamespace(ctx, handlers.Namespace{Name: "acme", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for _, view := range []handlers.StringStore{store, store.In("acme")} {
+		for i, v := range []string{"old", "new"} {
+			props := handlers.ComputeProperties(v)
+			sr := &handlers.StringResource{ID: props.SHA256Hash, Value: v, Properties: props, CreatedAt: now.Add(time.Duration(i) * time.Minute)}
+			if err := view.Create(ctx, sr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	rp := handlers.NewReaper(store, handlers.RetentionPolicy{MaxRows: 1}, time.Hour, 10)
+	res, err := rp.ReapOnce(ctx, now.Add(time.Hour))
+	if err != nil || res.Excess != 2 {
+		t.Errorf("ReapOnce = %+v, %v; want 2 excess, one per namespace", res, err)
+	}
+	for _, view := range []handlers.StringStore{store, store.In("acme")} {
+		if ok, _ := view.Exists(ctx, "new"); !ok {
+			t.Error("Expected the newest string of each namespace to be kept")
+		}
+		if ok, _ := view.Exists(ctx, "old"); ok {
+			t.Error("Expected the oldest string of each namespace to be reaped")
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ReanalysisStore is implemented by stores whose rows can be re-analyzed in
+// the background after AnalyzerVersion changes.
+type ReanalysisStore interface {
+	// ListStale returns up to limit resources matching filters whose
+	// AnalyzerVersion is below version and whose ID sorts after afterID,
+	// ordered by ID, and the number of stale resources matching filters
+	// regardless of afterID.
+	ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]StringResource, int, error)
+	// UpdateProperties overwrites the stored properties and analyzer version
+	// of the resource with sr.ID.
+	UpdateProperties(ctx context.Context, sr *StringResource) error
+}
+
+// ErrReanalysisRunning is returned by Reanalysis.Start while a run is active.
+var ErrReanalysisRunning = errors.New("re-analysis already running")
+
+// Reanalysis states reported in ReanalysisStatus.State.
+const (
+	ReanalysisIdle      = "idle"
+	ReanalysisRunning   = "running"
+	ReanalysisCompleted = "completed"
+	ReanalysisFailed    = "failed"
+	ReanalysisCancelled = "cancelled"
+)
+
+// ReanalysisStatus is the progress of the current or last re-analysis run,
+// served by GET /admin/reanalysis.
+type ReanalysisStatus struct {
+	State           string         `json:"state"`
+	AnalyzerVersion int            `json:"analyzer_version"`
+	Filters         map[string]any `json:"filters,omitempty"`
+	// Total is the number of stale rows matching Filters when the run started.
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	// Changed counts processed rows whose properties actually differed.
+	Changed    int        `json:"changed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Reanalysis recomputes the properties of rows stored by an older
+// AnalyzerVersion. It works in fixed-size batches and sleeps between them so
+// that it does not starve request traffic.
+type Reanalysis struct {
+	store     ReanalysisStore
+	batchSize int
+	pause     time.Duration
+
+	mu     sync.Mutex
+	status ReanalysisStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Defaults used by NewReanalysis for a non-positive batch size or a negative
+// pause; a zero pause disables throttling.
+const (
+	DefaultReanalysisBatchSize = 100
+	DefaultReanalysisPause     = 100 * time.Millisecond
+)
+
+func NewReanalysis(store ReanalysisStore, batchSize int, pause time.Duration) *Reanalysis {
+	if batchSize <= 0 {
+		batchSize = DefaultReanalysisBatchSize
+	}
+	if pause < 0 {
+		pause = DefaultReanalysisPause
+	}
+	return &Reanalysis{
+		store:     store,
+		batchSize: batchSize,
+		pause:     pause,
+		status:    ReanalysisStatus{State: ReanalysisIdle, AnalyzerVersion: AnalyzerVersion},
+	}
+}
+
+// Start launches a run over the stale rows matching filters (nil for all).
+func (j *Reanalysis) Start(filters map[string]any) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.State == ReanalysisRunning {
+		return ErrReanalysisRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now().UTC()
+	j.status = ReanalysisStatus{
+		State:           ReanalysisRunning,
+		AnalyzerVersion: AnalyzerVersion,
+		Filters:         filters,
+		StartedAt:       &now,
+	}
+	j.cancel = cancel
+	j.done = make(chan struct{})
+	go j.run(ctx, filters, j.done)
+	return nil
+}
+
+// Status returns a snapshot of the current or last run.
+func (j *Reanalysis) Status() ReanalysisStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Wait blocks until the current run, if any, has finished.
+func (j *Reanalysis) Wait() {
+	j.mu.Lock()
+	done := j.done
+	j.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Stop cancels the current run, if any, and waits for it to finish.
+func (j *Reanalysis) Stop() {
+	j.mu.Lock()
+	cancel := j.cancel
+	j.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	j.Wait()
+}
+
+func (j *Reanalysis) run(ctx context.Context, filters map[string]any, done chan struct{}) {
+	defer close(done)
+	err := j.process(ctx, filters)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	j.status.FinishedAt = &now
+	switch {
+	case err == nil:
+		j.status.State = ReanalysisCompleted
+	case errors.Is(err, context.Canceled):
+		j.status.State = ReanalysisCancelled
+	default:
+		j.status.State = ReanalysisFailed
+		j.status.Error = err.Error()
+	}
+	j.cancel()
+
+	slog.Info("re-analysis finished", "state", j.status.State, "processed", j.status.Processed,
+		"changed", j.status.Changed, "error", j.status.Error)
+}
+
+// process re-analyzes the stale rows of every namespace in turn, after
+// counting them all for Status.
+func (j *Reanalysis) process(ctx context.Context, filters map[string]any) error {
+	ctx = WithActor(ctx, ActorReanalysis)
+	total := 0
+	err := eachNamespace(ctx, j.store, func(store ReanalysisStore) error {
+		_, n, err := store.ListStale(ctx, filters, AnalyzerVersion, "", 1)
+		total += n
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.status.Total = total
+	j.mu.Unlock()
+
+	return eachNamespace(ctx, j.store, func(store ReanalysisStore) error {
+		return j.processStore(ctx, store, filters)
+	})
+}
+
+func (j *Reanalysis) processStore(ctx context.Context, store ReanalysisStore, filters map[string]any) error {
+	afterID := ""
+	for {
+		batch, _, err := store.ListStale(ctx, filters, AnalyzerVersion, afterID, j.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for i := range batch {
+			sr := &batch[i]
+			props := ComputeProperties(sr.Value)
+			changed := !reflect.DeepEqual(props, sr.Properties)
+			sr.Properties = props
+			sr.AnalyzerVersion = AnalyzerVersion
+			err := store.UpdateProperties(ctx, sr)
+			if errors.Is(err, ErrNotFound) {
+				continue // deleted since it was listed
+			}
+			if err != nil {
+				return err
+			}
+			j.mu.Lock()
+			j.status.Processed++
+			if changed {
+				j.status.Changed++
+			}
+			j.mu.Unlock()
+		}
+		afterID = batch[len(batch)-1].ID
+
+		// Throttle between batches
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(j.pause):
+		}
+	}
+}
+
+// WithReanalysis enables the /admin/reanalysis endpoints for job.
+func WithReanalysis(job *Reanalysis) Option {
+	return func(h *Handler) {
+		h.reanalysis = job
+	}
+}
+
+// GET /admin/reanalysis reports progress; POST starts a run, optionally
+// limited by the /strings/list filter parameters.
+func (h *Handler) HandleReanalysis(w http.ResponseWriter, r *http.Request) {
+	if h.reanalysis == nil {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "Re-analysis is not supported by this store")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.reanalysis.Status())
+	case http.MethodPost:
+		filters, msg := parseFilters(r.URL.Query())
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, "Bad Request", msg)
+			return
+		}
+		if len(filters) == 0 {
+			filters = nil
+		}
+		if err := h.reanalysis.Start(filters); err != nil {
+			writeError(w, http.StatusConflict, "Conflict", "A re-analysis run is already in progress")
+			return
+		}
+
+		slog.Info("re-analysis started", "filters", filters)
+
+		writeJSON(w, http.StatusAccepted, h.reanalysis.Status())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET and POST are allowed for this path")
+	}
+}
@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// seedStale stores values as if written by an older analyzer whose word
+// count was wrong.
+func seedStale(store *InMemoryStore, values ...string) {
+	for _, val := range values {
+		props := handlers.ComputeProperties(val)
+		props.WordCount = 99
+		_ = store.Create(context.Background(), &handlers.StringResource{ID: props.SHA256Hash, Value: val, Properties: props})
+	}
+}
+
+func getReanalysisStatus(t *testing.T, server *httptest.Server) handlers.ReanalysisStatus {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/admin/reanalysis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status handlers.ReanalysisStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestReanalysis(t *testing.T) {
+	t.Run("re-analyzes the filtered subset", func(t *testing.T) {
+		store := NewInMemoryStore()
+		seedStale(store, "racecar", "level", "hi")
+		job := handlers.NewReanalysis(store, 1, 0)
+		server := httptest.NewServer(handlers.SetupRoutes(store, handlers.WithReanalysis(job)))
+		defer server.Close()
+
+		if status := getReanalysisStatus(t, server); status.State != handlers.ReanalysisIdle {
+			t.Errorf("Expected idle before any run, got %q", status.State)
+		}
+
+		resp, _ := server.Client().Post(server.URL+"/admin/reanalysis?min_length=5", "", nil)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, resp.StatusCode)
+		}
+		job.Wait()
+
+		status := getReanalysisStatus(t, server)
+		if status.State != handlers.ReanalysisCompleted || status.Total != 2 || status.Processed != 2 || status.Changed != 2 {
+			t.Errorf("Unexpected final status %+v", status)
+		}
+		if status.Filters["min_length"] != float64(5) {
+			t.Errorf("Expected filters to be reported, got %v", status.Filters)
+		}
+
+		racecar, _ := store.Get(context.Background(), "racecar")
+		if racecar.Properties.WordCount != 1 || racecar.AnalyzerVersion != handlers.AnalyzerVersion {
+			t.Errorf("Expected racecar to be re-analyzed, got %+v", racecar)
+		}
+		hi, _ := store.Get(context.Background(), "hi")
+		if hi.AnalyzerVersion != 0 {
+			t.Errorf("Expected rows outside the filter to be left alone, got %+v", hi)
+		}
+	})
+
+	t.Run("409 Conflict - already running, then cancelled", func(t *testing.T) {
+		store := NewInMemoryStore()
+		seedStale(store, "one", "two", "three")
+		job := handlers.NewReanalysis(store, 1, time.Hour)
+		server := httptest.NewServer(handlers.SetupRoutes(store, handlers.WithReanalysis(job)))
+		defer server.Close()
+
+		resp, _ := server.Client().Post(server.URL+"/admin/reanalysis", "", nil)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, resp.StatusCode)
+		}
+		resp, _ = server.Client().Post(server.URL+"/admin/reanalysis", "", nil)
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, resp.StatusCode)
+		}
+
+		job.Stop()
+		if status := getReanalysisStatus(t, server); status.State != handlers.ReanalysisCancelled || status.Processed != 1 {
+			t.Errorf("Expected cancelled after the first throttled batch, got %+v", status)
+		}
+	})
+
+	t.Run("400 Bad Request - invalid filter", func(t *testing.T) {
+		store := NewInMemoryStore()
+		server := httptest.NewServer(handlers.SetupRoutes(store, handlers.WithReanalysis(handlers.NewReanalysis(store, 0, 0))))
+		defer server.Close()
+
+		resp, _ := server.Client().Post(server.URL+"/admin/reanalysis?min_length=abc", "", nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("501 Not Implemented - not configured", func(t *testing.T) {
+		server, _ := setupTestServer()
+		defer server.Close()
+
+		resp, _ := server.Client().Get(server.URL + "/admin/reanalysis")
+		if resp.StatusCode != http.StatusNotImplemented {
+			t.Errorf("Expected status %d, got %d", http.StatusNotImplemented, resp.StatusCode)
+		}
+	})
+}
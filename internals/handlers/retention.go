@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetentionStore is implemented by stores that support expiry. Such stores
+// treat a resource whose ExpiresAt has passed as absent: Get, GetByID,
+// Exists and List do not return it, and CreateIfAbsent replaces it (Delete
+// may still remove it). The methods below delete for good, at most limit
+// resources per call, and return how many they removed; the Reaper calls
+// them until a batch comes back short.
+type RetentionStore interface {
+	// DeleteExpired deletes resources whose ExpiresAt is at or before now.
+	DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error)
+	// DeleteCreatedBefore deletes resources created before cutoff.
+	DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int, error)
+	// DeleteOldest deletes the oldest resources (by CreatedAt) beyond the
+	// newest keep, counting trashed but not expired ones.
+	DeleteOldest(ctx context.Context, keep, limit int) (int, error)
+}
+
+// parseExpiry turns the ttl or expires_at of a create request into an
+// expiry time. On invalid input it returns a status and message for the
+// error response.
+func parseExpiry(req *StringCreateRequest, now time.Time) (*time.Time, int, string) {
+	switch {
+	case req.TTL != "" && req.ExpiresAt != nil:
+		return nil, http.StatusBadRequest, "Set either ttl or expires_at, not both"
+	case req.TTL != "":
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, http.StatusBadRequest, "Invalid ttl (expected a positive duration such as \"90s\" or \"24h\")"
+		}
+		at := now.Add(ttl)
+		return &at, 0, ""
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return nil, http.StatusUnprocessableEntity, "expires_at must be in the future"
+		}
+		at := req.ExpiresAt.UTC()
+		return &at, 0, ""
+	}
+	return nil, 0, ""
+}
+
+// RetentionPolicy bounds how long and how many strings are kept. Zero
+// fields are not enforced; expired strings are always reaped.
+type RetentionPolicy struct {
+	// MaxAge deletes strings created longer ago than this.
+	MaxAge time.Duration
+	// MaxRows keeps at most this many strings in each namespace, deleting
+	// the oldest first.
+	MaxRows int
+}
+
+// Defaults used by NewReaper for non-positive arguments.
+const (
+	DefaultReapInterval  = time.Minute
+	DefaultReapBatchSize = 500
+)
+
+// Reaper deletes expired strings and enforces a RetentionPolicy once per
+// interval, in batches so that no single statement holds the store for
+// long.
+type Reaper struct {
+	store     RetentionStore
+	policy    RetentionPolicy
+	interval  time.Duration
+	batchSize int
+
+	loop loop
+}
+
+func NewReaper(store RetentionStore, policy RetentionPolicy, interval time.Duration, batchSize int) *Reaper {
+	if interval <= 0 {
+		interval = DefaultReapInterval
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultReapBatchSize
+	}
+	return &Reaper{store: store, policy: policy, interval: interval, batchSize: batchSize}
+}
+
+// ReapResult counts the strings one pass removed, by reason.
+type ReapResult struct {
+	Expired int
+	TooOld  int
+	Excess  int
+}
+
+// ReapOnce runs one full pass at now, applying the policy to each
+// namespace separately. It stops early, returning what it has removed so
+// far, if ctx is cancelled between batches. Audit events name ActorReaper.
+func (rp *Reaper) ReapOnce(ctx context.Context, now time.Time) (ReapResult, error) {
+	ctx = WithNow(WithActor(ctx, ActorReaper), now)
+	var res ReapResult
+	err := eachNamespace(ctx, rp.store, func(store RetentionStore) error {
+		return rp.reap(ctx, store, now, &res)
+	})
+	return res, err
+}
+
+// reap runs one pass over store, adding what it removes to res.
+func (rp *Reaper) reap(ctx context.Context, store RetentionStore, now time.Time, res *ReapResult) error {
+	n, err := rp.batches(ctx, func(limit int) (int, error) {
+		return store.DeleteExpired(ctx, now, limit)
+	})
+	res.Expired += n
+	if err != nil {
+		return err
+	}
+	if rp.policy.MaxAge > 0 {
+		cutoff := now.Add(-rp.policy.MaxAge)
+		n, err = rp.batches(ctx, func(limit int) (int, error) {
+			return store.DeleteCreatedBefore(ctx, cutoff, limit)
+		})
+		res.TooOld += n
+		if err != nil {
+			return err
+		}
+	}
+	if rp.policy.MaxRows > 0 {
+		n, err = rp.batches(ctx, func(limit int) (int, error) {
+			return store.DeleteOldest(ctx, rp.policy.MaxRows, limit)
+		})
+		res.Excess += n
+	}
+	return err
+}
+
+// batches calls del until it removes fewer than a full batch.
+func (rp *Reaper) batches(ctx context.Context, del func(limit int) (int, error)) (int, error) {
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := del(rp.batchSize)
+		total += n
+		if err != nil || n < rp.batchSize {
+			return total, err
+		}
+	}
+}
+
+// Start reaps immediately and then once per interval until Stop. It does
+// nothing if the reaper is already running.
+func (rp *Reaper) Start() {
+	rp.loop.start(rp.interval, func(ctx context.Context) {
+		res, err := rp.ReapOnce(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.Error("retention reap failed", "error", err)
+		}
+		if res != (ReapResult{}) {
+			slog.Info("reaped strings", "expired", res.Expired, "too_old", res.TooOld, "excess", res.Excess)
+		}
+	})
+}
+
+// Stop ends the background loop, interrupting a pass between batches, and
+// waits for it to exit.
+func (rp *Reaper) Stop() {
+	rp.loop.halt()
+}
+
+// loop runs a job now and then once per interval on its own goroutine,
+// cancelling the job's context when halted.
+type loop struct {
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (l *loop) start(interval time.Duration, job func(ctx context.Context)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stop != nil {
+		return
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.run(l.stop, l.done, interval, job)
+}
+
+func (l *loop) halt() {
+	l.mu.Lock()
+	stop, done := l.stop, l.done
+	l.stop, l.done = nil, nil
+	l.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (l *loop) run(stop, done chan struct{}, interval time.Duration, job func(ctx context.Context)) {
+	defer close(done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job(ctx)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+)
+
+// post sends body to POST /strings and returns the status and decoded
+// JSON response.
+func post(t *testing.T, server *httptest.Server, body string) (int, map[string]any) {
+	t.Helper()
+	resp, err := server.Client().Post(server.URL+"/strings", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", body, err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func TestCreateWithExpiry(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	store := memstore.New()
+	server := httptest.NewServer(handlers.SetupRoutes(store, handlers.WithClock(func() time.Time { return now })))
+	defer server.Close()
+
+	code, body := post(t, server, `{"value":"with ttl","ttl":"1h30m"}`)
+	if code != http.StatusCreated || body["expires_at"] != now.Add(90*time.Minute).Format(time.RFC3339) {
+		t.Errorf("POST with ttl: %d %v", code, body)
+	}
+	at := now.Add(48 * time.Hour).Format(time.RFC3339)
+	code, body = post(t, server, `{"value":"with expires_at","expires_at":"`+at+`"}`)
+	if code != http.StatusCreated || body["expires_at"] != at {
+		t.Errorf("POST with expires_at: %d %v", code, body)
+	}
+	if code, body := post(t, server, `{"value":"forever"}`); code != http.StatusCreated || body["expires_at"] != nil {
+		t.Errorf("POST without expiry: %d %v", code, body)
+	}
+
+	invalid := []struct {
+		body string
+		want int
+	}{
+		{`{"value":"x","ttl":"soon"}`, http.StatusBadRequest},
+		{`{"value":"x","ttl":"-5m"}`, http.StatusBadRequest},
+		{`{"value":"x","ttl":"1h","expires_at":"` + at + `"}`, http.StatusBadRequest},
+		{`{"value":"x","expires_at":"` + now.Add(-time.Second).Format(time.RFC3339) + `"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tc := range invalid {
+		if code, _ := post(t, server, tc.body); code != tc.want {
+			t.Errorf("POST %s: status %d, want %d", tc.body, code, tc.want)
+		}
+	}
+
+	t.Run("expired strings are invisible", func(t *testing.T) {
+		props := handlers.ComputeProperties("expired")
+		past := now.Add(-time.Minute)
+		if err := store.Create(context.Background(), &handlers.StringResource{ID: props.SHA256Hash, Value: "expired", Properties: props, CreatedAt: now, ExpiresAt: &past}); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{"/strings/expired", "/strings/id/" + props.SHA256Hash} {
+			if code, _ := do(t, server, http.MethodGet, path); code != http.StatusNotFound {
+				t.Errorf("GET %s: status %d, want 404", path, code)
+			}
+		}
+		if _, body := do(t, server, http.MethodGet, "/strings/list"); body["count"] != float64(3) {
+			t.Errorf("list count = %v, want 3", body["count"])
+		}
+		if code, body := post(t, server, `{"value":"expired"}`); code != http.StatusCreated || body["expires_at"] != nil {
+			t.Errorf("POST of an expired value: %d %v", code, body)
+		}
+	})
+}
+
+// TestExpiryFollowsClock checks that expiry is judged by the handler's
+// clock rather than the wall clock.
+func TestExpiryFollowsClock(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(handlers.SetupRoutes(memstore.New(), handlers.WithClock(func() time.Time { return now })))
+	defer server.Close()
+
+	if code, body := post(t, server, `{"value":"with ttl","ttl":"1h","tags":["t"]}`); code != http.StatusCreated {
+		t.Fatalf("POST with ttl: %d %v", code, body)
+	}
+	if code, _ := do(t, server, http.MethodGet, "/strings/with%20ttl"); code != http.StatusOK {
+		t.Errorf("GET before expiry: status %d, want 200", code)
+	}
+	if _, body := do(t, server, http.MethodGet, "/strings/list"); body["count"] != float64(1) {
+		t.Errorf("list count before expiry = %v, want 1", body["count"])
+	}
+
+	now = now.Add(time.Hour)
+	if code, _ := do(t, server, http.MethodGet, "/strings/with%20ttl"); code != http.StatusNotFound {
+		t.Errorf("GET at expiry: status %d, want 404", code)
+	}
+	for _, path := range []string{"/strings/list", "/strings/list?tag=t", "/tags"} {
+		if _, body := do(t, server, http.MethodGet, path); body["count"] != float64(0) {
+			t.Errorf("GET %s at expiry: count %v, want 0", path, body["count"])
+		}
+	}
+}
+
+// TestCreateWithExpiryUnsupported checks that a store without expiry
+// refuses a ttl rather than keeping the string forever.
+func TestCreateWithExpiryUnsupported(t *testing.T) {
+	server, _ := setupTestServer()
+	defer server.Close()
+	if code, _ := post(t, server, `{"value":"hello","ttl":"1h"}`); code != http.StatusNotImplemented {
+		t.Errorf("POST with ttl: status %d, want 501", code)
+	}
+}
+
+func TestReaper(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	store := memstore.New()
+	add := func(value string, age time.Duration, expiresIn *time.Duration) {
+		props := handlers.ComputeProperties(value)
+		sr := &handlers.StringResource{ID: props.SHA256Hash, Value: value, Properties: props, CreatedAt: now.Add(-age)}
+		if expiresIn != nil {
+			at := now.Add(*expiresIn)
+			sr.ExpiresAt = &at
+		}
+		if err := store.Create(ctx, sr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired, later := -time.Minute, time.Hour
+	for i, v := range []string{"e1", "e2", "e3"} {
+		add(v, time.Duration(i)*time.Hour, &expired)
+	}
+	add("ancient", 100*24*time.Hour, nil)
+	add("old", 50*24*time.Hour, nil)
+	add("middle", 40*24*time.Hour, &later)
+	add("new", time.Hour, nil)
+
+	rp := handlers.NewReaper(store, handlers.RetentionPolicy{MaxAge: 90 * 24 * time.Hour, MaxRows: 2}, time.Hour, 2)
+	res, err := rp.ReapOnce(ctx, now)
+	if err != nil || res != (handlers.ReapResult{Expired: 3, TooOld: 1, Excess: 1}) {
+		t.Errorf("ReapOnce = %+v, %v; want 3 expired, 1 too old, 1 excess", res, err)
+	}
+	for _, v := range []string{"middle", "new"} {
+		if ok, _ := store.Exists(ctx, v); !ok {
+			t.Errorf("Expected %q to be kept", v)
+		}
+	}
+	if n := store.Len(); n != 2 {
+		t.Errorf("store holds %d strings after reaping, want 2", n)
+	}
+
+	// A cancelled pass stops before its first batch
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	add("e4", 0, &expired)
+	if _, err := rp.ReapOnce(cancelled, now); err == nil {
+		t.Error("ReapOnce with a cancelled context: expected an error")
+	}
+
+	rp.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	rp.Stop()
+	rp.Stop()
+	if n := store.Len(); n != 2 {
+		t.Errorf("background reaper left %d strings, want 2", n)
+	}
+}
@@ -2,27 +2,82 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 )
 
+// reservedNames are the /strings/{name} path segments that address endpoints
+// rather than stored values. They always mean the endpoint; a stored string
+// with one of these values (or starting with "name/") is reached through
+// POST /strings/lookup, POST /strings/delete or /strings/id/{id}, or by
+// escaping its slashes as %2F.
+var reservedNames = map[string]bool{
+	"list":                       true,
+	"filter-by-natural-language": true,
+	"id":                         true,
+	"lookup":                     true,
+	"delete":                     true,
+	"trash":                      true,
+}
+
 // HandleStringValue acts as a sub-router for the /strings/{string_value} path.
 // It is registered on the prefix "/strings/" and dispatches to the correct
-// handler (GetString or DeleteString) based on the HTTP method.
+// handler (GetString, UpdateString or DeleteString) based on the HTTP method.
 // This approach is compatible with the provided handlers that parse the path manually.
 func (h *Handler) HandleStringValue(w http.ResponseWriter, r *http.Request) {
-	// Prevent this prefix handler from matching /strings/list or /strings/filter-by-natural-language
-	// This is a safeguard, as ServeMux should prioritize more specific routes first.
-	if r.URL.Path == "/strings/list" || r.URL.Path == "/strings/filter-by-natural-language" {
-		http.NotFound(w, r)
+	// Sub-paths of reserved endpoints (e.g. /strings/list/x) that ServeMux did
+	// not match are never treated as values. Only an unescaped "/" ends the
+	// segment, so /strings/list%2Fx is still the value "list/x".
+	segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/strings/"), "/")
+	if reservedNames[segment] {
+		writeError(w, http.StatusNotFound, "Not Found",
+			"\""+segment+"\" is a reserved path; use POST /strings/lookup to fetch a string with this value")
+		return
+	}
+
+	// POST on a value means restore; a value that itself ends in "/restore"
+	// is restored by escaping its slash as %2F
+	if r.Method == http.MethodPost && hasValueSuffix(r, "/restore") {
+		h.RestoreString(w, r)
+		return
+	}
+	// Likewise GET on a value ending in "/history" lists its events
+	if r.Method == http.MethodGet && hasValueSuffix(r, "/history") {
+		h.StringHistory(w, r)
 		return
 	}
 
 	switch r.Method {
 	case http.MethodGet:
 		h.GetString(w, r)
+	case http.MethodPatch:
+		h.UpdateString(w, r)
 	case http.MethodDelete:
 		h.DeleteString(w, r)
 	default:
 		// Send a 405 Method Not Allowed response.
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET, PATCH and DELETE are allowed for this path")
+	}
+}
+
+// hasValueSuffix reports whether the path is /strings/{value}{suffix} with a
+// non-empty value, so that /strings/history and /strings/restore are still
+// the values "history" and "restore".
+func hasValueSuffix(r *http.Request, suffix string) bool {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/strings/")
+	value, ok := strings.CutSuffix(rest, suffix)
+	return ok && value != ""
+}
+
+// HandleStringID dispatches /strings/id/{id} to GetStringByID or
+// DeleteStringByID based on the HTTP method.
+func (h *Handler) HandleStringID(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetStringByID(w, r)
+	case http.MethodDelete:
+		h.DeleteStringByID(w, r)
+	default:
 		w.Header().Set("Allow", "GET, DELETE")
 		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET and DELETE are allowed for this path")
 	}
@@ -31,9 +86,10 @@ func (h *Handler) HandleStringValue(w http.ResponseWriter, r *http.Request) {
 // SetupRoutes initializes a new http.ServeMux, registers all API endpoints
 // from the OpenAPI spec, and returns the mux as an http.Handler.
 // It takes a StringStore implementation as an argument to inject the dependency.
-func SetupRoutes(store StringStore) http.Handler {
+// Optional Handler settings (e.g. WithClock) are passed through to NewHandler.
+func SetupRoutes(store StringStore, opts ...Option) http.Handler {
 	// Create the main handler which contains the storage dependency
-	h := NewHandler(store)
+	h := NewHandler(store, opts...)
 
 	// Create a new ServeMux (HTTP router)
 	mux := http.NewServeMux()
@@ -56,8 +112,31 @@ func SetupRoutes(store StringStore) http.Handler {
 	// The handler itself enforces the GET method.
 	mux.HandleFunc("/strings/filter-by-natural-language", h.FilterByNaturalLanguage)
 
+	// GET /strings/filter-by-natural-language/explain
+	// Runs only the parser and reports how the query would be executed.
+	mux.HandleFunc("/strings/filter-by-natural-language/explain", h.ExplainNaturalLanguage)
+
+	// POST /strings/lookup
+	// POST /strings/delete
+	// Take the value in a JSON body, for values that are awkward in a path
+	// or collide with reservedNames.
+	mux.HandleFunc("/strings/lookup", h.LookupString)
+	mux.HandleFunc("/strings/delete", h.DeleteStringByValue)
+
+	// GET /strings/id/{id}
+	// DELETE /strings/id/{id}
+	// Looks strings up by SHA-256 ID or a unique prefix of it.
+	mux.HandleFunc("/strings/id/", h.HandleStringID)
+
+	// GET /strings/trash
+	// Lists soft-deleted strings (see TrashStore).
+	mux.HandleFunc("/strings/trash", h.ListTrash)
+
 	// GET /strings/{string_value}
+	// PATCH /strings/{string_value}
 	// DELETE /strings/{string_value}
+	// POST /strings/{string_value}/restore
+	// GET /strings/{string_value}/history
 	//
 	// This path uses a prefix match on "/strings/".
 	// The HandleStringValue helper function multiplexes based on the method (GET/DELETE).
@@ -65,5 +144,32 @@ func SetupRoutes(store StringStore) http.Handler {
 	// parsing the {string_value} from r.URL.Path, which this routing setup supports.
 	mux.HandleFunc("/strings/", h.HandleStringValue)
 
-	return mux
+	// GET /tags
+	// Tag usage counts (see AnnotationStore).
+	mux.HandleFunc("/tags", h.ListTags)
+
+	// GET /events
+	// The audit trail (see EventStore).
+	mux.HandleFunc("/events", h.ListEvents)
+
+	// GET /admin/reanalysis
+	// POST /admin/reanalysis
+	// Reports or starts background re-analysis (see WithReanalysis).
+	mux.HandleFunc("/admin/reanalysis", h.HandleReanalysis)
+
+	// GET /admin/cache
+	// Hit/miss metrics of a caching store (see storecache).
+	mux.HandleFunc("/admin/cache", h.HandleCacheStats)
+
+	// GET /admin/namespaces
+	// POST /admin/namespaces
+	// GET, PATCH, DELETE /admin/namespaces/{name}
+	// Manage the tenants of a NamespaceStore.
+	mux.HandleFunc("/admin/namespaces", h.HandleNamespaces)
+	mux.HandleFunc("/admin/namespaces/", h.HandleNamespace)
+
+	// Every /strings, /tags and /events route above is also served under
+	// /ns/{name}/..., or with an X-Namespace header, confined to that
+	// namespace.
+	return h.scope(mux)
 }
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashStore is implemented by stores that support soft deletion. Trashed
+// resources keep their value, so Get, GetByID, Exists and CreateIfAbsent
+// still see them (with DeletedAt set), but List only returns them when the
+// filters ask for them (see MatchesFilters).
+type TrashStore interface {
+	// Trash sets DeletedAt on the live resource with this value, or
+	// returns ErrNotFound if there is none.
+	Trash(ctx context.Context, value string, at time.Time) error
+	// Restore clears DeletedAt on the trashed resource with this value and
+	// returns it, or returns ErrNotFound if the value is not in the trash.
+	Restore(ctx context.Context, value string) (*StringResource, error)
+	// Purge permanently deletes resources trashed before cutoff and
+	// returns how many it removed.
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// delete moves value to the trash, or removes it outright when the store
+// has no trash.
+func (h *Handler) delete(ctx context.Context, store StringStore, value string) error {
+	if trash, ok := store.(TrashStore); ok {
+		return trash.Trash(ctx, value, h.now().UTC())
+	}
+	return store.Delete(ctx, value)
+}
+
+// parseIncludeDeleted reads the include_deleted query parameter, which makes
+// lookups return trashed strings. The API has no notion of an admin, so any
+// client may set it. On invalid input it writes a 400 response and returns
+// ok=false.
+func parseIncludeDeleted(w http.ResponseWriter, r *http.Request) (include, ok bool) {
+	val := r.URL.Query().Get("include_deleted")
+	if val == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(val)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid include_deleted value")
+		return false, false
+	}
+	return include, true
+}
+
+// GET /strings/trash
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only GET is allowed")
+		return
+	}
+	store := h.storeFor(r)
+	if _, ok := store.(TrashStore); !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store deletes strings permanently")
+		return
+	}
+
+	limit, offset, msg := parsePage(r.URL.Query())
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", msg)
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	filters := map[string]any{"deleted": true}
+	data, count, err := store.List(ctx, filters, limit, offset)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListResponse{
+		Data:           data,
+		Count:          count,
+		FiltersApplied: filters,
+	})
+}
+
+// POST /strings/{string_value}/restore
+func (h *Handler) RestoreString(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed", "Only POST is allowed")
+		return
+	}
+	store := h.storeFor(r)
+	trash, ok := store.(TrashStore)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Not Implemented", "The store deletes strings permanently")
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/strings/"), "/restore")
+	value, err := url.PathUnescape(path)
+	if err != nil || value == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request", "Invalid string value in path")
+		return
+	}
+
+	ctx, cancel := h.storeContext(r)
+	defer cancel()
+
+	resource, err := trash.Restore(ctx, value)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// Re-analysis skips the trash, so bring a stale row up to date now
+	if rs, ok := store.(ReanalysisStore); ok && resource.AnalyzerVersion < AnalyzerVersion {
+		resource.Properties = ComputeProperties(resource.Value)
+		resource.AnalyzerVersion = AnalyzerVersion
+		if err := rs.UpdateProperties(ctx, resource); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	slog.Info("string restored", "id", resource.ID, "value", resource.Value)
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// Purger permanently deletes strings that have been in the trash for longer
+// than the retention period, checking once per interval.
+type Purger struct {
+	store     TrashStore
+	retention time.Duration
+	interval  time.Duration
+
+	loop loop
+}
+
+// Defaults used by NewPurger for non-positive arguments.
+const (
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	DefaultPurgeInterval  = time.Hour
+)
+
+func NewPurger(store TrashStore, retention, interval time.Duration) *Purger {
+	if retention <= 0 {
+		retention = DefaultTrashRetention
+	}
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+	return &Purger{store: store, retention: retention, interval: interval}
+}
+
+// PurgeOnce deletes the strings trashed more than the retention period
+// before now, in every namespace, and returns how many it removed. Audit
+// events name ActorPurger.
+func (p *Purger) PurgeOnce(ctx context.Context, now time.Time) (int, error) {
+	ctx = WithNow(WithActor(ctx, ActorPurger), now)
+	total := 0
+	err := eachNamespace(ctx, p.store, func(store TrashStore) error {
+		n, err := store.Purge(ctx, now.Add(-p.retention))
+		total += n
+		return err
+	})
+	return total, err
+}
+
+// Start purges immediately and then once per interval until Stop. It does
+// nothing if the purger is already running.
+func (p *Purger) Start() {
+	p.loop.start(p.interval, func(ctx context.Context) {
+		n, err := p.PurgeOnce(ctx, time.Now())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Error("trash purge failed", "error", err)
+		case n > 0:
+			slog.Info("purged trashed strings", "count", n, "retention", p.retention)
+		}
+	})
+}
+
+// Stop ends the background loop, interrupting a purge in progress, and
+// waits for it to exit.
+func (p *Purger) Stop() {
+	p.loop.halt()
+}
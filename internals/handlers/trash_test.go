@@ -0,0 +1,185 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+)
+
+// do sends a request without a body and returns the status and decoded
+// JSON response.
+func do(t *testing.T, server *httptest.Server, method, path string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(method, server.URL+path, nil)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var body map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestTrash(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := memstore.New()
+	server := httptest.NewServer(handlers.SetupRoutes(store, handlers.WithClock(func() time.Time { return now })))
+	defer server.Close()
+	for _, v := range []string{"racecar", "hello world", "level"} {
+		props := handlers.ComputeProperties(v)
+		if err := store.Create(context.Background(), &handlers.StringResource{ID: props.SHA256Hash, Value: v, Properties: props, CreatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	racecarID := handlers.ComputeProperties("racecar").SHA256Hash
+
+	if code, _ := do(t, server, http.MethodDelete, "/strings/racecar"); code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", code)
+	}
+	if code, _ := do(t, server, http.MethodDelete, "/strings/id/"+handlers.ComputeProperties("hello world").SHA256Hash); code != http.StatusNoContent {
+		t.Fatalf("DELETE by id: status %d", code)
+	}
+
+	t.Run("hidden from lookups and lists", func(t *testing.T) {
+		for _, path := range []string{"/strings/racecar", "/strings/id/" + racecarID[:8]} {
+			if code, _ := do(t, server, http.MethodGet, path); code != http.StatusNotFound {
+				t.Errorf("GET %s: status %d, want 404", path, code)
+			}
+		}
+		if code, _ := do(t, server, http.MethodDelete, "/strings/racecar"); code != http.StatusNotFound {
+			t.Errorf("DELETE of trashed value: status %d, want 404", code)
+		}
+		if _, body := do(t, server, http.MethodGet, "/strings/list"); body["count"] != float64(1) {
+			t.Errorf("list count = %v, want 1", body["count"])
+		}
+		if _, body := do(t, server, http.MethodGet, "/strings/list?include_deleted=true"); body["count"] != float64(3) {
+			t.Errorf("list?include_deleted=true count = %v, want 3", body["count"])
+		}
+	})
+
+	t.Run("include_deleted", func(t *testing.T) {
+		code, body := do(t, server, http.MethodGet, "/strings/racecar?include_deleted=true")
+		if code != http.StatusOK || body["deleted_at"] != now.Format(time.RFC3339) {
+			t.Errorf("GET ?include_deleted=true: %d %v", code, body)
+		}
+		if code, _ := do(t, server, http.MethodGet, "/strings/racecar?include_deleted=maybe"); code != http.StatusBadRequest {
+			t.Errorf("invalid include_deleted: status %d, want 400", code)
+		}
+		resp, err := server.Client().Post(server.URL+"/strings/lookup?include_deleted=true", "application/json", strings.NewReader(`{"value":"racecar"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("lookup ?include_deleted=true: status %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("re-creating a trashed value conflicts", func(t *testing.T) {
+		resp, err := server.Client().Post(server.URL+"/strings", "application/json", strings.NewReader(`{"value":"racecar"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body handlers.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusConflict || !strings.Contains(body.Message, "restore") || body.ID != racecarID {
+			t.Errorf("POST trashed value: %d %+v", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("GET /strings/trash", func(t *testing.T) {
+		code, body := do(t, server, http.MethodGet, "/strings/trash?limit=1")
+		data, _ := body["data"].([]any)
+		if code != http.StatusOK || body["count"] != float64(2) || len(data) != 1 {
+			t.Errorf("trash: %d %v", code, body)
+		}
+		if code, _ := do(t, server, http.MethodGet, "/strings/trash?limit=0"); code != http.StatusBadRequest {
+			t.Errorf("trash?limit=0: status %d, want 400", code)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		code, body := do(t, server, http.MethodPost, "/strings/racecar/restore")
+		if code != http.StatusOK || body["value"] != "racecar" || body["deleted_at"] != nil {
+			t.Errorf("restore: %d %v", code, body)
+		}
+		if code, _ := do(t, server, http.MethodGet, "/strings/racecar"); code != http.StatusOK {
+			t.Errorf("GET after restore: status %d", code)
+		}
+		if code, _ := do(t, server, http.MethodPost, "/strings/racecar/restore"); code != http.StatusNotFound {
+			t.Errorf("restore of a live value: status %d, want 404", code)
+		}
+		if code, _ := do(t, server, http.MethodPost, "/strings/missing/restore"); code != http.StatusNotFound {
+			t.Errorf("restore of a missing value: status %d, want 404", code)
+		}
+		// "restore" on its own is a value, not an empty value to restore
+		if code, _ := do(t, server, http.MethodPost, "/strings/restore"); code != http.StatusMethodNotAllowed {
+			t.Errorf("POST /strings/restore: status %d, want 405", code)
+		}
+	})
+}
+
+// TestTrashUnsupported checks that stores without a trash keep deleting
+// permanently.
+func TestTrashUnsupported(t *testing.T) {
+	server, store := setupTestServer()
+	defer server.Close()
+	seedStore(store, "hello")
+
+	if code, _ := do(t, server, http.MethodDelete, "/strings/hello"); code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", code)
+	}
+	if ok, _ := store.Exists(context.Background(), "hello"); ok {
+		t.Error("Expected a permanent delete")
+	}
+	for _, req := range [][2]string{{http.MethodGet, "/strings/trash"}, {http.MethodPost, "/strings/hello/restore"}} {
+		if code, _ := do(t, server, req[0], req[1]); code != http.StatusNotImplemented {
+			t.Errorf("%s %s: status %d, want 501", req[0], req[1], code)
+		}
+	}
+}
+
+func TestPurger(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	now := time.Now().UTC()
+	for i, v := range []string{"old", "recent", "live"} {
+		props := handlers.ComputeProperties(v)
+		if err := store.Create(ctx, &handlers.StringResource{ID: props.SHA256Hash, Value: v, Properties: props, CreatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+		if v != "live" {
+			if err := store.Trash(ctx, v, now.Add(-time.Duration(40-30*i)*24*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	p := handlers.NewPurger(store, 30*24*time.Hour, time.Hour)
+	p.Start()
+	p.Start() // no-op while running
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.Stop()
+	p.Stop()
+
+	if ok, _ := store.Exists(ctx, "old"); ok {
+		t.Error("Expected the string trashed 40 days ago to be purged")
+	}
+	for _, v := range []string{"recent", "live"} {
+		if ok, _ := store.Exists(ctx, v); !ok {
+			t.Errorf("Expected %q to be kept", v)
+		}
+	}
+}
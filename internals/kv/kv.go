@@ -0,0 +1,281 @@
+// Package kv is a small embedded, ordered key-value engine in the style of
+// bbolt: named buckets of sorted byte keys, read-only View transactions and a
+// single writer at a time through Update.
+//
+// Buckets are immutable treaps. A transaction reads from the root that was
+// current when it began, so readers never take a lock or wait for a writer,
+// and a committed Update becomes visible atomically. Commits are appended to a
+// checksummed log before they are published; Open replays the log and a
+// background compaction rewrites it once it is mostly overwritten data.
+//
+// The whole dataset is held in memory; the log is only read by Open.
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrTxReadOnly is returned by writes inside View.
+	ErrTxReadOnly = errors.New("kv: write in read-only transaction")
+	// ErrClosed is returned by transactions on a closed DB.
+	ErrClosed = errors.New("kv: database is closed")
+)
+
+// Defaults used by Open for zero Options fields.
+const (
+	DefaultCompactMinBytes = 4 << 20
+	DefaultCompactRatio    = 2.0
+)
+
+// Options configure Open.
+type Options struct {
+	// NoSync skips the fsync after each commit. A crash can then lose recent
+	// commits, but never leaves a partially applied one.
+	NoSync bool
+	// The log is compacted in the background after a commit once it
+	// exceeds CompactMinBytes and CompactRatio times the size of the live
+	// data.
+	CompactMinBytes int64
+	CompactRatio    float64
+}
+
+// state is one immutable version of the database.
+type state struct {
+	buckets map[string]*node
+	live    int64 // encoded size of the live entries
+}
+
+// DB is an open database file.
+type DB struct {
+	path string
+	opts Options
+	root atomic.Pointer[state]
+
+	mu         sync.Mutex // held by the writer
+	f          *os.File   // nil once closed
+	logBytes   int64
+	err        error // set if a failed commit could not be removed from the log
+	compacting bool  // a background compaction is running
+
+	compactMu sync.Mutex // serializes compactions
+	wg        sync.WaitGroup
+}
+
+// syncFile is replaced by tests to simulate fsync failures.
+var syncFile = (*os.File).Sync
+
+// Open opens or creates the database at path.
+func Open(path string, opts Options) (*DB, error) {
+	if opts.CompactMinBytes <= 0 {
+		opts.CompactMinBytes = DefaultCompactMinBytes
+	}
+	if opts.CompactRatio <= 0 {
+		opts.CompactRatio = DefaultCompactRatio
+	}
+	db := &DB{path: path, opts: opts}
+	st, n, err := replay(path)
+	if err != nil {
+		return nil, fmt.Errorf("kv: opening %s: %w", path, err)
+	}
+	db.root.Store(st)
+	db.logBytes = n
+	if db.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close waits for the current writer and any background compaction and
+// closes the file. Open transactions keep reading their snapshot; new ones
+// fail with ErrClosed.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.f == nil {
+		db.mu.Unlock()
+		return nil
+	}
+	err := db.f.Close()
+	db.f = nil
+	db.root.Store(nil)
+	db.mu.Unlock()
+	db.wg.Wait()
+	return err
+}
+
+// View runs fn in a read-only transaction. It never blocks on writers.
+func (db *DB) View(fn func(*Tx) error) error {
+	st := db.root.Load()
+	if st == nil {
+		return ErrClosed
+	}
+	return fn(&Tx{st: st})
+}
+
+// Update runs fn in a read-write transaction and commits it if fn returns
+// nil. Updates are serialized; concurrent Views see either all of a commit
+// or none of it.
+func (db *DB) Update(fn func(*Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	if db.err != nil {
+		return db.err
+	}
+
+	cur := db.root.Load()
+	buckets := make(map[string]*node, len(cur.buckets))
+	for name, root := range cur.buckets {
+		buckets[name] = root
+	}
+	tx := &Tx{st: &state{buckets: buckets, live: cur.live}, writable: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	n, err := appendRecord(db.f, tx.ops)
+	if err == nil && !db.opts.NoSync {
+		err = syncFile(db.f)
+	}
+	if err != nil {
+		// Drop the record, so a restart does not replay a commit reported
+		// as failed and later commits are not appended after a partial one
+		if terr := db.f.Truncate(db.logBytes); terr != nil {
+			db.err = fmt.Errorf("kv: removing failed commit from the log: %w", terr)
+		}
+		return err
+	}
+	db.logBytes += n
+	db.root.Store(tx.st)
+
+	if !db.compacting && db.logBytes > db.opts.CompactMinBytes && float64(db.logBytes) > db.opts.CompactRatio*float64(tx.st.live) {
+		db.compacting = true
+		db.wg.Add(1)
+		go db.compactInBackground()
+	}
+	return nil
+}
+
+// Compact rewrites the log with only the live entries. Writers are blocked
+// only while the commits made during the rewrite are copied over.
+func (db *DB) Compact() error {
+	return db.compact()
+}
+
+// compactInBackground runs a compaction started by Update. The commit that
+// triggered it is durable either way; a failed compaction is retried after
+// a later commit.
+func (db *DB) compactInBackground() {
+	defer db.wg.Done()
+	err := db.compact()
+	db.mu.Lock()
+	db.compacting = false
+	db.mu.Unlock()
+	if err != nil && !errors.Is(err, ErrClosed) {
+		slog.Warn("kv log compaction failed", "path", db.path, "error", err)
+	}
+}
+
+// Size returns the current size of the log in bytes.
+func (db *DB) Size() int64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.logBytes
+}
+
+// Tx is a transaction. It must not be used after its View or Update returns.
+type Tx struct {
+	st       *state
+	writable bool
+	ops      []op
+}
+
+// Bucket returns the named bucket. Buckets need no creation: a bucket that
+// was never written is empty.
+func (tx *Tx) Bucket(name string) *Bucket {
+	return &Bucket{tx: tx, name: name}
+}
+
+// Bucket is a sorted set of keys within a transaction. Slices returned by
+// its methods belong to the database and must not be modified.
+type Bucket struct {
+	tx   *Tx
+	name string
+}
+
+func (b *Bucket) root() *node { return b.tx.st.buckets[b.name] }
+
+// Get returns the value for key, or nil if it is absent.
+func (b *Bucket) Get(key []byte) []byte {
+	v, _ := get(b.root(), key)
+	return v
+}
+
+// Put sets key to value. Both are copied.
+func (b *Bucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return ErrTxReadOnly
+	}
+	key, value = clone(key), clone(value)
+	st := b.tx.st
+	root := b.root()
+	if old, ok := get(root, key); ok {
+		st.live -= entrySize(b.name, key, old)
+	}
+	st.buckets[b.name] = put(root, key, value)
+	st.live += entrySize(b.name, key, value)
+	b.tx.ops = append(b.tx.ops, op{kind: opPut, bucket: b.name, key: key, val: value})
+	return nil
+}
+
+// Delete removes key if present.
+func (b *Bucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrTxReadOnly
+	}
+	st := b.tx.st
+	root := b.root()
+	old, ok := get(root, key)
+	if !ok {
+		return nil
+	}
+	key = clone(key)
+	st.live -= entrySize(b.name, key, old)
+	st.buckets[b.name] = del(root, key)
+	b.tx.ops = append(b.tx.ops, op{kind: opDelete, bucket: b.name, key: key})
+	return nil
+}
+
+// Len returns the number of keys in the bucket.
+func (b *Bucket) Len() int { return size(b.root()) }
+
+// Count returns the number of keys in [start, end). A nil end means no upper
+// bound. It takes O(log n) time.
+func (b *Bucket) Count(start, end []byte) int {
+	root := b.root()
+	hi := size(root)
+	if end != nil {
+		hi = rank(root, end)
+	}
+	return max(hi-rank(root, start), 0)
+}
+
+// Cursor returns a cursor over the bucket as of this point in the
+// transaction.
+func (b *Bucket) Cursor() *Cursor {
+	return &Cursor{root: b.root()}
+}
+
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,291 @@
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTest(t *testing.T, path string, opts Options) *DB {
+	t.Helper()
+	db, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func keys(t *testing.T, db *DB, bucket string, seek []byte) []string {
+	t.Helper()
+	var out []string
+	db.View(func(tx *Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, _ := c.Seek(seek); k != nil; k, _ = c.Next() {
+			out = append(out, string(k))
+		}
+		return nil
+	})
+	return out
+}
+
+func TestOrderedBuckets(t *testing.T) {
+	db := openTest(t, filepath.Join(t.TempDir(), "db"), Options{NoSync: true})
+
+	var want []string
+	err := db.Update(func(tx *Tx) error {
+		b := tx.Bucket("a")
+		for i := 999; i >= 0; i-- {
+			k := fmt.Sprintf("k%04d", i*7%1000)
+			want = append(want, k)
+			if err := b.Put([]byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket("b").Put([]byte("other"), nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(want)
+
+	if got := keys(t, db, "a", nil); !slices.Equal(got, want) {
+		t.Fatalf("cursor order wrong: first keys %q", got[:5])
+	}
+	if got := keys(t, db, "a", []byte("k0995")); !slices.Equal(got, want[995:]) {
+		t.Errorf("Seek(k0995) = %q", got)
+	}
+	if got := keys(t, db, "a", []byte("k09955")); !slices.Equal(got, want[996:]) {
+		t.Errorf("Seek between keys = %q", got)
+	}
+
+	db.Update(func(tx *Tx) error {
+		b := tx.Bucket("a")
+		for i := 0; i < 1000; i += 2 {
+			b.Delete([]byte(fmt.Sprintf("k%04d", i)))
+		}
+		b.Put([]byte("k0001"), []byte("replaced"))
+		return nil
+	})
+	db.View(func(tx *Tx) error {
+		b := tx.Bucket("a")
+		if b.Len() != 500 {
+			t.Errorf("Len = %d, want 500", b.Len())
+		}
+		if n := b.Count([]byte("k0100"), []byte("k0200")); n != 50 {
+			t.Errorf("Count[k0100,k0200) = %d, want 50", n)
+		}
+		if n := b.Count([]byte("k0990"), nil); n != 5 {
+			t.Errorf("Count[k0990,) = %d, want 5", n)
+		}
+		if v := b.Get([]byte("k0001")); string(v) != "replaced" {
+			t.Errorf("Get(k0001) = %q", v)
+		}
+		if v := b.Get([]byte("k0002")); v != nil {
+			t.Errorf("deleted key still present: %q", v)
+		}
+		if tx.Bucket("missing").Len() != 0 {
+			t.Error("unwritten bucket is not empty")
+		}
+		if err := b.Put([]byte("x"), nil); !errors.Is(err, ErrTxReadOnly) {
+			t.Errorf("Put in View: expected ErrTxReadOnly, got %v", err)
+		}
+		return nil
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	db := openTest(t, filepath.Join(t.TempDir(), "db"), Options{NoSync: true})
+	db.Update(func(tx *Tx) error { return tx.Bucket("b").Put([]byte("k"), []byte("1")) })
+
+	// A failed Update leaves nothing behind
+	boom := errors.New("boom")
+	if err := db.Update(func(tx *Tx) error {
+		tx.Bucket("b").Put([]byte("k"), []byte("2"))
+		tx.Bucket("b").Put([]byte("k2"), []byte("2"))
+		return boom
+	}); !errors.Is(err, boom) {
+		t.Fatalf("Update error = %v", err)
+	}
+	if got := keys(t, db, "b", nil); !slices.Equal(got, []string{"k"}) {
+		t.Errorf("rolled back writes visible: %q", got)
+	}
+
+	// Readers never wait for a writer and keep their snapshot
+	inWriter, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- db.Update(func(tx *Tx) error {
+			tx.Bucket("b").Put([]byte("k"), []byte("3"))
+			close(inWriter)
+			<-release
+			return nil
+		})
+	}()
+	<-inWriter
+	viewed := make(chan string)
+	go db.View(func(tx *Tx) error {
+		viewed <- string(tx.Bucket("b").Get([]byte("k")))
+		return nil
+	})
+	select {
+	case v := <-viewed:
+		if v != "1" {
+			t.Errorf("View during Update saw %q, want the committed 1", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("View blocked behind an open Update")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	db.View(func(tx *Tx) error {
+		if v := tx.Bucket("b").Get([]byte("k")); string(v) != "3" {
+			t.Errorf("after commit Get = %q, want 3", v)
+		}
+		return nil
+	})
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 100 {
+		db.Update(func(tx *Tx) error {
+			b := tx.Bucket("b")
+			b.Put([]byte(fmt.Sprintf("k%02d", i%10)), bytes.Repeat([]byte{'x'}, 100))
+			if i%10 == 9 {
+				b.Delete([]byte("k00"))
+			}
+			return nil
+		})
+	}
+	before := db.Size()
+	db.Close()
+
+	// Append a torn commit: the header promises more than is there
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(encode([]op{{kind: opPut, bucket: "b", key: []byte("torn"), val: []byte("v")}})[:12])
+	f.Close()
+
+	db = openTest(t, path, Options{})
+	want := []string{"k01", "k02", "k03", "k04", "k05", "k06", "k07", "k08", "k09"}
+	if got := keys(t, db, "b", nil); !slices.Equal(got, want) {
+		t.Errorf("after reopen keys = %q, want %q", got, want)
+	}
+	if db.Size() != before {
+		t.Errorf("torn record not truncated: size %d, want %d", db.Size(), before)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if db.Size() >= before/5 {
+		t.Errorf("compaction left %d of %d bytes", db.Size(), before)
+	}
+	db.Update(func(tx *Tx) error { return tx.Bucket("b").Put([]byte("k10"), nil) })
+	db.Close()
+	db = openTest(t, path, Options{})
+	if got := keys(t, db, "b", nil); !slices.Equal(got, append(want, "k10")) {
+		t.Errorf("after compaction and reopen keys = %q", got)
+	}
+	db.Close()
+	if err := db.View(func(*Tx) error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("View after Close: expected ErrClosed, got %v", err)
+	}
+}
+
+func TestCorruptLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	rec := encode([]op{{kind: opPut, bucket: "b", key: []byte("k"), val: []byte("v")}})
+	bad := slices.Clone(rec)
+	bad[len(bad)-1] ^= 0xff
+	os.WriteFile(path, slices.Concat(rec, bad, rec), 0o644)
+	if _, err := Open(path, Options{}); err == nil {
+		t.Error("expected an error for a corrupt record mid-log")
+	}
+}
+
+func TestCompactionDuringWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := Open(path, Options{CompactMinBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Background compactions start from Update; explicit ones race them
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			if err := db.Compact(); err != nil {
+				t.Errorf("Compact: %v", err)
+			}
+		}
+	}()
+	for i := range 500 {
+		err := db.Update(func(tx *Tx) error {
+			return tx.Bucket("b").Put([]byte(fmt.Sprintf("k%02d", i%20)), []byte(fmt.Sprint(i)))
+		})
+		if err != nil {
+			t.Fatalf("Update %d: %v", i, err)
+		}
+	}
+	<-done
+	db.Close()
+
+	db = openTest(t, path, Options{})
+	db.View(func(tx *Tx) error {
+		b := tx.Bucket("b")
+		if b.Len() != 20 {
+			t.Errorf("Len = %d, want 20", b.Len())
+		}
+		for k := range 20 {
+			if got, want := string(b.Get([]byte(fmt.Sprintf("k%02d", k)))), fmt.Sprint(480+k); got != want {
+				t.Errorf("k%02d = %q, want %q", k, got, want)
+			}
+		}
+		return nil
+	})
+}
+
+func TestFailedSyncRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := openTest(t, path, Options{})
+	put := func(key string) error {
+		return db.Update(func(tx *Tx) error { return tx.Bucket("b").Put([]byte(key), []byte("v")) })
+	}
+	if err := put("kept"); err != nil {
+		t.Fatal(err)
+	}
+	before := db.Size()
+
+	errSync := errors.New("sync failed")
+	syncFile = func(*os.File) error { return errSync }
+	err := put("failed")
+	syncFile = (*os.File).Sync
+	if !errors.Is(err, errSync) {
+		t.Fatalf("Update with a failing fsync: got %v, want %v", err, errSync)
+	}
+	if db.Size() != before {
+		t.Errorf("failed commit left the log at %d bytes, want %d", db.Size(), before)
+	}
+	if err := put("after"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openTest(t, path, Options{})
+	if got := keys(t, db, "b", nil); !slices.Equal(got, []string{"after", "kept"}) {
+		t.Errorf("after reopen keys = %q, want the failed commit gone", got)
+	}
+}
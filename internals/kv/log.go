@@ -0,0 +1,280 @@
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// The log is a sequence of records, one per commit:
+//
+//	length  uint32 little-endian, of payload
+//	crc     uint32 little-endian, CRC-32C of payload
+//	payload ops, each: kind byte, then uvarint-length-prefixed bucket, key
+//	        and (for puts) value
+//
+// A record is applied entirely or not at all.
+
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+
+	headerSize = 8
+	// compactBatch is the number of entries per record written by Compact.
+	compactBatch = 1024
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type op struct {
+	kind     byte
+	bucket   string
+	key, val []byte
+}
+
+// entrySize approximates the log bytes a live entry needs after compaction.
+func entrySize(bucket string, key, val []byte) int64 {
+	return int64(1 + 3*binary.MaxVarintLen32 + len(bucket) + len(key) + len(val))
+}
+
+func encode(ops []op) []byte {
+	buf := make([]byte, headerSize, headerSize+64*len(ops))
+	for _, o := range ops {
+		buf = append(buf, o.kind)
+		buf = binary.AppendUvarint(buf, uint64(len(o.bucket)))
+		buf = append(buf, o.bucket...)
+		buf = binary.AppendUvarint(buf, uint64(len(o.key)))
+		buf = append(buf, o.key...)
+		if o.kind == opPut {
+			buf = binary.AppendUvarint(buf, uint64(len(o.val)))
+			buf = append(buf, o.val...)
+		}
+	}
+	payload := buf[headerSize:]
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	return buf
+}
+
+func appendRecord(w io.Writer, ops []op) (int64, error) {
+	n, err := w.Write(encode(ops))
+	return int64(n), err
+}
+
+var errBadPayload = errors.New("malformed record payload")
+
+func decode(payload []byte) ([]op, error) {
+	var ops []op
+	field := func() ([]byte, error) {
+		n, k := binary.Uvarint(payload)
+		if k <= 0 || uint64(len(payload)-k) < n {
+			return nil, errBadPayload
+		}
+		b := payload[k : k+int(n)]
+		payload = payload[k+int(n):]
+		return b, nil
+	}
+	for len(payload) > 0 {
+		o := op{kind: payload[0]}
+		payload = payload[1:]
+		bucket, err := field()
+		if err != nil {
+			return nil, err
+		}
+		o.bucket = string(bucket)
+		if o.key, err = field(); err != nil {
+			return nil, err
+		}
+		switch o.kind {
+		case opPut:
+			if o.val, err = field(); err != nil {
+				return nil, err
+			}
+		case opDelete:
+		default:
+			return nil, fmt.Errorf("%w: op %d", errBadPayload, o.kind)
+		}
+		ops = append(ops, o)
+	}
+	return ops, nil
+}
+
+// replay rebuilds the state from the log at path and returns it with the
+// log's valid length. An incomplete or corrupt final record is a commit
+// that never finished: it is truncated away. A bad record followed by more
+// data means real corruption and is an error.
+func replay(path string) (*state, int64, error) {
+	st := &state{buckets: make(map[string]*node)}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := bufio.NewReaderSize(f, 1<<16)
+	var offset int64
+	var header [headerSize]byte
+	for offset < fi.Size() {
+		bad := func(reason string) (*state, int64, error) {
+			slog.Warn("truncating incomplete kv log record", "path", path, "offset", offset, "reason", reason)
+			return st, offset, os.Truncate(path, offset)
+		}
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return bad("short header")
+		}
+		length := int64(binary.LittleEndian.Uint32(header[0:4]))
+		end := offset + headerSize + length
+		if end > fi.Size() {
+			return bad("short payload")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, 0, err
+		}
+		ops, err := decode(payload)
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) || err != nil {
+			if end == fi.Size() {
+				return bad("checksum mismatch")
+			}
+			return nil, 0, fmt.Errorf("corrupt record at offset %d", offset)
+		}
+		for _, o := range ops {
+			apply(st, o)
+		}
+		offset = end
+	}
+	return st, offset, nil
+}
+
+// apply mutates st in place; only used while nothing else can see st.
+func apply(st *state, o op) {
+	root := st.buckets[o.bucket]
+	if old, ok := get(root, o.key); ok {
+		st.live -= entrySize(o.bucket, o.key, old)
+	}
+	switch o.kind {
+	case opPut:
+		st.buckets[o.bucket] = put(root, o.key, o.val)
+		st.live += entrySize(o.bucket, o.key, o.val)
+	case opDelete:
+		st.buckets[o.bucket] = del(root, o.key)
+	}
+}
+
+// compact writes the live entries of a snapshot to a new file without
+// holding db.mu, then takes it to append the records committed meanwhile
+// and swap the new file in. Readers are unaffected throughout.
+func (db *DB) compact() error {
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.Lock()
+	if db.f == nil {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	st, start := db.root.Load(), db.logBytes
+	db.mu.Unlock()
+
+	tmp := db.path + ".compact"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := writeState(f, st)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err == nil && db.f == nil {
+		err = ErrClosed
+	}
+	if err == nil && db.logBytes > start {
+		var tail int64
+		tail, err = copyTail(f, db.path, start, db.logBytes)
+		n += tail
+		if err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, db.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(db.path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	nf, err := os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	slog.Info("compacted kv log", "path", db.path, "bytes_before", db.logBytes, "bytes_after", n)
+	db.f.Close()
+	db.f = nf
+	db.logBytes = n
+	return nil
+}
+
+// copyTail appends the bytes [start, end) of the log at path to w.
+func copyTail(w io.Writer, path string, start, end int64) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	return io.Copy(w, io.NewSectionReader(src, start, end-start))
+}
+
+// writeState writes every entry of st as put records.
+func writeState(w io.Writer, st *state) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var total int64
+	var batch []op
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := appendRecord(bw, batch)
+		total += n
+		batch = batch[:0]
+		return err
+	}
+	for name, root := range st.buckets {
+		c := &Cursor{root: root}
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			batch = append(batch, op{kind: opPut, bucket: name, key: k, val: v})
+			if len(batch) == compactBatch {
+				if err := flush(); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return total, bw.Flush()
+}
@@ -0,0 +1,167 @@
+package kv
+
+import (
+	"bytes"
+	"hash/fnv"
+)
+
+// node is a node of an immutable treap ordered by key. Updates copy the path
+// from the root to the change and share everything else, so a root pointer
+// is a consistent snapshot that never changes under a reader.
+type node struct {
+	key, val    []byte
+	prio        uint32
+	size        int // nodes in this subtree
+	left, right *node
+}
+
+func newNode(key, val []byte) *node {
+	h := fnv.New32a()
+	h.Write(key)
+	return &node{key: key, val: val, prio: h.Sum32(), size: 1}
+}
+
+func (n *node) clone() *node {
+	c := *n
+	return &c
+}
+
+func size(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *node) fix() {
+	n.size = 1 + size(n.left) + size(n.right)
+}
+
+func get(n *node, key []byte) ([]byte, bool) {
+	for n != nil {
+		switch c := bytes.Compare(key, n.key); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n.val, true
+		}
+	}
+	return nil, false
+}
+
+// split divides n into keys before key and the rest. With inclusive, key
+// itself goes to the left.
+func split(n *node, key []byte, inclusive bool) (left, right *node) {
+	if n == nil {
+		return nil, nil
+	}
+	c := n.clone()
+	if cmp := bytes.Compare(n.key, key); cmp < 0 || (inclusive && cmp == 0) {
+		c.right, right = split(n.right, key, inclusive)
+		c.fix()
+		return c, right
+	}
+	left, c.left = split(n.left, key, inclusive)
+	c.fix()
+	return left, c
+}
+
+// merge joins two treaps where every key in a sorts before every key in b.
+func merge(a, b *node) *node {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.prio > b.prio {
+		c := a.clone()
+		c.right = merge(a.right, b)
+		c.fix()
+		return c
+	}
+	c := b.clone()
+	c.left = merge(a, b.left)
+	c.fix()
+	return c
+}
+
+// put returns a new root with key set to val.
+func put(root *node, key, val []byte) *node {
+	lt, rest := split(root, key, false)
+	_, gt := split(rest, key, true)
+	return merge(merge(lt, newNode(key, val)), gt)
+}
+
+// del returns a new root without key.
+func del(root *node, key []byte) *node {
+	if _, ok := get(root, key); !ok {
+		return root
+	}
+	lt, rest := split(root, key, false)
+	_, gt := split(rest, key, true)
+	return merge(lt, gt)
+}
+
+// rank returns the number of keys sorting before key.
+func rank(n *node, key []byte) int {
+	r := 0
+	for n != nil {
+		if bytes.Compare(n.key, key) < 0 {
+			r += size(n.left) + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return r
+}
+
+// Cursor iterates a bucket in key order over the snapshot it was created
+// from. Returned keys and values must not be modified.
+type Cursor struct {
+	root  *node
+	stack []*node
+}
+
+// First moves to the first key, returning nil when the bucket is empty.
+func (c *Cursor) First() (key, value []byte) {
+	return c.Seek(nil)
+}
+
+// Seek moves to the first key at or after seek.
+func (c *Cursor) Seek(seek []byte) (key, value []byte) {
+	c.stack = c.stack[:0]
+	for n := c.root; n != nil; {
+		if bytes.Compare(n.key, seek) >= 0 {
+			c.stack = append(c.stack, n)
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return c.current()
+}
+
+// Next moves to the following key, returning nil at the end.
+func (c *Cursor) Next() (key, value []byte) {
+	if len(c.stack) == 0 {
+		return nil, nil
+	}
+	n := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	for n = n.right; n != nil; n = n.left {
+		c.stack = append(c.stack, n)
+	}
+	return c.current()
+}
+
+func (c *Cursor) current() (key, value []byte) {
+	if len(c.stack) == 0 {
+		return nil, nil
+	}
+	n := c.stack[len(c.stack)-1]
+	return n.key, n.val
+}
@@ -0,0 +1,675 @@
+// Package kvstore is a handlers.StringStore on the embedded kv engine.
+// Resources live in a bucket keyed by value, next to an ID index and one
+// ordered index bucket per list filter. Reads run in kv View transactions and
+// never wait for writers.
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/kv"
+)
+
+// Buckets. Index keys end with the value (or, in byVersion, the ID) they
+// point to, after a fixed-width or NUL-terminated prefix.
+const (
+	bucketStrings    = "strings"        // value -> JSON StringResource
+	bucketIDs        = "ids"            // id -> value
+	bucketLength     = "idx_length"     // u64(length) value
+	bucketWordCount  = "idx_word_count" // u64(word_count) value
+	bucketPalindrome = "idx_palindrome" // 0|1 value
+	bucketChar       = "idx_char"       // character NUL value
+	bucketCreated    = "idx_created"    // timeKey(created_at) value
+	bucketVersion    = "idx_version"    // u64(analyzer_version) id -> value
+	bucketDeleted    = "idx_deleted"    // timeKey(deleted_at) value, trashed only
+	bucketExpires    = "idx_expires"    // timeKey(expires_at) value, expiring only
+	bucketTag        = "idx_tag"        // tag NUL value
+)
+
+// Store implements handlers.StringStore, handlers.ReanalysisStore,
+// handlers.TrashStore, handlers.RetentionStore and handlers.AnnotationStore.
+// Metadata filters have no index and are checked on the scanned range.
+type Store struct {
+	db *kv.DB
+}
+
+// Open opens or creates the store at path.
+func Open(path string, opts kv.Options) (*Store, error) {
+	db, err := kv.Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error { return s.db.Close() }
+
+func u64(n int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(n))
+}
+
+// timeKey encodes t so that byte order matches time order, including
+// before 1970.
+func timeKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano())^1<<63)
+}
+
+func charKey(ch string) []byte {
+	return append([]byte(ch), 0)
+}
+
+func palinKey(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// indexEntries lists the index keys of sr and the value each maps to.
+func indexEntries(sr *handlers.StringResource) map[string][][2][]byte {
+	v := []byte(sr.Value)
+	entries := map[string][][2][]byte{
+		bucketIDs:        {{[]byte(sr.ID), v}},
+		bucketLength:     {{append(u64(sr.Properties.Length), v...), nil}},
+		bucketWordCount:  {{append(u64(sr.Properties.WordCount), v...), nil}},
+		bucketPalindrome: {{append(palinKey(sr.Properties.IsPalindrome), v...), nil}},
+		bucketCreated:    {{append(timeKey(sr.CreatedAt), v...), nil}},
+		bucketVersion:    {{append(u64(sr.AnalyzerVersion), sr.ID...), v}},
+	}
+	for ch := range sr.Properties.CharacterFrequencyMap {
+		entries[bucketChar] = append(entries[bucketChar], [2][]byte{append(charKey(ch), v...), nil})
+	}
+	if sr.DeletedAt != nil {
+		entries[bucketDeleted] = [][2][]byte{{append(timeKey(*sr.DeletedAt), v...), nil}}
+	}
+	if sr.ExpiresAt != nil {
+		entries[bucketExpires] = [][2][]byte{{append(timeKey(*sr.ExpiresAt), v...), nil}}
+	}
+	for _, tag := range sr.Tags {
+		entries[bucketTag] = append(entries[bucketTag], [2][]byte{append(charKey(tag), v...), nil})
+	}
+	return entries
+}
+
+func putResource(tx *kv.Tx, sr *handlers.StringResource) error {
+	data, err := json.Marshal(sr)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketStrings).Put([]byte(sr.Value), data); err != nil {
+		return err
+	}
+	for bucket, kvs := range indexEntries(sr) {
+		for _, e := range kvs {
+			if err := tx.Bucket(bucket).Put(e[0], e[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteResource(tx *kv.Tx, sr *handlers.StringResource) error {
+	if err := tx.Bucket(bucketStrings).Delete([]byte(sr.Value)); err != nil {
+		return err
+	}
+	for bucket, kvs := range indexEntries(sr) {
+		for _, e := range kvs {
+			if err := tx.Bucket(bucket).Delete(e[0]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// load decodes the resource stored under value, or returns ErrNotFound.
+func load(tx *kv.Tx, value []byte) (*handlers.StringResource, error) {
+	data := tx.Bucket(bucketStrings).Get(value)
+	if data == nil {
+		return nil, handlers.ErrNotFound
+	}
+	var sr handlers.StringResource
+	if err := json.Unmarshal(data, &sr); err != nil {
+		return nil, fmt.Errorf("kvstore: decoding %q: %w", value, err)
+	}
+	return &sr, nil
+}
+
+// loadLive is load for a resource that has not expired at now.
+func loadLive(tx *kv.Tx, value []byte, now time.Time) (*handlers.StringResource, error) {
+	sr, err := load(tx, value)
+	if err == nil && handlers.Expired(sr, now) {
+		return nil, handlers.ErrNotFound
+	}
+	return sr, err
+}
+
+// expiredEnd is the bucketExpires key bounding the resources expired at now.
+func expiredEnd(now time.Time) []byte {
+	return timeKey(now.Add(time.Nanosecond))
+}
+
+// classify maps engine errors to the handlers sentinels.
+func classify(err error) error {
+	if errors.Is(err, kv.ErrClosed) {
+		return fmt.Errorf("%w: %v", handlers.ErrUnavailable, err)
+	}
+	return err
+}
+
+func (s *Store) view(ctx context.Context, fn func(*kv.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return classify(s.db.View(fn))
+}
+
+func (s *Store) update(ctx context.Context, fn func(*kv.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return classify(s.db.Update(fn))
+}
+
+func (s *Store) Create(ctx context.Context, sr *handlers.StringResource) error {
+	_, created, err := s.CreateIfAbsent(ctx, sr)
+	if err == nil && !created {
+		return handlers.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	var existing *handlers.StringResource
+	err := s.update(ctx, func(tx *kv.Tx) error {
+		var err error
+		existing, err = load(tx, []byte(sr.Value))
+		if err == nil && handlers.Expired(existing, handlers.NowFrom(ctx)) {
+			err, existing = deleteResource(tx, existing), nil
+			if err == nil {
+				err = handlers.ErrNotFound
+			}
+		}
+		if !errors.Is(err, handlers.ErrNotFound) {
+			return err
+		}
+		if tx.Bucket(bucketIDs).Get([]byte(sr.ID)) != nil {
+			return fmt.Errorf("%w: duplicate id %s", handlers.ErrConflict, sr.ID)
+		}
+		return putResource(tx, sr)
+	})
+	switch {
+	case err != nil:
+		return nil, false, err
+	case existing != nil:
+		return existing, false, nil
+	}
+	return sr, true, nil
+}
+
+func (s *Store) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	var sr *handlers.StringResource
+	err := s.view(ctx, func(tx *kv.Tx) error {
+		var err error
+		sr, err = loadLive(tx, []byte(value), handlers.NowFrom(ctx))
+		return err
+	})
+	return sr, err
+}
+
+func (s *Store) Exists(ctx context.Context, value string) (bool, error) {
+	var ok bool
+	err := s.view(ctx, func(tx *kv.Tx) error {
+		_, err := loadLive(tx, []byte(value), handlers.NowFrom(ctx))
+		if errors.Is(err, handlers.ErrNotFound) {
+			return nil
+		}
+		ok = err == nil
+		return err
+	})
+	return ok, err
+}
+
+// GetByID seeks to id in the ID index; a second key with the same prefix
+// makes it ambiguous, even if that resource has expired.
+func (s *Store) GetByID(ctx context.Context, id string) (*handlers.StringResource, error) {
+	var sr *handlers.StringResource
+	err := s.view(ctx, func(tx *kv.Tx) error {
+		c := tx.Bucket(bucketIDs).Cursor()
+		k, v := c.Seek([]byte(id))
+		if k == nil || !bytes.HasPrefix(k, []byte(id)) {
+			return handlers.ErrNotFound
+		}
+		if string(k) != id {
+			if next, _ := c.Next(); next != nil && bytes.HasPrefix(next, []byte(id)) {
+				return fmt.Errorf("%w: %q", handlers.ErrAmbiguous, id)
+			}
+		}
+		var err error
+		sr, err = loadLive(tx, v, handlers.NowFrom(ctx))
+		return err
+	})
+	return sr, err
+}
+
+func (s *Store) Delete(ctx context.Context, value string) error {
+	return s.update(ctx, func(tx *kv.Tx) error {
+		sr, err := load(tx, []byte(value))
+		if err != nil {
+			return err
+		}
+		return deleteResource(tx, sr)
+	})
+}
+
+func (s *Store) DeleteByID(ctx context.Context, id string) error {
+	return s.update(ctx, func(tx *kv.Tx) error {
+		value := tx.Bucket(bucketIDs).Get([]byte(id))
+		if value == nil {
+			return handlers.ErrNotFound
+		}
+		sr, err := load(tx, value)
+		if err != nil {
+			return err
+		}
+		return deleteResource(tx, sr)
+	})
+}
+
+// scan is a key range of one index bucket. The value a key points to
+// follows the first prefixLen bytes.
+type scan struct {
+	bucket     string
+	start, end []byte // end nil for no upper bound
+	prefixLen  int
+}
+
+// plan picks the index range with the fewest keys for filters, counting
+// each candidate in O(log n). The created_at range doubles as the default,
+// since it yields results already in List order. exact reports that every
+// key in the range matches all filters, which with the trash excluded
+// requires the trash to be empty, and requires that nothing has expired at
+// now.
+func plan(tx *kv.Tx, filters map[string]any, now time.Time) (best scan, exact bool) {
+	best = scan{bucket: bucketCreated, prefixLen: 8}
+	if t, ok := filters["created_after"].(time.Time); ok {
+		best.start = timeKey(t)
+	}
+	if t, ok := filters["created_before"].(time.Time); ok {
+		best.end = timeKey(t)
+	}
+	exact = filters["include_deleted"] == true || tx.Bucket(bucketDeleted).Len() == 0
+	if tx.Bucket(bucketExpires).Count(nil, expiredEnd(now)) > 0 {
+		exact = false
+	}
+	for key := range filters {
+		if key != "created_after" && key != "created_before" && key != "include_deleted" {
+			exact = false
+		}
+	}
+	count := func(sc scan) int { return tx.Bucket(sc.bucket).Count(sc.start, sc.end) }
+	bestN := count(best)
+
+	consider := func(sc scan) {
+		if n := count(sc); n < bestN {
+			best, bestN = sc, n
+		}
+	}
+	if filters["deleted"] == true {
+		consider(scan{bucket: bucketDeleted, prefixLen: 8})
+	}
+	if b, ok := filters["is_palindrome"].(bool); ok {
+		k := palinKey(b)
+		consider(scan{bucketPalindrome, k, []byte{k[0] + 1}, 1})
+	}
+	if n, ok := filters["word_count"].(int); ok {
+		consider(scan{bucketWordCount, u64(n), u64(n + 1), 8})
+	}
+	if ch, ok := filters["contains_character"].(string); ok {
+		end := charKey(ch)
+		end[len(end)-1] = 1
+		consider(scan{bucketChar, charKey(ch), end, len(ch) + 1})
+	}
+	if tag, ok := filters["tag"].(string); ok {
+		end := charKey(tag)
+		end[len(end)-1] = 1
+		consider(scan{bucketTag, charKey(tag), end, len(tag) + 1})
+	}
+	minLen, hasMin := filters["min_length"].(int)
+	maxLen, hasMax := filters["max_length"].(int)
+	if hasMin || hasMax {
+		sc := scan{bucket: bucketLength, start: u64(max(minLen, 0)), prefixLen: 8}
+		if hasMax {
+			// u64 of maxLen+1 stays above every length even when it
+			// overflows, and a negative maxLen yields an empty range
+			sc.end = u64(maxLen + 1)
+		}
+		consider(sc)
+	}
+	if best.bucket != bucketCreated {
+		exact = false
+	}
+	return best, exact
+}
+
+// each calls fn with the value of every key in sc, stopping when fn
+// returns false.
+func (sc scan) each(tx *kv.Tx, skip int, fn func(value []byte) bool) {
+	c := tx.Bucket(sc.bucket).Cursor()
+	for k, _ := c.Seek(sc.start); k != nil; k, _ = c.Next() {
+		if sc.end != nil && bytes.Compare(k, sc.end) >= 0 {
+			return
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if !fn(k[sc.prefixLen:]) {
+			return
+		}
+	}
+}
+
+// List returns matches ordered by creation time, then value.
+func (s *Store) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	var page []handlers.StringResource
+	var total int
+	err := s.view(ctx, func(tx *kv.Tx) error {
+		now := handlers.NowFrom(ctx)
+		sc, exact := plan(tx, filters, now)
+		var err error
+		if exact {
+			// Every key matches, so skip straight to the page
+			total = tx.Bucket(sc.bucket).Count(sc.start, sc.end)
+			sc.each(tx, offset, func(value []byte) bool {
+				var sr *handlers.StringResource
+				if sr, err = load(tx, value); err != nil {
+					return false
+				}
+				page = append(page, *sr)
+				return len(page) < limit
+			})
+			return err
+		}
+
+		var matched []handlers.StringResource
+		sc.each(tx, 0, func(value []byte) bool {
+			var sr *handlers.StringResource
+			if sr, err = load(tx, value); err != nil {
+				return false
+			}
+			if handlers.MatchesFilters(sr, filters, now) {
+				matched = append(matched, *sr)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if sc.bucket != bucketCreated {
+			sort.Slice(matched, func(i, j int) bool {
+				a, b := matched[i], matched[j]
+				if !a.CreatedAt.Equal(b.CreatedAt) {
+					return a.CreatedAt.Before(b.CreatedAt)
+				}
+				return a.Value < b.Value
+			})
+		}
+		total = len(matched)
+		offset = min(offset, total)
+		page = matched[offset:min(offset+limit, total)]
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, total, nil
+}
+
+// ListStale implements handlers.ReanalysisStore.
+func (s *Store) ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]handlers.StringResource, int, error) {
+	var stale []handlers.StringResource
+	err := s.view(ctx, func(tx *kv.Tx) error {
+		now := handlers.NowFrom(ctx)
+		c := tx.Bucket(bucketVersion).Cursor()
+		end := u64(version)
+		for k, v := c.First(); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			sr, err := load(tx, v)
+			if err != nil {
+				return err
+			}
+			if handlers.MatchesFilters(sr, filters, now) {
+				stale = append(stale, *sr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].ID < stale[j].ID })
+	total := len(stale)
+	i := sort.Search(total, func(i int) bool { return stale[i].ID > afterID })
+	return stale[i:min(i+limit, total)], total, nil
+}
+
+// UpdateProperties implements handlers.ReanalysisStore.
+func (s *Store) UpdateProperties(ctx context.Context, sr *handlers.StringResource) error {
+	return s.update(ctx, func(tx *kv.Tx) error {
+		value := tx.Bucket(bucketIDs).Get([]byte(sr.ID))
+		if value == nil {
+			return handlers.ErrNotFound
+		}
+		old, err := load(tx, value)
+		if err != nil {
+			return err
+		}
+		if err := deleteResource(tx, old); err != nil {
+			return err
+		}
+		updated := *old
+		updated.Properties = sr.Properties
+		updated.AnalyzerVersion = sr.AnalyzerVersion
+		return putResource(tx, &updated)
+	})
+}
+
+// Trash implements handlers.TrashStore.
+func (s *Store) Trash(ctx context.Context, value string, at time.Time) error {
+	return s.update(ctx, func(tx *kv.Tx) error {
+		sr, err := loadLive(tx, []byte(value), handlers.NowFrom(ctx))
+		if err == nil && sr.DeletedAt != nil {
+			err = handlers.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		sr.DeletedAt = &at
+		return putResource(tx, sr)
+	})
+}
+
+// Restore implements handlers.TrashStore.
+func (s *Store) Restore(ctx context.Context, value string) (*handlers.StringResource, error) {
+	var sr *handlers.StringResource
+	err := s.update(ctx, func(tx *kv.Tx) error {
+		var err error
+		sr, err = loadLive(tx, []byte(value), handlers.NowFrom(ctx))
+		if err == nil && sr.DeletedAt == nil {
+			err = handlers.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketDeleted).Delete(append(timeKey(*sr.DeletedAt), value...)); err != nil {
+			return err
+		}
+		sr.DeletedAt = nil
+		return putResource(tx, sr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// Purge implements handlers.TrashStore. The trash index is ordered by
+// deletion time, so only the expired prefix is read.
+func (s *Store) Purge(ctx context.Context, before time.Time) (int, error) {
+	n := 0
+	err := s.update(ctx, func(tx *kv.Tx) error {
+		var expired [][]byte
+		scan{bucket: bucketDeleted, end: timeKey(before), prefixLen: 8}.each(tx, 0, func(value []byte) bool {
+			expired = append(expired, value)
+			return true
+		})
+		n = len(expired)
+		return deleteValues(tx, expired)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// deleteValues deletes the resources stored under values.
+func deleteValues(tx *kv.Tx, values [][]byte) error {
+	for _, value := range values {
+		sr, err := load(tx, value)
+		if err != nil {
+			return err
+		}
+		if err := deleteResource(tx, sr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFirst deletes the resources behind the first limit keys of sc
+// whose values pass keep, and returns how many it deleted.
+func deleteFirst(tx *kv.Tx, sc scan, limit int, keep func(value []byte) bool) (int, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+	var values [][]byte
+	sc.each(tx, 0, func(value []byte) bool {
+		if keep == nil || keep(value) {
+			values = append(values, value)
+		}
+		return len(values) < limit
+	})
+	return len(values), deleteValues(tx, values)
+}
+
+// DeleteExpired implements handlers.RetentionStore by reading the expired
+// prefix of the expiry index.
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	n := 0
+	err := s.update(ctx, func(tx *kv.Tx) (err error) {
+		n, err = deleteFirst(tx, scan{bucket: bucketExpires, end: expiredEnd(now), prefixLen: 8}, limit, nil)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// DeleteCreatedBefore implements handlers.RetentionStore.
+func (s *Store) DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	n := 0
+	err := s.update(ctx, func(tx *kv.Tx) (err error) {
+		n, err = deleteFirst(tx, scan{bucket: bucketCreated, end: timeKey(cutoff), prefixLen: 8}, limit, nil)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// DeleteOldest implements handlers.RetentionStore.
+func (s *Store) DeleteOldest(ctx context.Context, keep, limit int) (int, error) {
+	now := handlers.NowFrom(ctx)
+	n := 0
+	err := s.update(ctx, func(tx *kv.Tx) (err error) {
+		live := tx.Bucket(bucketStrings).Len() - tx.Bucket(bucketExpires).Count(nil, expiredEnd(now))
+		n, err = deleteFirst(tx, scan{bucket: bucketCreated, prefixLen: 8}, min(live-keep, limit), func(value []byte) bool {
+			_, err := loadLive(tx, value, now)
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Annotate implements handlers.AnnotationStore.
+func (s *Store) Annotate(ctx context.Context, value string, patch handlers.AnnotationPatch) (*handlers.StringResource, error) {
+	var sr *handlers.StringResource
+	err := s.update(ctx, func(tx *kv.Tx) error {
+		old, err := loadLive(tx, []byte(value), handlers.NowFrom(ctx))
+		if err == nil && old.DeletedAt != nil {
+			err = handlers.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := deleteResource(tx, old); err != nil {
+			return err
+		}
+		updated := *old
+		if err := patch.Apply(&updated); err != nil {
+			return err
+		}
+		sr = &updated
+		return putResource(tx, sr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// TagCounts implements handlers.AnnotationStore by walking the tag index,
+// which groups the keys of each tag together.
+func (s *Store) TagCounts(ctx context.Context) ([]handlers.TagCount, error) {
+	var counts []handlers.TagCount
+	err := s.view(ctx, func(tx *kv.Tx) error {
+		now := handlers.NowFrom(ctx)
+		c := tx.Bucket(bucketTag).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			i := bytes.IndexByte(k, 0)
+			sr, err := load(tx, k[i+1:])
+			if err != nil {
+				return err
+			}
+			if sr.DeletedAt != nil || handlers.Expired(sr, now) {
+				continue
+			}
+			if tag := string(k[:i]); len(counts) > 0 && counts[len(counts)-1].Tag == tag {
+				counts[len(counts)-1].Count++
+			} else {
+				counts = append(counts, handlers.TagCount{Tag: tag, Count: 1})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	handlers.SortTagCounts(counts)
+	return counts, nil
+}
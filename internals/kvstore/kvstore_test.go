@@ -0,0 +1,133 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/kv"
+	"github.com/kodevoid/string_analyzer/internals/storetest"
+)
+
+func openTest(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path, kv.Options{NoSync: true})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.StringStore {
+		return openTest(t, filepath.Join(t.TempDir(), "strings.kv"))
+	})
+}
+
+func newResource(value string, at time.Time) *handlers.StringResource {
+	props := handlers.ComputeProperties(value)
+	return &handlers.StringResource{ID: props.SHA256Hash, Value: value, Properties: props, CreatedAt: at, AnalyzerVersion: handlers.AnalyzerVersion}
+}
+
+// TestPlan checks that List scans the smallest index range and only uses
+// the exact (no decode, skip to offset) path when every filter is covered.
+func TestPlan(t *testing.T) {
+	s := openTest(t, filepath.Join(t.TempDir(), "strings.kv"))
+	ctx := context.Background()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 200 {
+		v := fmt.Sprintf("value %03d", i)
+		if i%50 == 0 {
+			v = fmt.Sprintf("x%dx", i) // rare: palindrome, contains 'x'
+		}
+		if err := s.Create(ctx, newResource(v, base.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		filters map[string]any
+		bucket  string
+		exact   bool
+	}{
+		{nil, bucketCreated, true},
+		{map[string]any{"created_after": base.Add(time.Hour)}, bucketCreated, true},
+		{map[string]any{"contains_character": "x"}, bucketChar, false},
+		{map[string]any{"is_palindrome": true, "word_count": 2}, bucketPalindrome, false},
+		{map[string]any{"max_length": 3}, bucketLength, false},
+		{map[string]any{"word_count": 2, "created_after": base.Add(199 * time.Minute)}, bucketCreated, false},
+	}
+	for _, tc := range cases {
+		s.db.View(func(tx *kv.Tx) error {
+			sc, exact := plan(tx, tc.filters, time.Now())
+			if sc.bucket != tc.bucket || exact != tc.exact {
+				t.Errorf("plan(%v) = %s exact=%v, want %s exact=%v", tc.filters, sc.bucket, exact, tc.bucket, tc.exact)
+			}
+			return nil
+		})
+	}
+
+	page, total, err := s.List(ctx, nil, 5, 195)
+	if err != nil || total != 200 || len(page) != 5 || page[0].Value != "value 195" {
+		t.Errorf("exact page = %d items starting %q, total %d, %v", len(page), page[0].Value, total, err)
+	}
+
+	// A non-empty trash must be filtered out, and is the smallest range
+	// when listing it
+	if err := s.Trash(ctx, "value 001", base); err != nil {
+		t.Fatal(err)
+	}
+	trashCases := []struct {
+		filters map[string]any
+		bucket  string
+		exact   bool
+	}{
+		{nil, bucketCreated, false},
+		{map[string]any{"include_deleted": true}, bucketCreated, true},
+		{map[string]any{"deleted": true}, bucketDeleted, false},
+	}
+	for _, tc := range trashCases {
+		s.db.View(func(tx *kv.Tx) error {
+			sc, exact := plan(tx, tc.filters, time.Now())
+			if sc.bucket != tc.bucket || exact != tc.exact {
+				t.Errorf("plan(%v) = %s exact=%v, want %s exact=%v", tc.filters, sc.bucket, exact, tc.bucket, tc.exact)
+			}
+			return nil
+		})
+	}
+	if _, total, _ := s.List(ctx, nil, 5, 0); total != 199 {
+		t.Errorf("total with one trashed = %d, want 199", total)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strings.kv")
+	ctx := context.Background()
+	s := openTest(t, path)
+	for _, v := range []string{"racecar", "hello", "noon"} {
+		if err := s.Create(ctx, newResource(v, time.Now().UTC())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := s.Get(ctx, "noon"); !errors.Is(err, handlers.ErrUnavailable) {
+		t.Errorf("Get after Close: expected ErrUnavailable, got %v", err)
+	}
+
+	s = openTest(t, path)
+	page, total, err := s.List(ctx, map[string]any{"is_palindrome": true}, 10, 0)
+	if err != nil || total != 2 || len(page) != 2 {
+		t.Errorf("palindromes after reopen = %d, total %d, %v; want 2", len(page), total, err)
+	}
+	if _, err := s.Get(ctx, "hello"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("deleted value after reopen: %v", err)
+	}
+}
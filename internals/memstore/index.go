@@ -0,0 +1,209 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// set holds string values, the store's primary key.
+type set map[string]struct{}
+
+func (s set) add(v string)    { s[v] = struct{}{} }
+func (s set) remove(v string) { delete(s, v) }
+
+// createdKey orders resources by creation time, then value.
+type createdKey struct {
+	at    time.Time
+	value string
+}
+
+func (k createdKey) less(o createdKey) bool {
+	if !k.at.Equal(o.at) {
+		return k.at.Before(o.at)
+	}
+	return k.value < o.value
+}
+
+// indexes are the secondary indexes over the stored resources, one per list
+// filter plus ID prefixes, analyzer versions, the trash and expiring values.
+// Metadata filters have no index and are checked on the candidates.
+type indexes struct {
+	byIDPrefix  map[string]set // first handlers.MinIDPrefix characters of the ID
+	byLength    map[int]set
+	byWordCount map[int]set
+	byPalin     map[bool]set
+	byChar      map[string]set
+	byVersion   map[int]set
+	byTag       map[string]set
+	byDeleted   set // values in the trash
+	byExpiring  set // values with an expiry time
+	// byCreated is kept sorted; inserts at the end (the common case) are O(1)
+	byCreated []createdKey
+}
+
+func newIndexes() *indexes {
+	return &indexes{
+		byIDPrefix:  make(map[string]set),
+		byLength:    make(map[int]set),
+		byWordCount: make(map[int]set),
+		byPalin:     map[bool]set{true: {}, false: {}},
+		byChar:      make(map[string]set),
+		byVersion:   make(map[int]set),
+		byTag:       make(map[string]set),
+		byDeleted:   make(set),
+		byExpiring:  make(set),
+	}
+}
+
+func addTo[K comparable](m map[K]set, k K, v string) {
+	s, ok := m[k]
+	if !ok {
+		s = make(set)
+		m[k] = s
+	}
+	s.add(v)
+}
+
+func removeFrom[K comparable](m map[K]set, k K, v string) {
+	if s, ok := m[k]; ok {
+		s.remove(v)
+		if len(s) == 0 {
+			delete(m, k)
+		}
+	}
+}
+
+func idPrefix(id string) string {
+	if len(id) > handlers.MinIDPrefix {
+		return id[:handlers.MinIDPrefix]
+	}
+	return id
+}
+
+func (ix *indexes) add(sr *handlers.StringResource) {
+	v := sr.Value
+	addTo(ix.byIDPrefix, idPrefix(sr.ID), v)
+	addTo(ix.byLength, sr.Properties.Length, v)
+	addTo(ix.byWordCount, sr.Properties.WordCount, v)
+	ix.byPalin[sr.Properties.IsPalindrome].add(v)
+	for ch := range sr.Properties.CharacterFrequencyMap {
+		addTo(ix.byChar, ch, v)
+	}
+	addTo(ix.byVersion, sr.AnalyzerVersion, v)
+	for _, tag := range sr.Tags {
+		addTo(ix.byTag, tag, v)
+	}
+	if sr.DeletedAt != nil {
+		ix.byDeleted.add(v)
+	}
+	if sr.ExpiresAt != nil {
+		ix.byExpiring.add(v)
+	}
+
+	key := createdKey{sr.CreatedAt, v}
+	n := len(ix.byCreated)
+	if n == 0 || ix.byCreated[n-1].less(key) {
+		ix.byCreated = append(ix.byCreated, key)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return key.less(ix.byCreated[i]) })
+	ix.byCreated = append(ix.byCreated, createdKey{})
+	copy(ix.byCreated[i+1:], ix.byCreated[i:])
+	ix.byCreated[i] = key
+}
+
+func (ix *indexes) remove(sr *handlers.StringResource) {
+	v := sr.Value
+	removeFrom(ix.byIDPrefix, idPrefix(sr.ID), v)
+	removeFrom(ix.byLength, sr.Properties.Length, v)
+	removeFrom(ix.byWordCount, sr.Properties.WordCount, v)
+	ix.byPalin[sr.Properties.IsPalindrome].remove(v)
+	for ch := range sr.Properties.CharacterFrequencyMap {
+		removeFrom(ix.byChar, ch, v)
+	}
+	removeFrom(ix.byVersion, sr.AnalyzerVersion, v)
+	for _, tag := range sr.Tags {
+		removeFrom(ix.byTag, tag, v)
+	}
+	ix.byDeleted.remove(v)
+	ix.byExpiring.remove(v)
+
+	key := createdKey{sr.CreatedAt, v}
+	i := sort.Search(len(ix.byCreated), func(i int) bool { return !ix.byCreated[i].less(key) })
+	if i < len(ix.byCreated) && ix.byCreated[i] == key {
+		ix.byCreated = append(ix.byCreated[:i], ix.byCreated[i+1:]...)
+	}
+}
+
+// createdRange returns the sub-slice of byCreated within the created_after
+// (inclusive) and created_before (exclusive) filters.
+func (ix *indexes) createdRange(filters map[string]any) []createdKey {
+	keys := ix.byCreated
+	if after, ok := filters["created_after"].(time.Time); ok {
+		i := sort.Search(len(keys), func(i int) bool { return !keys[i].at.Before(after) })
+		keys = keys[i:]
+	}
+	if before, ok := filters["created_before"].(time.Time); ok {
+		i := sort.Search(len(keys), func(i int) bool { return !keys[i].at.Before(before) })
+		keys = keys[:i]
+	}
+	return keys
+}
+
+// candidates picks the most selective index for filters and returns the
+// values it yields, or ok=false when scanning byCreated in order is at least
+// as cheap. Every candidate still has to be checked against all filters.
+func (ix *indexes) candidates(filters map[string]any) (values []string, ok bool) {
+	best := len(ix.createdRange(filters))
+	var sets []set
+	chosen := false
+
+	consider := func(ss ...set) {
+		n := 0
+		for _, s := range ss {
+			n += len(s)
+		}
+		if n < best {
+			best, sets, chosen = n, ss, true
+		}
+	}
+	if filters["deleted"] == true {
+		consider(ix.byDeleted)
+	}
+	if b, ok := filters["is_palindrome"].(bool); ok {
+		consider(ix.byPalin[b])
+	}
+	if n, ok := filters["word_count"].(int); ok {
+		consider(ix.byWordCount[n])
+	}
+	if ch, ok := filters["contains_character"].(string); ok {
+		consider(ix.byChar[ch])
+	}
+	if tag, ok := filters["tag"].(string); ok {
+		consider(ix.byTag[tag])
+	}
+	minLen, hasMin := filters["min_length"].(int)
+	maxLen, hasMax := filters["max_length"].(int)
+	if hasMin || hasMax {
+		var ss []set
+		for length, s := range ix.byLength {
+			if (!hasMin || length >= minLen) && (!hasMax || length <= maxLen) {
+				ss = append(ss, s)
+			}
+		}
+		consider(ss...)
+	}
+
+	if !chosen {
+		return nil, false
+	}
+	values = make([]string, 0, best)
+	for _, s := range sets {
+		for v := range s {
+			values = append(values, v)
+		}
+	}
+	return values, true
+}
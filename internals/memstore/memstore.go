@@ -0,0 +1,510 @@
+// Package memstore is an in-memory handlers.StringStore for ephemeral,
+// high-throughput instances. Every list filter has a secondary index, and
+// with Options.Dir set the contents survive restarts through periodic
+// snapshots plus a write-ahead log of the changes made since.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// Store implements handlers.StringStore, handlers.ReanalysisStore,
+// handlers.TrashStore, handlers.RetentionStore, handlers.AnnotationStore and
+// handlers.NamespaceStore. Resources are keyed by value and returned as
+// copies, so callers cannot modify stored data. Each namespace is a Store
+// of its own; the one returned by New or Open is the default namespace.
+type Store struct {
+	mu    sync.RWMutex
+	items map[string]*handlers.StringResource // by value
+	byID  map[string]*handlers.StringResource
+	idx   *indexes
+	ns    handlers.Namespace // Count is not kept up to date
+	gone  bool               // the namespace has been deleted
+
+	spaces  *spaces
+	persist *persistence // nil for a purely in-memory store
+}
+
+// New returns an empty store without persistence.
+func New() *Store {
+	s := newStore(handlers.Namespace{Name: handlers.DefaultNamespace, CreatedAt: time.Now().UTC()})
+	s.spaces = newSpaces(s, Options{})
+	return s
+}
+
+// newStore returns an empty store for namespace ns, without persistence or
+// a namespace registry.
+func newStore(ns handlers.Namespace) *Store {
+	return &Store{
+		items: make(map[string]*handlers.StringResource),
+		byID:  make(map[string]*handlers.StringResource),
+		idx:   newIndexes(),
+		ns:    ns,
+	}
+}
+
+// clone copies sr including its character map, deletion and expiry times,
+// tags and metadata.
+func clone(sr *handlers.StringResource) *handlers.StringResource {
+	c := *sr
+	c.Tags = slices.Clone(sr.Tags)
+	c.Metadata = handlers.CloneMetadata(sr.Metadata)
+	if sr.DeletedAt != nil {
+		at := *sr.DeletedAt
+		c.DeletedAt = &at
+	}
+	if sr.ExpiresAt != nil {
+		at := *sr.ExpiresAt
+		c.ExpiresAt = &at
+	}
+	c.Properties.CharacterFrequencyMap = make(map[string]int, len(sr.Properties.CharacterFrequencyMap))
+	for k, v := range sr.Properties.CharacterFrequencyMap {
+		c.Properties.CharacterFrequencyMap[k] = v
+	}
+	return &c
+}
+
+// put stores sr, replacing any resource with the same value. Callers hold mu.
+func (s *Store) put(sr *handlers.StringResource) {
+	if old, ok := s.items[sr.Value]; ok {
+		s.idx.remove(old)
+		delete(s.byID, old.ID)
+	}
+	s.items[sr.Value] = sr
+	s.byID[sr.ID] = sr
+	s.idx.add(sr)
+}
+
+// lookup returns the resource with value unless it has expired at now.
+// Callers hold mu.
+func (s *Store) lookup(value string, now time.Time) (*handlers.StringResource, bool) {
+	sr, ok := s.items[value]
+	if !ok || handlers.Expired(sr, now) {
+		return nil, false
+	}
+	return sr, true
+}
+
+// remove deletes the resource with value, reporting whether it existed.
+// Callers hold mu.
+func (s *Store) remove(value string) bool {
+	sr, ok := s.items[value]
+	if !ok {
+		return false
+	}
+	s.idx.remove(sr)
+	delete(s.items, value)
+	delete(s.byID, sr.ID)
+	return true
+}
+
+func (s *Store) Create(ctx context.Context, sr *handlers.StringResource) error {
+	_, created, err := s.CreateIfAbsent(ctx, sr)
+	if err == nil && !created {
+		return handlers.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gone {
+		return nil, false, fmt.Errorf("%w: namespace %q does not exist", handlers.ErrNotFound, s.ns.Name)
+	}
+	if existing, ok := s.lookup(sr.Value, handlers.NowFrom(ctx)); ok {
+		return clone(existing), false, nil
+	}
+	if limit := s.ns.MaxStrings; limit > 0 && s.count(handlers.NowFrom(ctx)) >= limit {
+		return nil, false, fmt.Errorf("%w: namespace %q holds at most %d strings", handlers.ErrQuotaExceeded, s.ns.Name, limit)
+	}
+	// An expired resource with this value is replaced by put
+	if old, ok := s.byID[sr.ID]; ok && old.Value != sr.Value {
+		return nil, false, fmt.Errorf("%w: duplicate id %s", handlers.ErrConflict, sr.ID)
+	}
+	stored := clone(sr)
+	if err := s.logPut(stored); err != nil {
+		return nil, false, err
+	}
+	s.put(stored)
+	return sr, true, nil
+}
+
+func (s *Store) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sr, ok := s.lookup(value, handlers.NowFrom(ctx))
+	if !ok {
+		return nil, handlers.ErrNotFound
+	}
+	return clone(sr), nil
+}
+
+func (s *Store) Exists(ctx context.Context, value string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.lookup(value, handlers.NowFrom(ctx))
+	return ok, nil
+}
+
+func (s *Store) GetByID(ctx context.Context, id string) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := handlers.NowFrom(ctx)
+	if sr, ok := s.byID[id]; ok && !handlers.Expired(sr, now) {
+		return clone(sr), nil
+	}
+	// Prefixes of at least MinIDPrefix characters only need one bucket
+	var found *handlers.StringResource
+	check := func(sr *handlers.StringResource) error {
+		if !strings.HasPrefix(sr.ID, id) || handlers.Expired(sr, now) {
+			return nil
+		}
+		if found != nil {
+			return fmt.Errorf("%w: %q", handlers.ErrAmbiguous, id)
+		}
+		found = sr
+		return nil
+	}
+	if len(id) >= handlers.MinIDPrefix {
+		for v := range s.idx.byIDPrefix[id[:handlers.MinIDPrefix]] {
+			if err := check(s.items[v]); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, sr := range s.items {
+			if err := check(sr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if found == nil {
+		return nil, handlers.ErrNotFound
+	}
+	return clone(found), nil
+}
+
+func (s *Store) Delete(ctx context.Context, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[value]; !ok {
+		return handlers.ErrNotFound
+	}
+	if err := s.logDelete(value); err != nil {
+		return err
+	}
+	s.remove(value)
+	return nil
+}
+
+func (s *Store) DeleteByID(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sr, ok := s.byID[id]
+	if !ok {
+		return handlers.ErrNotFound
+	}
+	if err := s.logDelete(sr.Value); err != nil {
+		return err
+	}
+	s.remove(sr.Value)
+	return nil
+}
+
+// List returns matches ordered by creation time, then value.
+func (s *Store) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := handlers.NowFrom(ctx)
+	var matched []*handlers.StringResource
+	if values, ok := s.idx.candidates(filters); ok {
+		for _, v := range values {
+			if sr := s.items[v]; handlers.MatchesFilters(sr, filters, now) {
+				matched = append(matched, sr)
+			}
+		}
+		sort.Slice(matched, func(i, j int) bool {
+			return createdKey{matched[i].CreatedAt, matched[i].Value}.less(createdKey{matched[j].CreatedAt, matched[j].Value})
+		})
+	} else {
+		for _, key := range s.idx.createdRange(filters) {
+			if sr := s.items[key.value]; handlers.MatchesFilters(sr, filters, now) {
+				matched = append(matched, sr)
+			}
+		}
+	}
+
+	total := len(matched)
+	if offset > total {
+		offset = total
+	}
+	end := min(offset+limit, total)
+	page := make([]handlers.StringResource, 0, end-offset)
+	for _, sr := range matched[offset:end] {
+		page = append(page, *clone(sr))
+	}
+	return page, total, nil
+}
+
+// ListStale implements handlers.ReanalysisStore.
+func (s *Store) ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]handlers.StringResource, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := handlers.NowFrom(ctx)
+	var stale []*handlers.StringResource
+	for v, values := range s.idx.byVersion {
+		if v >= version {
+			continue
+		}
+		for value := range values {
+			if sr := s.items[value]; handlers.MatchesFilters(sr, filters, now) {
+				stale = append(stale, sr)
+			}
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].ID < stale[j].ID })
+
+	total := len(stale)
+	i := sort.Search(len(stale), func(i int) bool { return stale[i].ID > afterID })
+	stale = stale[i:min(i+limit, len(stale))]
+	page := make([]handlers.StringResource, len(stale))
+	for i, sr := range stale {
+		page[i] = *clone(sr)
+	}
+	return page, total, nil
+}
+
+// UpdateProperties implements handlers.ReanalysisStore.
+func (s *Store) UpdateProperties(ctx context.Context, sr *handlers.StringResource) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.byID[sr.ID]
+	if !ok {
+		return handlers.ErrNotFound
+	}
+	updated := clone(old)
+	updated.Properties = clone(sr).Properties
+	updated.AnalyzerVersion = sr.AnalyzerVersion
+	if err := s.logPut(updated); err != nil {
+		return err
+	}
+	s.put(updated)
+	return nil
+}
+
+// Trash implements handlers.TrashStore.
+func (s *Store) Trash(ctx context.Context, value string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.lookup(value, handlers.NowFrom(ctx))
+	if !ok || old.DeletedAt != nil {
+		return handlers.ErrNotFound
+	}
+	updated := clone(old)
+	updated.DeletedAt = &at
+	if err := s.logPut(updated); err != nil {
+		return err
+	}
+	s.put(updated)
+	return nil
+}
+
+// Restore implements handlers.TrashStore.
+func (s *Store) Restore(ctx context.Context, value string) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.lookup(value, handlers.NowFrom(ctx))
+	if !ok || old.DeletedAt == nil {
+		return nil, handlers.ErrNotFound
+	}
+	updated := clone(old)
+	updated.DeletedAt = nil
+	if err := s.logPut(updated); err != nil {
+		return nil, err
+	}
+	s.put(updated)
+	return clone(updated), nil
+}
+
+// Purge implements handlers.TrashStore.
+func (s *Store) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []string
+	for v := range s.idx.byDeleted {
+		if s.items[v].DeletedAt.Before(before) {
+			expired = append(expired, v)
+		}
+	}
+	return s.removeAll(expired)
+}
+
+// removeAll permanently deletes values, returning how many it removed
+// before any error. Callers hold mu.
+func (s *Store) removeAll(values []string) (int, error) {
+	for i, v := range values {
+		if err := s.logDelete(v); err != nil {
+			return i, err
+		}
+		s.remove(v)
+	}
+	return len(values), nil
+}
+
+// DeleteExpired implements handlers.RetentionStore.
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []string
+	for v := range s.idx.byExpiring {
+		if len(expired) == limit {
+			break
+		}
+		if handlers.Expired(s.items[v], now) {
+			expired = append(expired, v)
+		}
+	}
+	return s.removeAll(expired)
+}
+
+// DeleteCreatedBefore implements handlers.RetentionStore.
+func (s *Store) DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.idx.createdRange(map[string]any{"created_before": cutoff})
+	return s.removeAll(createdValues(keys[:min(limit, len(keys))]))
+}
+
+// DeleteOldest implements handlers.RetentionStore.
+func (s *Store) DeleteOldest(ctx context.Context, keep, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := handlers.NowFrom(ctx)
+	var live []string
+	for _, key := range s.idx.byCreated {
+		if !handlers.Expired(s.items[key.value], now) {
+			live = append(live, key.value)
+		}
+	}
+	n := min(max(len(live)-keep, 0), limit)
+	return s.removeAll(live[:n])
+}
+
+// createdValues copies the values out of keys, which removal would shift.
+func createdValues(keys []createdKey) []string {
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = k.value
+	}
+	return values
+}
+
+// Annotate implements handlers.AnnotationStore.
+func (s *Store) Annotate(ctx context.Context, value string, patch handlers.AnnotationPatch) (*handlers.StringResource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.lookup(value, handlers.NowFrom(ctx))
+	if !ok || old.DeletedAt != nil {
+		return nil, handlers.ErrNotFound
+	}
+	updated := clone(old)
+	if err := patch.Apply(updated); err != nil {
+		return nil, err
+	}
+	if err := s.logPut(updated); err != nil {
+		return nil, err
+	}
+	s.put(updated)
+	return clone(updated), nil
+}
+
+// TagCounts implements handlers.AnnotationStore.
+func (s *Store) TagCounts(ctx context.Context) ([]handlers.TagCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := handlers.NowFrom(ctx)
+	var counts []handlers.TagCount
+	for tag, values := range s.idx.byTag {
+		n := 0
+		for v := range values {
+			if sr := s.items[v]; sr.DeletedAt == nil && !handlers.Expired(sr, now) {
+				n++
+			}
+		}
+		if n > 0 {
+			counts = append(counts, handlers.TagCount{Tag: tag, Count: n})
+		}
+	}
+	handlers.SortTagCounts(counts)
+	return counts, nil
+}
+
+// Len returns the number of stored resources.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
@@ -0,0 +1,278 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.StringStore { return New() })
+}
+
+func TestPersistentConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.StringStore {
+		s, err := Open(Options{Dir: t.TempDir(), SnapshotInterval: -1})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+var base = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newResource(value string, at time.Time) *handlers.StringResource {
+	props := handlers.ComputeProperties(value)
+	return &handlers.StringResource{ID: props.SHA256Hash, Value: value, Properties: props, CreatedAt: at, AnalyzerVersion: handlers.AnalyzerVersion}
+}
+
+func fill(t *testing.T, s *Store, values ...string) {
+	t.Helper()
+	for i, v := range values {
+		if err := s.Create(context.Background(), newResource(v, base.Add(time.Duration(i)*time.Hour))); err != nil {
+			t.Fatalf("Create(%q): %v", v, err)
+		}
+	}
+}
+
+func values(page []handlers.StringResource) string {
+	vs := make([]string, len(page))
+	for i, sr := range page {
+		vs[i] = sr.Value
+	}
+	return strings.Join(vs, ",")
+}
+
+// TestListFilters checks that whichever index List picks, results match a
+// full scan and come back in creation order.
+func TestListFilters(t *testing.T) {
+	s := New()
+	fill(t, s, "racecar", "hello world", "level", "a", "noon", "the quick brown dog", "xyz", "step on no pets")
+
+	cases := []struct {
+		name    string
+		filters map[string]any
+		want    string
+	}{
+		{"none", nil, "racecar,hello world,level,a,noon,the quick brown dog,xyz,step on no pets"},
+		{"palindrome", map[string]any{"is_palindrome": true}, "racecar,level,a,noon,step on no pets"},
+		{"length range", map[string]any{"min_length": 4, "max_length": 7}, "racecar,level,noon"},
+		{"word count", map[string]any{"word_count": 2}, "hello world"},
+		{"contains", map[string]any{"contains_character": "o"}, "hello world,noon,the quick brown dog,step on no pets"},
+		{"created window", map[string]any{"created_after": base.Add(2 * time.Hour), "created_before": base.Add(5 * time.Hour)}, "level,a,noon"},
+		{"combined", map[string]any{"is_palindrome": true, "contains_character": "o", "word_count": 1}, "noon"},
+		{"no match", map[string]any{"contains_character": "§"}, ""},
+		{"no length match", map[string]any{"min_length": 50}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, total, err := s.List(context.Background(), tc.filters, 100, 0)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if got := values(page); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			if total != len(page) {
+				t.Errorf("total = %d, want %d", total, len(page))
+			}
+		})
+	}
+
+	page, total, _ := s.List(context.Background(), map[string]any{"is_palindrome": true}, 2, 1)
+	if got := values(page); got != "level,a" || total != 5 {
+		t.Errorf("paged list = %q (total %d), want \"level,a\" (total 5)", got, total)
+	}
+
+	// An index that selects nothing must not fall back to a full scan
+	if vs, ok := s.idx.candidates(map[string]any{"min_length": 50}); !ok || len(vs) != 0 {
+		t.Errorf("candidates for an empty length range = %v, %v; want [], true", vs, ok)
+	}
+}
+
+func TestIndexesFollowWrites(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	fill(t, s, "noon", "moon")
+
+	if err := s.Delete(ctx, "noon"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	page, _, _ := s.List(ctx, map[string]any{"contains_character": "n"}, 10, 0)
+	if got := values(page); got != "moon" {
+		t.Errorf("contains n after delete = %q, want \"moon\"", got)
+	}
+	if len(s.idx.byCreated) != 1 || len(s.idx.byPalin[true]) != 0 {
+		t.Errorf("stale index entries after delete: %+v", s.idx)
+	}
+
+	// A copy returned by Get must not alias the stored map
+	sr, _ := s.Get(ctx, "moon")
+	sr.Properties.CharacterFrequencyMap["z"] = 1
+	page, _, _ = s.List(ctx, map[string]any{"contains_character": "z"}, 10, 0)
+	if len(page) != 0 {
+		t.Error("mutating a returned resource changed the store")
+	}
+}
+
+func TestGetByIDPrefix(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+	sr := newResource("hello", base)
+	if err := s.Create(ctx, sr); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetByID(ctx, sr.ID[:6])
+	if err != nil || got.Value != "hello" {
+		t.Fatalf("GetByID(prefix) = %v, %v", got, err)
+	}
+
+	// Force a collision on the prefix bucket
+	other := newResource("other", base)
+	other.ID = sr.ID[:6] + strings.Repeat("0", len(sr.ID)-6)
+	if err := s.Create(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetByID(ctx, sr.ID[:6]); !errors.Is(err, handlers.ErrAmbiguous) {
+		t.Errorf("expected ErrAmbiguous, got %v", err)
+	}
+	if _, err := s.GetByID(ctx, strings.Repeat("f", 64)); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	open := func() *Store {
+		t.Helper()
+		s, err := Open(Options{Dir: dir, SnapshotInterval: -1})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		return s
+	}
+
+	s := open()
+	fill(t, s, "racecar", "hello", "noon")
+	if err := s.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	// These only reach the WAL
+	if err := s.Delete(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	fill(t, s, "level")
+	stale := newResource("racecar", base)
+	stale.AnalyzerVersion = 7
+	if err := s.UpdateProperties(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash: drop the store without Close, leaving a torn record
+	s.persist.wal.Write([]byte(`{"op":"put","resource":{"id":"ab`))
+	s.persist.wal.Close()
+
+	s = open()
+	page, total, _ := s.List(ctx, nil, 10, 0)
+	if got := values(page); got != "level,racecar,noon" || total != 3 {
+		t.Errorf("after replay got %q (total %d), want \"level,racecar,noon\"", got, total)
+	}
+	if sr, _ := s.Get(ctx, "racecar"); sr.AnalyzerVersion != 7 {
+		t.Errorf("analyzer version after replay = %d, want 7", sr.AnalyzerVersion)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, walFile)); err != nil || fi.Size() != 0 {
+		t.Errorf("WAL not truncated by Close: %v, %v", fi, err)
+	}
+	if err := s.Create(ctx, newResource("late", base)); !errors.Is(err, handlers.ErrUnavailable) {
+		t.Errorf("Create after Close: expected ErrUnavailable, got %v", err)
+	}
+
+	s = open()
+	defer s.Close()
+	if s.Len() != 3 {
+		t.Errorf("Len after reopening from snapshot = %d, want 3", s.Len())
+	}
+}
+
+func TestCorruptWAL(t *testing.T) {
+	dir := t.TempDir()
+	wal := `{"op":"put","resource":{"id":"1","value":"a"}}` + "\n" + "not json\n" + `{"op":"delete","value":"a"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, walFile), []byte(wal), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(Options{Dir: dir}); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+}
+
+func TestNamespacePersistence(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	open := func() *Store {
+		t.Helper()
+		s, err := Open(Options{Dir: dir, SnapshotInterval: -1})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		return s
+	}
+
+	s := open()
+	for _, name := range []string{"acme", "beta"} {
+		if err := s.CreateNamespace(ctx, handlers.Namespace{Name: name, MaxStrings: 5, CreatedAt: base}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fill(t, s, "racecar")
+	fill(t, s.In("acme").(*Store), "racecar", "noon")
+	if _, err := s.SetNamespaceQuota(ctx, "acme", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s = open()
+	if err := s.DeleteNamespace(ctx, "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, namespacesDir, "beta")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("deleted namespace directory still exists: %v", err)
+	}
+	// Left by a crash during a create or delete
+	if err := os.MkdirAll(filepath.Join(dir, namespacesDir, ".gamma"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s = open()
+	defer s.Close()
+	list, err := s.ListNamespaces(ctx)
+	if err != nil || len(list) != 2 || list[0].Name != "acme" || list[1].Name != handlers.DefaultNamespace {
+		t.Fatalf("ListNamespaces after reopening = %+v, %v; want acme and default", list, err)
+	}
+	if list[0].MaxStrings != 2 || list[0].Count != 2 || list[1].Count != 1 {
+		t.Errorf("namespaces after reopening = %+v, want acme with quota 2 and 2 strings", list)
+	}
+	if err := s.In("acme").Create(ctx, newResource("level", base)); !errors.Is(err, handlers.ErrQuotaExceeded) {
+		t.Errorf("Create beyond the persisted quota: expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, namespacesDir, ".gamma")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("leftover namespace directory not removed: %v", err)
+	}
+}
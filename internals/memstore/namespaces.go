@@ -0,0 +1,282 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// spaces is the namespace registry shared by the default namespace's store
+// and the stores of all other namespaces.
+type spaces struct {
+	mu     sync.Mutex
+	root   *Store
+	opts   Options // Dir is empty without persistence
+	byName map[string]*Store
+}
+
+func newSpaces(root *Store, opts Options) *spaces {
+	return &spaces{root: root, opts: opts, byName: make(map[string]*Store)}
+}
+
+// dir returns the directory of namespace name.
+func (sp *spaces) dir(name string) string {
+	return filepath.Join(sp.opts.Dir, namespacesDir, name)
+}
+
+// load opens every namespace persisted under opts.Dir. Directories starting
+// with "." are left over from an interrupted create or delete and are
+// removed.
+func (sp *spaces) load() error {
+	entries, err := os.ReadDir(filepath.Join(sp.opts.Dir, namespacesDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), ".") {
+			if err := os.RemoveAll(sp.dir(e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		sub, err := open(sp.dir(e.Name()), sp.opts, e.Name())
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		sub.spaces = sp
+		sp.byName[e.Name()] = sub
+	}
+	return nil
+}
+
+// find returns the store of namespace name, or nil.
+func (sp *spaces) find(name string) *Store {
+	if name == handlers.DefaultNamespace {
+		return sp.root
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.byName[name]
+}
+
+// readNamespace reads dir's namespaceFile, writing one for name if it is
+// missing.
+func readNamespace(dir, name string) (handlers.Namespace, error) {
+	data, err := os.ReadFile(filepath.Join(dir, namespaceFile))
+	if errors.Is(err, os.ErrNotExist) {
+		ns := handlers.Namespace{Name: name, CreatedAt: time.Now().UTC()}
+		return ns, writeNamespace(dir, ns)
+	}
+	if err != nil {
+		return handlers.Namespace{}, err
+	}
+	var ns handlers.Namespace
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return handlers.Namespace{}, err
+	}
+	return ns, nil
+}
+
+// writeNamespace atomically replaces dir's namespaceFile with ns.
+func writeNamespace(dir string, ns handlers.Namespace) error {
+	ns.Count = 0
+	data, err := json.Marshal(ns)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, namespaceFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// count returns how many resources count against the quota: all but the
+// expired ones. Callers hold mu.
+func (s *Store) count(now time.Time) int {
+	n := len(s.items)
+	for v := range s.idx.byExpiring {
+		if handlers.Expired(s.items[v], now) {
+			n--
+		}
+	}
+	return n
+}
+
+// info returns the store's namespace with its Count at now.
+func (s *Store) info(now time.Time) *handlers.Namespace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ns := s.ns
+	ns.Count = s.count(now)
+	return &ns
+}
+
+// In implements handlers.NamespaceStore. A namespace that does not exist
+// gets an empty store that refuses writes.
+func (s *Store) In(name string) handlers.StringStore {
+	if sub := s.spaces.find(name); sub != nil {
+		return sub
+	}
+	missing := newStore(handlers.Namespace{Name: name})
+	missing.gone = true
+	missing.spaces = s.spaces
+	return missing
+}
+
+// CreateNamespace implements handlers.NamespaceStore. With persistence the
+// namespace directory is prepared under a "." name and renamed into place,
+// so a crash never leaves a half-created namespace.
+func (s *Store) CreateNamespace(ctx context.Context, ns handlers.Namespace) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sp := s.spaces
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if _, ok := sp.byName[ns.Name]; ok || ns.Name == handlers.DefaultNamespace {
+		return handlers.ErrConflict
+	}
+
+	ns.Count = 0
+	sub := newStore(ns)
+	if sp.opts.Dir != "" {
+		dir, tmp := sp.dir(ns.Name), sp.dir("."+ns.Name)
+		if err := os.RemoveAll(tmp); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(tmp, 0o755); err != nil {
+			return err
+		}
+		if err := writeNamespace(tmp, ns); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dir); err != nil {
+			return err
+		}
+		if err := syncDir(filepath.Dir(dir)); err != nil {
+			return err
+		}
+		var err error
+		if sub, err = open(dir, sp.opts, ns.Name); err != nil {
+			return err
+		}
+	}
+	sub.spaces = sp
+	sp.byName[ns.Name] = sub
+	return nil
+}
+
+// GetNamespace implements handlers.NamespaceStore.
+func (s *Store) GetNamespace(ctx context.Context, name string) (*handlers.Namespace, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sub := s.spaces.find(name)
+	if sub == nil {
+		return nil, handlers.ErrNotFound
+	}
+	return sub.info(handlers.NowFrom(ctx)), nil
+}
+
+// ListNamespaces implements handlers.NamespaceStore.
+func (s *Store) ListNamespaces(ctx context.Context) ([]handlers.Namespace, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sp := s.spaces
+	sp.mu.Lock()
+	stores := []*Store{sp.root}
+	for _, sub := range sp.byName {
+		stores = append(stores, sub)
+	}
+	sp.mu.Unlock()
+
+	list := make([]handlers.Namespace, len(stores))
+	for i, sub := range stores {
+		list[i] = *sub.info(handlers.NowFrom(ctx))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// SetNamespaceQuota implements handlers.NamespaceStore.
+func (s *Store) SetNamespaceQuota(ctx context.Context, name string, maxStrings int) (*handlers.Namespace, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sub := s.spaces.find(name)
+	if sub == nil {
+		return nil, handlers.ErrNotFound
+	}
+	sub.mu.Lock()
+	ns := sub.ns
+	ns.MaxStrings = maxStrings
+	if p := sub.persist; p != nil {
+		if err := writeNamespace(p.dir, ns); err != nil {
+			sub.mu.Unlock()
+			return nil, err
+		}
+	}
+	sub.ns = ns
+	sub.mu.Unlock()
+	return sub.info(handlers.NowFrom(ctx)), nil
+}
+
+// DeleteNamespace implements handlers.NamespaceStore. The namespace's store
+// is emptied and refuses further writes, so views taken before the delete
+// see nothing; with persistence its directory is renamed to a "." name
+// before removal, which load finishes if interrupted.
+func (s *Store) DeleteNamespace(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if name == handlers.DefaultNamespace {
+		return fmt.Errorf("%w: the default namespace cannot be deleted", handlers.ErrConflict)
+	}
+	sp := s.spaces
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sub, ok := sp.byName[name]
+	if !ok {
+		return handlers.ErrNotFound
+	}
+	delete(sp.byName, name)
+
+	sub.mu.Lock()
+	sub.gone = true
+	sub.items = make(map[string]*handlers.StringResource)
+	sub.byID = make(map[string]*handlers.StringResource)
+	sub.idx = newIndexes()
+	sub.mu.Unlock()
+	if sub.persist == nil {
+		return nil
+	}
+	if err := sub.shutdown(false); err != nil {
+		return err
+	}
+	trash := sp.dir("." + name)
+	if err := os.Rename(sp.dir(name), trash); err != nil {
+		return err
+	}
+	return os.RemoveAll(trash)
+}
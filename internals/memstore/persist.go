@@ -0,0 +1,350 @@
+package memstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// Files kept in Options.Dir. The snapshot and the WAL hold one JSON
+// document per line; namespaceFile holds the handlers.Namespace. Every
+// other namespace keeps the same files in namespacesDir/<name>.
+const (
+	snapshotFile  = "snapshot.jsonl"
+	walFile       = "wal.jsonl"
+	namespaceFile = "namespace.json"
+	namespacesDir = "namespaces"
+)
+
+// DefaultSnapshotInterval is used by Open when Options.SnapshotInterval is 0.
+const DefaultSnapshotInterval = time.Minute
+
+// Options configure a persistent store.
+type Options struct {
+	// Dir holds the snapshot and the write-ahead log, and those of other
+	// namespaces under namespaces/; it is created if missing.
+	Dir string
+	// SnapshotInterval is how often the store is snapshotted and the WAL
+	// truncated. Zero means DefaultSnapshotInterval; negative disables
+	// periodic snapshots, leaving only the one taken by Close.
+	SnapshotInterval time.Duration
+	// SyncWrites fsyncs the WAL after every write. Without it a crash can
+	// lose writes the OS had not yet flushed, but never corrupts earlier ones.
+	SyncWrites bool
+}
+
+// walRecord is one WAL line: a put of Resource or a delete of Value.
+type walRecord struct {
+	Op       string                   `json:"op"`
+	Resource *handlers.StringResource `json:"resource,omitempty"`
+	Value    string                   `json:"value,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+type persistence struct {
+	dir        string
+	wal        *os.File
+	syncWrites bool
+
+	snapMu sync.Mutex // serializes snapshots
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Open loads the store persisted in opts.Dir, and the namespaces persisted
+// under it, replays their WALs and starts their periodic snapshot loops.
+// Close must be called to stop them.
+func Open(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("memstore: Options.Dir is required")
+	}
+	s, err := open(opts.Dir, opts, handlers.DefaultNamespace)
+	if err != nil {
+		return nil, err
+	}
+	s.spaces = newSpaces(s, opts)
+	if err := s.spaces.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("memstore: loading namespaces: %w", err)
+	}
+	return s, nil
+}
+
+// open loads the store of one namespace from dir. The namespace is read
+// from its namespaceFile, which is created for name if missing.
+func open(dir string, opts Options, name string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	ns, err := readNamespace(dir, name)
+	if err != nil {
+		return nil, fmt.Errorf("memstore: reading namespace: %w", err)
+	}
+
+	s := newStore(ns)
+	if err := s.loadSnapshot(filepath.Join(dir, snapshotFile)); err != nil {
+		return nil, fmt.Errorf("memstore: loading snapshot: %w", err)
+	}
+	walPath := filepath.Join(dir, walFile)
+	if err := s.replayWAL(walPath); err != nil {
+		return nil, fmt.Errorf("memstore: replaying WAL: %w", err)
+	}
+	wal, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := opts.SnapshotInterval
+	if interval == 0 {
+		interval = DefaultSnapshotInterval
+	}
+	s.persist = &persistence{
+		dir:        dir,
+		wal:        wal,
+		syncWrites: opts.SyncWrites,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go s.snapshotLoop(interval)
+	return s, nil
+}
+
+func (s *Store) loadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		var sr handlers.StringResource
+		if err := json.Unmarshal(sc.Bytes(), &sr); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		s.put(&sr)
+	}
+	return sc.Err()
+}
+
+// replayWAL applies the WAL on top of the snapshot. Records already covered
+// by the snapshot are harmless to replay. A torn final line, left by a crash
+// mid-write, is truncated away; corruption anywhere else is an error.
+func (s *Store) replayWAL(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	good := 0
+	for line := 1; good < len(data); line++ {
+		n := bytes.IndexByte(data[good:], '\n')
+		var rec walRecord
+		if n < 0 || json.Unmarshal(data[good:good+n], &rec) != nil {
+			if n >= 0 && good+n+1 < len(data) {
+				return fmt.Errorf("line %d is corrupt", line)
+			}
+			slog.Warn("truncating torn WAL record", "path", path, "offset", good, "bytes", len(data)-good)
+			return os.Truncate(path, int64(good))
+		}
+		switch rec.Op {
+		case opPut:
+			if rec.Resource == nil {
+				return fmt.Errorf("line %d: put without resource", line)
+			}
+			s.put(rec.Resource)
+		case opDelete:
+			s.remove(rec.Value)
+		default:
+			return fmt.Errorf("line %d: unknown op %q", line, rec.Op)
+		}
+		good += n + 1
+	}
+	return nil
+}
+
+func (s *Store) logPut(sr *handlers.StringResource) error {
+	return s.appendWAL(walRecord{Op: opPut, Resource: sr})
+}
+
+func (s *Store) logDelete(value string) error {
+	return s.appendWAL(walRecord{Op: opDelete, Value: value})
+}
+
+// appendWAL writes rec as a single line. Callers hold mu for writing, so
+// records are never interleaved or lost to a concurrent truncation.
+func (s *Store) appendWAL(rec walRecord) error {
+	p := s.persist
+	if p == nil {
+		return nil
+	}
+	if p.wal == nil {
+		return fmt.Errorf("%w: store is closed", handlers.ErrUnavailable)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := p.wal.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: writing WAL: %v", handlers.ErrUnavailable, err)
+	}
+	if p.syncWrites {
+		if err := p.wal.Sync(); err != nil {
+			return fmt.Errorf("%w: syncing WAL: %v", handlers.ErrUnavailable, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) snapshotLoop(interval time.Duration) {
+	defer close(s.persist.done)
+	if interval < 0 {
+		<-s.persist.stop
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.persist.stop:
+			return
+		case <-t.C:
+			if err := s.Snapshot(); err != nil {
+				slog.Error("memstore snapshot failed", "error", err)
+			}
+		}
+	}
+}
+
+// Snapshot writes the full store to disk and truncates the WAL. Readers are
+// not blocked; writers wait until it finishes. It is a no-op without
+// persistence.
+func (s *Store) Snapshot() error {
+	p := s.persist
+	if p == nil {
+		return nil
+	}
+	p.snapMu.Lock()
+	defer p.snapMu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p.wal == nil {
+		return fmt.Errorf("%w: store is closed", handlers.ErrUnavailable)
+	}
+
+	path := filepath.Join(p.dir, snapshotFile)
+	tmp := path + ".tmp"
+	if err := writeSnapshot(tmp, s.idx.byCreated, s.items); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if err := syncDir(p.dir); err != nil {
+		return err
+	}
+	// Everything in the WAL is now in the snapshot
+	if err := p.wal.Truncate(0); err != nil {
+		return err
+	}
+	return p.wal.Sync()
+}
+
+// writeSnapshot writes items to path in creation order and fsyncs it.
+func writeSnapshot(path string, order []createdKey, items map[string]*handlers.StringResource) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, key := range order {
+		if err := enc.Encode(items[key.value]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Close stops the snapshot loop, takes a final snapshot and closes the WAL,
+// and does the same for every other namespace. Writes after Close fail with
+// handlers.ErrUnavailable.
+func (s *Store) Close() error {
+	var errs []error
+	if s.spaces != nil && s.spaces.root == s {
+		s.spaces.mu.Lock()
+		for _, sub := range s.spaces.byName {
+			errs = append(errs, sub.shutdown(true))
+		}
+		s.spaces.mu.Unlock()
+	}
+	return errors.Join(append(errs, s.shutdown(true))...)
+}
+
+// shutdown stops the snapshot loop and closes the WAL, first taking a
+// final snapshot if asked to.
+func (s *Store) shutdown(snapshot bool) error {
+	p := s.persist
+	if p == nil {
+		return nil
+	}
+	select {
+	case <-p.stop:
+		return nil // already closed
+	default:
+		close(p.stop)
+	}
+	<-p.done
+
+	var err error
+	if snapshot {
+		err = s.Snapshot()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cerr := p.wal.Close(); err == nil {
+		err = cerr
+	}
+	p.wal = nil
+	return err
+}
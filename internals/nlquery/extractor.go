@@ -0,0 +1,243 @@
+package nlquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrBackend is wrapped by extractors whose remote backend failed (network
+// error, timeout, bad response), as opposed to the query being unparseable.
+var ErrBackend = errors.New("intent extractor backend failed")
+
+// Source values reported in Result.Source.
+const (
+	SourceRules  = "rules"
+	SourceModel  = "model"
+	SourceMerged = "merged"
+)
+
+// Request is the input to an Extractor.
+type Request struct {
+	Query    string
+	Language *Language
+	// Now is the reference time for relative phrases ("today").
+	Now time.Time
+}
+
+// Extractor turns natural language text into filters.
+type Extractor interface {
+	Extract(ctx context.Context, req Request) (*Result, error)
+}
+
+// RuleExtractor is the default Extractor, backed by the vocabulary and rule
+// parser in this package.
+type RuleExtractor struct{}
+
+func (RuleExtractor) Extract(ctx context.Context, req Request) (*Result, error) {
+	res, err := Parse(req.Query, req.Language, req.Now)
+	if err != nil {
+		return nil, err
+	}
+	res.Source = SourceRules
+	return res, nil
+}
+
+// Conflict records a filter the rule parser and the model disagreed on.
+type Conflict struct {
+	Filter string `json:"filter"`
+	Rules  any    `json:"rules"`
+	Model  any    `json:"model"`
+	Chosen string `json:"chosen"`
+}
+
+// Combined runs the rule parser and a model extractor side by side. If the
+// model fails, the rule result is used on its own. If both succeed their
+// filters are merged: filters found by only one side are kept, and when both
+// set the same filter to different values Prefer decides which one wins.
+type Combined struct {
+	Rules Extractor
+	Model Extractor
+	// Prefer is SourceRules (the default) or SourceModel.
+	Prefer string
+}
+
+func (c *Combined) Extract(ctx context.Context, req Request) (*Result, error) {
+	var wg sync.WaitGroup
+	var modelRes *Result
+	var modelErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		modelRes, modelErr = c.Model.Extract(ctx, req)
+	}()
+	rulesRes, rulesErr := c.Rules.Extract(ctx, req)
+	wg.Wait()
+
+	switch {
+	case modelErr != nil && rulesErr != nil:
+		return nil, rulesErr
+	case modelErr != nil:
+		rulesRes.Source = SourceRules
+		rulesRes.Warnings = append(rulesRes.Warnings, "model extractor unavailable, used rule parser only: "+modelErr.Error())
+		return rulesRes, nil
+	case rulesErr != nil:
+		modelRes.Source = SourceModel
+		modelRes.Warnings = append(modelRes.Warnings, "rule parser failed, used model only: "+rulesErr.Error())
+		return modelRes, nil
+	}
+
+	merged := *rulesRes
+	merged.Source = SourceMerged
+	merged.Filters = make(map[string]any, len(rulesRes.Filters))
+	for k, v := range rulesRes.Filters {
+		merged.Filters[k] = v
+	}
+	merged.Warnings = append(append([]string(nil), rulesRes.Warnings...), modelRes.Warnings...)
+
+	for k, mv := range modelRes.Filters {
+		rv, ok := rulesRes.Filters[k]
+		if !ok {
+			merged.Filters[k] = mv
+			continue
+		}
+		if filterEqual(rv, mv) {
+			continue
+		}
+		conflict := Conflict{Filter: k, Rules: rv, Model: mv, Chosen: SourceRules}
+		if c.Prefer == SourceModel {
+			conflict.Chosen = SourceModel
+			merged.Filters[k] = mv
+		}
+		merged.Conflicts = append(merged.Conflicts, conflict)
+	}
+	return &merged, nil
+}
+
+func filterEqual(a, b any) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return a == b
+}
+
+// Cache memoizes successful results of another Extractor per language and
+// query. Entries expire TTL after they were stored, measured against
+// Request.Now, and the oldest entry is evicted once MaxEntries is reached.
+// Results with created_after or created_before are not stored, since they
+// may have been resolved against Request.Now ("last 3 days").
+type Cache struct {
+	Next       Extractor
+	TTL        time.Duration
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	order   []string
+}
+
+type cacheEntry struct {
+	res      *Result
+	storedAt time.Time
+}
+
+func (c *Cache) Extract(ctx context.Context, req Request) (*Result, error) {
+	key := req.Query
+	if req.Language != nil {
+		key = req.Language.Code + "\x00" + key
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && req.Now.Sub(e.storedAt) < c.TTL {
+		c.mu.Unlock()
+		return e.res.clone(), nil
+	}
+	c.mu.Unlock()
+
+	res, err := c.Next.Extract(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if dependsOnNow(res) {
+		return res, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	if _, exists := c.entries[key]; !exists {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = cacheEntry{res: res.clone(), storedAt: req.Now}
+	for c.MaxEntries > 0 && len(c.order) > c.MaxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	return res, nil
+}
+
+// dependsOnNow reports whether res has filters that may have been resolved
+// against the request's reference time.
+func dependsOnNow(res *Result) bool {
+	_, after := res.Filters["created_after"]
+	_, before := res.Filters["created_before"]
+	return after || before
+}
+
+// clone copies the parts of a Result that callers may modify.
+func (r *Result) clone() *Result {
+	c := *r
+	c.Filters = make(map[string]any, len(r.Filters))
+	for k, v := range r.Filters {
+		c.Filters[k] = v
+	}
+	return &c
+}
+
+// NormalizeFilters validates filters decoded from JSON (numbers as float64,
+// times as RFC3339 strings) and converts them to the types used by
+// StringStore.List.
+func NormalizeFilters(raw map[string]any) (map[string]any, error) {
+	filters := make(map[string]any, len(raw))
+	for k, v := range raw {
+		switch k {
+		case "is_palindrome":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a boolean", k)
+			}
+			filters[k] = b
+		case "min_length", "max_length", "word_count":
+			f, ok := v.(float64)
+			if !ok || f < 0 || f != float64(int(f)) {
+				return nil, fmt.Errorf("%s must be a non-negative integer", k)
+			}
+			filters[k] = int(f)
+		case "contains_character":
+			s, ok := v.(string)
+			if !ok || utf8.RuneCountInString(s) != 1 {
+				return nil, fmt.Errorf("%s must be exactly one character", k)
+			}
+			filters[k] = s
+		case "created_after", "created_before":
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be an RFC3339 timestamp", k)
+			}
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC3339 timestamp", k)
+			}
+			filters[k] = t
+		default:
+			return nil, fmt.Errorf("unknown filter %q", k)
+		}
+	}
+	return filters, nil
+}
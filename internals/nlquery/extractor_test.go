@@ -0,0 +1,184 @@
+package nlquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubModel starts a local model server that answers every request with the
+// given filters JSON and counts how often it was called.
+func stubModel(t *testing.T, filtersJSON string, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req httpExtractRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"filters": ` + filtersJSON + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestHTTPExtractor(t *testing.T) {
+	server, _ := stubModel(t, `{"is_palindrome": true, "min_length": 6, "created_after": "2025-10-01T00:00:00Z"}`, 0)
+
+	res, err := (&HTTPExtractor{Endpoint: server.URL}).Extract(context.Background(), Request{Query: "anything", Now: testNow})
+	if err != nil {
+		t.Fatalf("Extract returned error: %v", err)
+	}
+	want := map[string]any{
+		"is_palindrome": true,
+		"min_length":    6,
+		"created_after": time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(res.Filters, want) {
+		t.Errorf("Expected filters %v, got %v", want, res.Filters)
+	}
+	if res.Source != SourceModel {
+		t.Errorf("Expected source %q, got %q", SourceModel, res.Source)
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		slow, _ := stubModel(t, `{}`, 200*time.Millisecond)
+		_, err := (&HTTPExtractor{Endpoint: slow.URL, Timeout: 20 * time.Millisecond}).Extract(context.Background(), Request{Query: "q", Now: testNow})
+		if !errors.Is(err, ErrBackend) {
+			t.Errorf("Expected ErrBackend, got %v", err)
+		}
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		bad, _ := stubModel(t, `{"min_length": "six"}`, 0)
+		_, err := (&HTTPExtractor{Endpoint: bad.URL}).Extract(context.Background(), Request{Query: "q", Now: testNow})
+		if !errors.Is(err, ErrBackend) {
+			t.Errorf("Expected ErrBackend, got %v", err)
+		}
+	})
+}
+
+func TestCombined(t *testing.T) {
+	req := Request{Query: "palindromes longer than 5", Language: English, Now: testNow}
+
+	t.Run("merges and resolves conflicts", func(t *testing.T) {
+		// Model agrees on is_palindrome, disagrees on min_length, adds word_count
+		server, _ := stubModel(t, `{"is_palindrome": true, "min_length": 5, "word_count": 1}`, 0)
+
+		for _, prefer := range []string{SourceRules, SourceModel} {
+			c := &Combined{Rules: RuleExtractor{}, Model: &HTTPExtractor{Endpoint: server.URL}, Prefer: prefer}
+			res, err := c.Extract(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Extract returned error: %v", err)
+			}
+			wantMin := 6
+			if prefer == SourceModel {
+				wantMin = 5
+			}
+			want := map[string]any{"is_palindrome": true, "min_length": wantMin, "word_count": 1}
+			if !reflect.DeepEqual(res.Filters, want) {
+				t.Errorf("prefer=%s: expected filters %v, got %v", prefer, want, res.Filters)
+			}
+			wantConflicts := []Conflict{{Filter: "min_length", Rules: 6, Model: 5, Chosen: prefer}}
+			if !reflect.DeepEqual(res.Conflicts, wantConflicts) {
+				t.Errorf("prefer=%s: expected conflicts %v, got %v", prefer, wantConflicts, res.Conflicts)
+			}
+			if res.Source != SourceMerged || len(res.Clauses) == 0 {
+				t.Errorf("prefer=%s: expected merged result keeping the parse tree, got %+v", prefer, res)
+			}
+		}
+	})
+
+	t.Run("falls back to rules when model fails", func(t *testing.T) {
+		slow, _ := stubModel(t, `{}`, 200*time.Millisecond)
+		c := &Combined{Rules: RuleExtractor{}, Model: &HTTPExtractor{Endpoint: slow.URL, Timeout: 20 * time.Millisecond}}
+		res, err := c.Extract(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Extract returned error: %v", err)
+		}
+		if res.Source != SourceRules || len(res.Warnings) != 1 {
+			t.Errorf("Expected rules-only result with a warning, got %+v", res)
+		}
+		if !reflect.DeepEqual(res.Filters, map[string]any{"is_palindrome": true, "min_length": 6}) {
+			t.Errorf("Unexpected filters %v", res.Filters)
+		}
+	})
+}
+
+func TestCache(t *testing.T) {
+	server, calls := stubModel(t, `{"is_palindrome": true}`, 0)
+	cache := &Cache{Next: &HTTPExtractor{Endpoint: server.URL}, TTL: time.Minute, MaxEntries: 1}
+	req := Request{Query: "q1", Language: English, Now: testNow}
+
+	for range 3 {
+		if _, err := cache.Extract(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 backend call for repeated query, got %d", calls.Load())
+	}
+
+	// Expired entries are refetched
+	req.Now = testNow.Add(2 * time.Minute)
+	_, _ = cache.Extract(context.Background(), req)
+	if calls.Load() != 2 {
+		t.Errorf("Expected expired entry to be refetched, got %d calls", calls.Load())
+	}
+
+	// MaxEntries=1: a second query evicts the first
+	_, _ = cache.Extract(context.Background(), Request{Query: "q2", Language: English, Now: req.Now})
+	_, _ = cache.Extract(context.Background(), req)
+	if calls.Load() != 4 {
+		t.Errorf("Expected eviction to force a refetch, got %d calls", calls.Load())
+	}
+}
+
+func TestCacheSkipsRelativeTimes(t *testing.T) {
+	cache := &Cache{Next: RuleExtractor{}, TTL: time.Hour}
+	req := Request{Query: "strings created today", Language: English, Now: testNow}
+	first, err := cache.Extract(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Still within the TTL, but "today" is now the next day
+	req.Now = testNow.Add(24 * time.Hour)
+	second, err := cache.Extract(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after1, after2 := first.Filters["created_after"].(time.Time), second.Filters["created_after"].(time.Time)
+	if !after2.Equal(after1.AddDate(0, 0, 1)) {
+		t.Errorf("Expected created_after to follow Request.Now, got %v then %v", after1, after2)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected results resolved against Now not to be cached, got %d entries", len(cache.entries))
+	}
+}
+
+func TestNormalizeFilters(t *testing.T) {
+	bad := []map[string]any{
+		{"min_length": -1.0},
+		{"word_count": 1.5},
+		{"contains_character": "ab"},
+		{"created_before": "yesterday"},
+		{"is_palindrome": "yes"},
+		{"color": "red"},
+	}
+	for _, raw := range bad {
+		if _, err := NormalizeFilters(raw); err == nil {
+			t.Errorf("Expected error for %v", raw)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package nlquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPExtractor delegates extraction to a model server speaking a small JSON
+// protocol. It POSTs
+//
+//	{"query": "...", "language": "en", "now": "2025-10-22T15:00:00Z"}
+//
+// to Endpoint and expects a 200 response of the form
+//
+//	{"filters": {"is_palindrome": true, "min_length": 6}}
+//
+// using the same filter names and JSON encodings as GET /strings/list
+// (timestamps as RFC3339 strings). Any other status is treated as a failure.
+type HTTPExtractor struct {
+	Endpoint string
+	// Timeout bounds each call; zero means DefaultHTTPTimeout.
+	Timeout time.Duration
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// DefaultHTTPTimeout is used when HTTPExtractor.Timeout is zero.
+const DefaultHTTPTimeout = 2 * time.Second
+
+// maxResponseBytes caps how much of a model response is read.
+const maxResponseBytes = 1 << 20
+
+type httpExtractRequest struct {
+	Query    string `json:"query"`
+	Language string `json:"language"`
+	Now      string `json:"now"`
+}
+
+type httpExtractResponse struct {
+	Filters map[string]any `json:"filters"`
+}
+
+func (e *HTTPExtractor) Extract(ctx context.Context, req Request) (*Result, error) {
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lang := DefaultLanguage
+	if req.Language != nil {
+		lang = req.Language.Code
+	}
+	body, err := json.Marshal(httpExtractRequest{
+		Query:    req.Query,
+		Language: lang,
+		Now:      req.Now.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackend, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackend, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrBackend, resp.StatusCode)
+	}
+
+	var decoded httpExtractResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("%w: invalid response: %v", ErrBackend, err)
+	}
+	filters, err := NormalizeFilters(decoded.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid filters: %v", ErrBackend, err)
+	}
+
+	return &Result{Language: lang, Filters: filters, Source: SourceModel}, nil
+}
@@ -0,0 +1,81 @@
+package nlquery
+
+// English is the default language pack.
+var English = &Language{
+	Code: "en",
+	Name: "English",
+	Vocabulary: NewVocabulary(
+		// Filler words are known so they are never "corrected" into keywords.
+		words(ConceptFiller, "the", "all", "strings", "string", "that", "which", "are", "is", "with",
+			"and", "of", "in", "than", "then", "show", "find", "list", "give", "me", "get", "those",
+			"these", "this", "have", "has", "added", "created", "stored", "long", "values",
+			"match", "matches", "matching"),
+		words(ConceptArticle, "a", "an"),
+
+		words(ConceptPalindrome, "palindrome", "palindromes", "palindromic"),
+		words(ConceptNotPalindrome, "non-palindromic", "non-palindrome", "non-palindromes"),
+		words(ConceptNot, "not"),
+
+		words(ConceptWord, "word", "words"),
+		words(ConceptSingle, "single"),
+		words(ConceptCharacters, "characters", "character", "chars", "char", "letters", "letter", "symbols", "symbol"),
+		words(ConceptLength, "length", "size"),
+
+		words(ConceptLonger, "longer", "more than", "over", "greater than", "above", "exceeding"),
+		words(ConceptShorter, "shorter", "less than", "fewer than", "under", "below"),
+		words(ConceptAtLeast, "at least", "minimum"),
+		words(ConceptAtMost, "at most", "maximum"),
+		words(ConceptExactly, "exactly"),
+		words(ConceptOrMore, "or more", "or longer"),
+		words(ConceptOrLess, "or less", "or fewer", "or shorter"),
+
+		words(ConceptContaining, "containing", "contains", "contain", "including", "includes"),
+
+		valued(ConceptNumber, 1, "one"),
+		valued(ConceptNumber, 2, "two"),
+		valued(ConceptNumber, 3, "three"),
+		valued(ConceptNumber, 4, "four"),
+		valued(ConceptNumber, 5, "five"),
+		valued(ConceptNumber, 6, "six"),
+		valued(ConceptNumber, 7, "seven"),
+		valued(ConceptNumber, 8, "eight"),
+		valued(ConceptNumber, 9, "nine"),
+		valued(ConceptNumber, 10, "ten"),
+
+		words(ConceptToday, "today"),
+		words(ConceptYesterday, "yesterday"),
+		exact(words(ConceptLast, "last", "past")),
+		words(ConceptBefore, "before", "prior to"),
+		words(ConceptAfter, "after"),
+		words(ConceptSince, "since"),
+
+		valued(ConceptTimeUnit, UnitMinute, "minute", "minutes"),
+		valued(ConceptTimeUnit, UnitHour, "hour", "hours"),
+		valued(ConceptTimeUnit, UnitDay, "day", "days"),
+		valued(ConceptTimeUnit, UnitWeek, "week", "weeks"),
+		valued(ConceptTimeUnit, UnitMonth, "month", "months"),
+		valued(ConceptTimeUnit, UnitYear, "year", "years"),
+
+		valued(ConceptMonth, 1, "january"),
+		valued(ConceptMonth, 2, "february"),
+		valued(ConceptMonth, 3, "march", "mar"),
+		valued(ConceptMonth, 4, "april"),
+		valued(ConceptMonth, 8, "august"),
+		valued(ConceptMonth, 9, "september"),
+		valued(ConceptMonth, 10, "october"),
+		valued(ConceptMonth, 11, "november"),
+		valued(ConceptMonth, 12, "december"),
+		// Short month names are too close to ordinary words ("many", "jury")
+		exact(valued(ConceptMonth, 1, "jan")),
+		exact(valued(ConceptMonth, 2, "feb")),
+		exact(valued(ConceptMonth, 4, "apr")),
+		exact(valued(ConceptMonth, 5, "may")),
+		exact(valued(ConceptMonth, 6, "june", "jun")),
+		exact(valued(ConceptMonth, 7, "july", "jul")),
+		exact(valued(ConceptMonth, 8, "aug")),
+		exact(valued(ConceptMonth, 9, "sept", "sep")),
+		exact(valued(ConceptMonth, 10, "oct")),
+		exact(valued(ConceptMonth, 11, "nov")),
+		exact(valued(ConceptMonth, 12, "dec")),
+	),
+}
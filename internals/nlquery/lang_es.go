@@ -0,0 +1,74 @@
+package nlquery
+
+// Spanish language pack, e.g. "cadenas palíndromas de más de 5 caracteres".
+var Spanish = &Language{
+	Code: "es",
+	Name: "Español",
+	Vocabulary: NewVocabulary(
+		words(ConceptFiller, "de", "del", "que", "todas", "todos", "las", "los", "cadenas", "cadena",
+			"textos", "texto", "con", "y", "en", "son", "es", "tienen", "añadidas", "añadidos",
+			"añadida", "añadido", "creadas", "creados", "creada", "creado", "muéstrame", "busca",
+			"lista", "longitud de"),
+		words(ConceptArticle, "un", "una", "el", "la"),
+
+		words(ConceptPalindrome, "palíndromo", "palíndromos", "palíndroma", "palíndromas",
+			"palindrómico", "palindrómicos", "palindrómica", "palindrómicas"),
+		words(ConceptNotPalindrome, "no palíndromos", "no palíndromas", "no palindrómicas", "no palindrómicos"),
+		words(ConceptNot, "no"),
+
+		words(ConceptWord, "palabra", "palabras"),
+		words(ConceptSingle, "sola", "solo", "única", "único"),
+		words(ConceptCharacters, "caracteres", "carácter", "letras", "letra", "símbolos", "símbolo"),
+		words(ConceptLength, "longitud", "tamaño"),
+
+		words(ConceptLonger, "de más de", "más de", "más largas que", "más largos que", "más larga que",
+			"más largo que", "mayor que", "mayores que"),
+		words(ConceptShorter, "de menos de", "menos de", "más cortas que", "más cortos que",
+			"más corta que", "más corto que", "menor que", "menores que"),
+		words(ConceptAtLeast, "al menos", "como mínimo", "mínimo"),
+		words(ConceptAtMost, "como máximo", "a lo sumo", "máximo"),
+		words(ConceptExactly, "exactamente"),
+		words(ConceptOrMore, "o más"),
+		words(ConceptOrLess, "o menos"),
+
+		words(ConceptContaining, "contienen", "contiene", "conteniendo", "que incluyen", "incluyendo"),
+
+		valued(ConceptNumber, 1, "uno"),
+		valued(ConceptNumber, 2, "dos"),
+		valued(ConceptNumber, 3, "tres"),
+		valued(ConceptNumber, 4, "cuatro"),
+		valued(ConceptNumber, 5, "cinco"),
+		valued(ConceptNumber, 6, "seis"),
+		valued(ConceptNumber, 7, "siete"),
+		valued(ConceptNumber, 8, "ocho"),
+		valued(ConceptNumber, 9, "nueve"),
+		valued(ConceptNumber, 10, "diez"),
+
+		words(ConceptToday, "hoy"),
+		words(ConceptYesterday, "ayer"),
+		exact(words(ConceptLast, "último", "última", "últimos", "últimas", "pasado", "pasada", "pasados", "pasadas")),
+		words(ConceptBefore, "antes de", "antes del"),
+		words(ConceptAfter, "después de", "después del"),
+		words(ConceptSince, "desde"),
+
+		valued(ConceptTimeUnit, UnitMinute, "minuto", "minutos"),
+		valued(ConceptTimeUnit, UnitHour, "hora", "horas"),
+		valued(ConceptTimeUnit, UnitDay, "día", "días"),
+		valued(ConceptTimeUnit, UnitWeek, "semana", "semanas"),
+		valued(ConceptTimeUnit, UnitMonth, "mes", "meses"),
+		valued(ConceptTimeUnit, UnitYear, "año", "años"),
+
+		valued(ConceptMonth, 1, "enero"),
+		valued(ConceptMonth, 2, "febrero"),
+		valued(ConceptMonth, 3, "marzo"),
+		valued(ConceptMonth, 4, "abril"),
+		exact(valued(ConceptMonth, 5, "mayo")), // not "mayor"
+		valued(ConceptMonth, 6, "junio"),
+		valued(ConceptMonth, 7, "julio"),
+		valued(ConceptMonth, 8, "agosto"),
+		valued(ConceptMonth, 9, "septiembre", "setiembre"),
+		valued(ConceptMonth, 10, "octubre"),
+		valued(ConceptMonth, 11, "noviembre"),
+		valued(ConceptMonth, 12, "diciembre"),
+	),
+}
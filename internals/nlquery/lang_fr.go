@@ -0,0 +1,73 @@
+package nlquery
+
+// French language pack, e.g. "chaînes palindromes de plus de 5 caractères".
+var French = &Language{
+	Code:     "fr",
+	Name:     "Français",
+	Elisions: []string{"d'", "l'", "qu'", "n'", "s'", "c'"},
+	Vocabulary: NewVocabulary(
+		words(ConceptFiller, "d'", "l'", "qu'", "n'", "s'", "c'", "de", "des", "du", "que", "qui",
+			"toutes", "tous", "les", "chaînes", "chaîne", "textes", "texte", "avec", "et", "en", "dans",
+			"au cours des", "pendant", "sont", "est", "ont", "ajoutées", "ajoutés", "ajoutée", "ajouté",
+			"créées", "créés", "créée", "créé", "montre", "moi", "trouve", "liste", "longueur de", "mais"),
+		words(ConceptArticle, "un", "une", "le", "la"),
+
+		words(ConceptPalindrome, "palindrome", "palindromes", "palindromique", "palindromiques"),
+		words(ConceptNotPalindrome, "non palindromes", "non palindromiques", "non-palindromes", "non-palindromiques"),
+		words(ConceptNot, "pas", "non"),
+
+		words(ConceptWord, "mot", "mots"),
+		words(ConceptSingle, "seul", "seule"),
+		words(ConceptCharacters, "caractères", "caractère", "lettres", "lettre", "symboles", "symbole"),
+		words(ConceptLength, "longueur", "taille"),
+
+		words(ConceptLonger, "de plus de", "plus de", "plus longues que", "plus longs que", "plus longue que",
+			"plus long que", "supérieure à", "supérieur à"),
+		words(ConceptShorter, "de moins de", "moins de", "plus courtes que", "plus courts que",
+			"plus courte que", "plus court que", "inférieure à", "inférieur à"),
+		words(ConceptAtLeast, "au moins", "minimum"),
+		words(ConceptAtMost, "au plus", "au maximum", "maximum"),
+		words(ConceptExactly, "exactement"),
+		words(ConceptOrMore, "ou plus"),
+		words(ConceptOrLess, "ou moins"),
+
+		words(ConceptContaining, "contenant", "contient", "contiennent", "comprenant"),
+
+		valued(ConceptNumber, 2, "deux"),
+		valued(ConceptNumber, 3, "trois"),
+		valued(ConceptNumber, 4, "quatre"),
+		valued(ConceptNumber, 5, "cinq"),
+		valued(ConceptNumber, 6, "six"),
+		valued(ConceptNumber, 7, "sept"),
+		valued(ConceptNumber, 8, "huit"),
+		valued(ConceptNumber, 9, "neuf"),
+		valued(ConceptNumber, 10, "dix"),
+
+		words(ConceptToday, "aujourd'hui"),
+		words(ConceptYesterday, "hier"),
+		exact(words(ConceptLast, "dernier", "dernière", "derniers", "dernières")),
+		words(ConceptBefore, "avant"),
+		words(ConceptAfter, "après"),
+		words(ConceptSince, "depuis"),
+
+		valued(ConceptTimeUnit, UnitMinute, "minute", "minutes"),
+		valued(ConceptTimeUnit, UnitHour, "heure", "heures"),
+		valued(ConceptTimeUnit, UnitDay, "jour", "jours"),
+		valued(ConceptTimeUnit, UnitWeek, "semaine", "semaines"),
+		valued(ConceptTimeUnit, UnitMonth, "mois"),
+		valued(ConceptTimeUnit, UnitYear, "an", "ans", "année", "années"),
+
+		valued(ConceptMonth, 1, "janvier"),
+		valued(ConceptMonth, 2, "février"),
+		valued(ConceptMonth, 3, "mars"),
+		valued(ConceptMonth, 4, "avril"),
+		exact(valued(ConceptMonth, 5, "mai")), // not "main"
+		valued(ConceptMonth, 6, "juin"),
+		valued(ConceptMonth, 7, "juillet"),
+		valued(ConceptMonth, 8, "août"),
+		valued(ConceptMonth, 9, "septembre"),
+		valued(ConceptMonth, 10, "octobre"),
+		valued(ConceptMonth, 11, "novembre"),
+		valued(ConceptMonth, 12, "décembre"),
+	),
+}
@@ -0,0 +1,126 @@
+package nlquery
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Language is a locale pack for the parser: the vocabulary that maps words of
+// the language onto concepts, plus tokenizer details. Every pack produces the
+// same filter model; only the surface words differ.
+type Language struct {
+	Code       string // BCP 47 primary language subtag, e.g. "en"
+	Name       string
+	Vocabulary *Vocabulary
+	// Elisions are prefixes split off into their own token, e.g. "d'" in
+	// "d'un seul mot".
+	Elisions []string
+}
+
+// DefaultLanguage is used when no supported language is requested.
+const DefaultLanguage = "en"
+
+var (
+	languagesMu sync.RWMutex
+	languages   = map[string]*Language{}
+)
+
+func init() {
+	Register(English)
+	Register(French)
+	Register(Spanish)
+}
+
+// Register makes a language pack available to Lookup and Negotiate. A pack
+// registered under an existing code replaces it.
+func Register(lang *Language) {
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	languages[strings.ToLower(lang.Code)] = lang
+}
+
+// Lookup returns the language pack for a code such as "fr" or "fr-CA".
+func Lookup(code string) (*Language, bool) {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	code = strings.ToLower(strings.TrimSpace(code))
+	if lang, ok := languages[code]; ok {
+		return lang, true
+	}
+	if base, _, found := strings.Cut(code, "-"); found {
+		lang, ok := languages[base]
+		return lang, ok
+	}
+	return nil, false
+}
+
+// Languages lists the registered language codes in sorted order.
+func Languages() []string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	codes := make([]string, 0, len(languages))
+	for code := range languages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Negotiate picks the best registered language for an Accept-Language header
+// value (e.g. "fr-CA,fr;q=0.9,en;q=0.5"), falling back to DefaultLanguage.
+func Negotiate(acceptLanguage string) *Language {
+	best, bestQ := (*Language)(nil), 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang, ok := Lookup(tag); ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	if best == nil {
+		best, _ = Lookup(DefaultLanguage)
+	}
+	return best
+}
+
+// fold lowercases s and strips common Latin diacritics so "caracteres" and
+// "caractères" match the same vocabulary entry.
+func fold(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch r {
+		case 'à', 'á', 'â', 'ä', 'ã', 'å':
+			b.WriteRune('a')
+		case 'ç':
+			b.WriteRune('c')
+		case 'è', 'é', 'ê', 'ë':
+			b.WriteRune('e')
+		case 'ì', 'í', 'î', 'ï':
+			b.WriteRune('i')
+		case 'ñ':
+			b.WriteRune('n')
+		case 'ò', 'ó', 'ô', 'ö', 'õ':
+			b.WriteRune('o')
+		case 'ù', 'ú', 'û', 'ü':
+			b.WriteRune('u')
+		case 'ý', 'ÿ':
+			b.WriteRune('y')
+		case 'œ':
+			b.WriteString("oe")
+		case '’':
+			b.WriteRune('\'')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,483 @@
+// Package nlquery turns simple natural language queries such as
+// "all single word palindromic strings" into the filter map understood by
+// StringStore.List.
+package nlquery
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a whitespace-separated word of the query. Start and End are
+// character (rune) offsets in the original query. Text is lowercased; Key is
+// additionally accent-folded and is what the vocabulary matches against.
+type Token struct {
+	Text  string
+	Key   string
+	Start int
+	End   int
+}
+
+// Term is a token (or run of tokens) resolved against the vocabulary. Start
+// and End are character offsets in the original query.
+type Term struct {
+	Concept   Concept `json:"concept"`
+	Value     int     `json:"value,omitempty"`
+	Text      string  `json:"text"`                // the word(s) as typed, lowercased
+	Corrected string  `json:"corrected,omitempty"` // the keyword a typo was matched to
+	Start     int     `json:"start"`
+	End       int     `json:"end"`
+}
+
+// Clause is one applied rule: the terms it consumed, the span of the original
+// query they cover and the filters the rule produced. The clauses of a query
+// form its parse tree.
+type Clause struct {
+	Rule    string         `json:"rule"`
+	Text    string         `json:"text"`
+	Start   int            `json:"start"`
+	End     int            `json:"end"`
+	Filters map[string]any `json:"filters"`
+	Terms   []Term         `json:"terms"`
+}
+
+// Correction records a typed word that was interpreted as a known keyword.
+type Correction struct {
+	Original  string `json:"original"`
+	Corrected string `json:"corrected"`
+}
+
+// Result is the outcome of parsing a query.
+type Result struct {
+	Language    string
+	Filters     map[string]any
+	Corrections []Correction
+	// Clauses is the parse tree: every rule that fired, in query order.
+	Clauses []Clause
+	// Terms lists every word or phrase that matched the vocabulary (or is a
+	// number or date), including those no rule used.
+	Terms []Term
+	// Unmatched lists the words the parser did not recognise.
+	Unmatched []Term
+	// Source says which extractor produced the filters (SourceRules,
+	// SourceModel or SourceMerged). Parse leaves it empty.
+	Source string
+	// Conflicts lists filters the rule parser and the model disagreed on.
+	Conflicts []Conflict
+	// Warnings explains fallbacks, e.g. a model backend that timed out.
+	Warnings []string
+}
+
+// Parse interprets query in the given language and returns the filters it
+// describes. A nil lang means DefaultLanguage. now is used to resolve relative
+// time phrases such as "today" or "in the last 3 hours".
+func Parse(query string, lang *Language, now time.Time) (*Result, error) {
+	if lang == nil {
+		lang, _ = Lookup(DefaultLanguage)
+	}
+	terms, corrections := resolve(tokenize(query, lang), lang.Vocabulary)
+
+	p := &parser{query: []rune(query), terms: terms, now: now, filters: make(map[string]any)}
+	p.run()
+
+	res := &Result{Language: lang.Code, Filters: p.filters, Corrections: corrections, Clauses: p.clauses}
+	for _, t := range p.terms {
+		if t.Concept == ConceptUnknown {
+			res.Unmatched = append(res.Unmatched, t)
+		} else {
+			res.Terms = append(res.Terms, t)
+		}
+	}
+	return res, nil
+}
+
+// tokenize splits query on whitespace and strips surrounding punctuation,
+// unless the token is nothing but punctuation (e.g. "containing ,"). Elided
+// prefixes of the language ("d'un") become tokens of their own.
+func tokenize(query string, lang *Language) []Token {
+	var tokens []Token
+	emit := func(s, e int) {
+		text := strings.ToLower(query[s:e])
+		start := utf8.RuneCountInString(query[:s])
+		end := start + utf8.RuneCountInString(query[s:e])
+		tokens = append(tokens, Token{Text: text, Key: fold(text), Start: start, End: end})
+	}
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		s, e := start, end
+		for s < e {
+			r, size := utf8.DecodeRuneInString(query[s:e])
+			if !isTrimmable(r) {
+				break
+			}
+			s += size
+		}
+		for e > s {
+			r, size := utf8.DecodeLastRuneInString(query[s:e])
+			if !isTrimmable(r) {
+				break
+			}
+			e -= size
+		}
+		if s == e {
+			s, e = start, end
+		}
+		if n := elisionLength(query[s:e], lang); n > 0 {
+			emit(s, s+n)
+			s += n
+		}
+		emit(s, e)
+		start = -1
+	}
+	for i, r := range query {
+		if unicode.IsSpace(r) {
+			flush(i)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	flush(len(query))
+	return tokens
+}
+
+func isTrimmable(r rune) bool {
+	return strings.ContainsRune(`,.?!;:"'()¿¡«»’`, r)
+}
+
+// elisionLength returns the byte length of an elided prefix at the start of
+// word (including the apostrophe), or 0 if there is none.
+func elisionLength(word string, lang *Language) int {
+	i := strings.IndexAny(word, "'’")
+	if i <= 0 {
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(word[i:])
+	if i+size == len(word) {
+		return 0
+	}
+	prefix := fold(word[:i+size])
+	for _, e := range lang.Elisions {
+		if prefix == e {
+			return i + size
+		}
+	}
+	return 0
+}
+
+// resolve maps tokens onto vocabulary terms, correcting typos where a token is
+// close enough to a known keyword. Filler words are dropped.
+func resolve(tokens []Token, vocab *Vocabulary) ([]Term, []Correction) {
+	var terms []Term
+	var corrections []Correction
+
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+
+		if n, err := strconv.Atoi(tok.Text); err == nil {
+			terms = append(terms, Term{Concept: ConceptNumber, Value: n, Text: tok.Text, Start: tok.Start, End: tok.End})
+			i++
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", tok.Text); err == nil {
+			terms = append(terms, Term{Concept: ConceptDate, Text: tok.Text, Start: tok.Start, End: tok.End})
+			i++
+			continue
+		}
+
+		entry, phrase, n, corrected := vocab.match(tokens, i)
+		if n == 0 {
+			terms = append(terms, Term{Concept: ConceptUnknown, Text: tok.Text, Start: tok.Start, End: tok.End})
+			i++
+			continue
+		}
+
+		typed := make([]string, n)
+		for j := range typed {
+			typed[j] = tokens[i+j].Text
+		}
+		text := strings.Join(typed, " ")
+		if corrected {
+			corrections = append(corrections, Correction{Original: text, Corrected: phrase})
+		}
+		if entry.Concept != ConceptFiller {
+			term := Term{
+				Concept: entry.Concept,
+				Value:   entry.Value,
+				Text:    text,
+				Start:   tok.Start,
+				End:     tokens[i+n-1].End,
+			}
+			if corrected {
+				term.Corrected = phrase
+			}
+			terms = append(terms, term)
+		}
+		i += n
+	}
+
+	return terms, corrections
+}
+
+// parser applies the filter rules to a sequence of resolved terms.
+type parser struct {
+	query   []rune
+	terms   []Term
+	now     time.Time
+	filters map[string]any
+	clauses []Clause
+	pending map[string]any
+}
+
+func (p *parser) at(i int) Concept {
+	if i < 0 || i >= len(p.terms) {
+		return ConceptUnknown
+	}
+	return p.terms[i].Concept
+}
+
+func (p *parser) run() {
+	for i := 0; i < len(p.terms); {
+		i += p.apply(i)
+	}
+}
+
+// set records a filter produced by the rule currently being applied.
+func (p *parser) set(key string, value any) {
+	p.filters[key] = value
+	if p.pending == nil {
+		p.pending = make(map[string]any)
+	}
+	p.pending[key] = value
+}
+
+// clause closes the current rule application: terms[i:i+n] become a clause
+// carrying the filters set since the previous clause. It returns n.
+func (p *parser) clause(rule string, i, n int) int {
+	terms := p.terms[i : i+n]
+	start, end := terms[0].Start, terms[n-1].End
+	p.clauses = append(p.clauses, Clause{
+		Rule:    rule,
+		Text:    string(p.query[start:end]),
+		Start:   start,
+		End:     end,
+		Filters: p.pending,
+		Terms:   terms,
+	})
+	p.pending = nil
+	return n
+}
+
+// apply tries every rule at position i and returns how many terms it consumed
+// (always at least one, so unknown terms are skipped).
+func (p *parser) apply(i int) int {
+	t := p.terms[i]
+
+	switch t.Concept {
+	case ConceptPalindrome:
+		p.set("is_palindrome", true)
+		return p.clause("palindrome", i, 1)
+
+	case ConceptNotPalindrome:
+		p.set("is_palindrome", false)
+		return p.clause("not_palindrome", i, 1)
+
+	case ConceptNot:
+		if p.at(i+1) == ConceptPalindrome {
+			p.set("is_palindrome", false)
+			return p.clause("not_palindrome", i, 2)
+		}
+
+	case ConceptSingle:
+		// "single word"
+		if p.at(i+1) == ConceptWord {
+			p.set("word_count", 1)
+			return p.clause("single_word", i, 2)
+		}
+
+	case ConceptNumber:
+		switch p.at(i + 1) {
+		case ConceptWord:
+			// "5 words", "one word"
+			p.set("word_count", t.Value)
+			return p.clause("word_count", i, 2)
+		case ConceptOrMore:
+			// "5 or more characters"
+			p.set("min_length", t.Value)
+			return p.clause("length_or_more", i, 2)
+		case ConceptOrLess:
+			p.set("max_length", t.Value)
+			return p.clause("length_or_less", i, 2)
+		case ConceptLast:
+			// "les 3 dernières heures", where the number comes first
+			if p.at(i+2) == ConceptTimeUnit && t.Value > 0 {
+				p.set("created_after", subtractUnit(p.now, p.terms[i+2].Value, t.Value))
+				return p.clause("relative_time", i, 3)
+			}
+		}
+
+	case ConceptLength:
+		// "length more than 4" reads the same as "more than 4"
+		return 1
+
+	case ConceptLonger, ConceptShorter, ConceptAtLeast, ConceptAtMost, ConceptExactly:
+		if p.at(i+1) != ConceptNumber {
+			return 1
+		}
+		n := p.terms[i+1].Value
+		if p.at(i+2) == ConceptWord {
+			// Word count comparisons have no filter; don't misread them as length.
+			return 3
+		}
+		switch t.Concept {
+		case ConceptLonger:
+			p.set("min_length", n+1)
+		case ConceptShorter:
+			p.set("max_length", n-1)
+		case ConceptAtLeast:
+			p.set("min_length", n)
+		case ConceptAtMost:
+			p.set("max_length", n)
+		case ConceptExactly:
+			p.set("min_length", n)
+			p.set("max_length", n)
+		}
+		return p.clause("length_comparison", i, 2)
+
+	case ConceptContaining:
+		return p.applyContains(i)
+
+	case ConceptToday:
+		p.set("created_after", startOfDay(p.now))
+		return p.clause("today", i, 1)
+
+	case ConceptYesterday:
+		// "added yesterday" covers the whole day
+		today := startOfDay(p.now)
+		p.set("created_after", today.AddDate(0, 0, -1))
+		p.set("created_before", today)
+		return p.clause("yesterday", i, 1)
+
+	case ConceptLast:
+		return p.applyLast(i)
+
+	case ConceptBefore, ConceptAfter, ConceptSince:
+		start, end, n := p.dateRange(i + 1)
+		if n == 0 {
+			return 1
+		}
+		switch t.Concept {
+		case ConceptBefore:
+			p.set("created_before", start)
+		case ConceptAfter:
+			p.set("created_after", end)
+		case ConceptSince:
+			p.set("created_after", start)
+		}
+		return p.clause("date_range", i, 1+n)
+	}
+
+	return 1
+}
+
+// applyContains handles "containing z", "contains the letter z" and
+// "containing a". Articles and "letter"/"character" are skipped when they are
+// followed by the actual character.
+func (p *parser) applyContains(i int) int {
+	j := i + 1
+	for j < len(p.terms)-1 {
+		c := p.at(j)
+		next := p.terms[j+1]
+		if c == ConceptCharacters || (c == ConceptArticle && (p.at(j+1) == ConceptCharacters || utf8.RuneCountInString(next.Text) == 1)) {
+			j++
+			continue
+		}
+		break
+	}
+	if j < len(p.terms) && utf8.RuneCountInString(p.terms[j].Text) == 1 {
+		p.terms[j].Concept = ConceptLiteral
+		p.set("contains_character", p.terms[j].Text)
+		return p.clause("contains", i, j-i+1)
+	}
+	return 1
+}
+
+// applyLast handles "last 3 hours", "past day" and "last week".
+func (p *parser) applyLast(i int) int {
+	n, j := 1, i+1
+	if p.at(j) == ConceptNumber {
+		n = p.terms[j].Value
+		j++
+	}
+	if p.at(j) != ConceptTimeUnit || n <= 0 {
+		return 1
+	}
+	p.set("created_after", subtractUnit(p.now, p.terms[j].Value, n))
+	return p.clause("relative_time", i, j-i+1)
+}
+
+// dateRange parses an absolute date reference at position i ("October 2025",
+// "october", "2025", "2025-10-01", "today", "yesterday") and returns the
+// half-open interval [start, end) it denotes plus the number of terms used.
+func (p *parser) dateRange(i int) (time.Time, time.Time, int) {
+	if i >= len(p.terms) {
+		return time.Time{}, time.Time{}, 0
+	}
+	t := p.terms[i]
+	loc := p.now.Location()
+	today := startOfDay(p.now)
+
+	switch t.Concept {
+	case ConceptToday:
+		return today, today.AddDate(0, 0, 1), 1
+	case ConceptYesterday:
+		return today.AddDate(0, 0, -1), today, 1
+	case ConceptDate:
+		d, _ := time.ParseInLocation("2006-01-02", t.Text, loc)
+		return d, d.AddDate(0, 0, 1), 1
+	case ConceptMonth:
+		year, n := p.now.Year(), 1
+		if p.at(i+1) == ConceptNumber && isYear(p.terms[i+1].Value) {
+			year, n = p.terms[i+1].Value, 2
+		}
+		start := time.Date(year, time.Month(t.Value), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0), n
+	case ConceptNumber:
+		if isYear(t.Value) {
+			start := time.Date(t.Value, time.January, 1, 0, 0, 0, 0, loc)
+			return start, start.AddDate(1, 0, 0), 1
+		}
+	}
+	return time.Time{}, time.Time{}, 0
+}
+
+func isYear(n int) bool {
+	return n >= 1000 && n <= 9999
+}
+
+func subtractUnit(now time.Time, unit, n int) time.Time {
+	switch unit {
+	case UnitMinute:
+		return now.Add(-time.Duration(n) * time.Minute)
+	case UnitHour:
+		return now.Add(-time.Duration(n) * time.Hour)
+	case UnitDay:
+		return now.AddDate(0, 0, -n)
+	case UnitWeek:
+		return now.AddDate(0, 0, -7*n)
+	case UnitMonth:
+		return now.AddDate(0, -n, 0)
+	default:
+		return now.AddDate(-n, 0, 0)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,243 @@
+package nlquery
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2025, time.October, 22, 15, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query       string
+		filters     map[string]any
+		corrections []Correction
+	}{
+		{
+			query:   "all single word palindromic strings",
+			filters: map[string]any{"word_count": 1, "is_palindrome": true},
+		},
+		{
+			query:   "strings longer than 10 characters",
+			filters: map[string]any{"min_length": 11},
+		},
+		{
+			query:   "strings containing the letter z",
+			filters: map[string]any{"contains_character": "z"},
+		},
+		{
+			query:   "strings containing a",
+			filters: map[string]any{"contains_character": "a"},
+		},
+		{
+			query:   "shorter than 5 chars",
+			filters: map[string]any{"max_length": 4},
+		},
+		{
+			query:   "strings with more than 3 letters",
+			filters: map[string]any{"min_length": 4},
+		},
+		{
+			query:   "two words, over 8 characters",
+			filters: map[string]any{"word_count": 2, "min_length": 9},
+		},
+		{
+			query:   "at least 4 characters and at most 6",
+			filters: map[string]any{"min_length": 4, "max_length": 6},
+		},
+		{
+			query:   "non-palindromic strings",
+			filters: map[string]any{"is_palindrome": false},
+		},
+		{
+			query:       "palindrms",
+			filters:     map[string]any{"is_palindrome": true},
+			corrections: []Correction{{Original: "palindrms", Corrected: "palindrome"}},
+		},
+		{
+			query:       "lenght more than 4",
+			filters:     map[string]any{"min_length": 5},
+			corrections: []Correction{{Original: "lenght", Corrected: "length"}},
+		},
+		{
+			query:   "contaning the leter q",
+			filters: map[string]any{"contains_character": "q"},
+			corrections: []Correction{
+				{Original: "contaning", Corrected: "containing"},
+				{Original: "leter", Corrected: "letter"},
+			},
+		},
+		{
+			query:       "strings that are lesss than 4",
+			filters:     map[string]any{"max_length": 3},
+			corrections: []Correction{{Original: "lesss than", Corrected: "less than"}},
+		},
+		{
+			query:   "strings added today",
+			filters: map[string]any{"created_after": time.Date(2025, time.October, 22, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			query:   "created in the last 3 hours",
+			filters: map[string]any{"created_after": testNow.Add(-3 * time.Hour)},
+		},
+		{
+			query:   "since yesterday",
+			filters: map[string]any{"created_after": time.Date(2025, time.October, 21, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			query:       "before Octobr 2025",
+			filters:     map[string]any{"created_before": time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC)},
+			corrections: []Correction{{Original: "octobr", Corrected: "october"}},
+		},
+		{
+			query:   "after 2024",
+			filters: map[string]any{"created_after": time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			res, err := Parse(tc.query, English, testNow)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			if !reflect.DeepEqual(res.Filters, tc.filters) {
+				t.Errorf("Expected filters %v, got %v", tc.filters, res.Filters)
+			}
+			if !reflect.DeepEqual(res.Corrections, tc.corrections) {
+				t.Errorf("Expected corrections %v, got %v", tc.corrections, res.Corrections)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"length", "length", 0},
+		{"lenght", "length", 1},
+		{"leter", "letter", 1},
+		{"palindrms", "palindromes", 2},
+	}
+	for _, tc := range tests {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// TestGoldenCorpus runs every registered language pack against the shared
+// corpus in testdata/golden.json. Each case must have a query per language
+// and all of them must produce the same filters.
+func TestGoldenCorpus(t *testing.T) {
+	raw, err := os.ReadFile("testdata/golden.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corpus []struct {
+		Name    string            `json:"name"`
+		Queries map[string]string `json:"queries"`
+		Filters map[string]any    `json:"filters"`
+	}
+	if err := json.Unmarshal(raw, &corpus); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range corpus {
+		for _, code := range Languages() {
+			t.Run(tc.Name+"/"+code, func(t *testing.T) {
+				query, ok := tc.Queries[code]
+				if !ok {
+					t.Fatalf("golden case %q has no %s query", tc.Name, code)
+				}
+				lang, _ := Lookup(code)
+				res, err := Parse(query, lang, testNow)
+				if err != nil {
+					t.Fatalf("Parse returned error: %v", err)
+				}
+				if len(res.Corrections) != 0 {
+					t.Errorf("Expected no corrections, got %v", res.Corrections)
+				}
+				// Compare through JSON so times and numbers match the corpus encoding.
+				encoded, _ := json.Marshal(res.Filters)
+				var got map[string]any
+				_ = json.Unmarshal(encoded, &got)
+				if !reflect.DeepEqual(got, tc.Filters) {
+					t.Errorf("%q: expected filters %v, got %v", query, tc.Filters, got)
+				}
+			})
+		}
+	}
+}
+
+func TestParseFoldsAccentsAndCorrectsTypos(t *testing.T) {
+	res, _ := Parse("chaines palindromes de plus de 5 caracteres", French, testNow)
+	if len(res.Corrections) != 0 {
+		t.Errorf("Expected unaccented spelling to match without corrections, got %v", res.Corrections)
+	}
+	if res.Filters["min_length"] != 6 {
+		t.Errorf("Expected min_length 6, got %v", res.Filters)
+	}
+
+	res, _ = Parse("cadenas palindormas", Spanish, testNow)
+	if res.Filters["is_palindrome"] != true || len(res.Corrections) != 1 {
+		t.Errorf("Expected corrected palindrome filter, got %v / %v", res.Filters, res.Corrections)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"fr-CA,fr;q=0.9,en;q=0.5", "fr"},
+		{"de-DE,es;q=0.8,en;q=0.7", "es"},
+		{"en;q=0.4,es;q=0.6", "es"},
+		{"de, it", "en"},
+	}
+	for _, tc := range tests {
+		if got := Negotiate(tc.header).Code; got != tc.want {
+			t.Errorf("Negotiate(%q) = %s, want %s", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestParseClausesAndSpans(t *testing.T) {
+	query := "chaînes palindromes contenant la lettre é"
+	res, _ := Parse(query, French, testNow)
+
+	if len(res.Clauses) != 2 {
+		t.Fatalf("Expected 2 clauses, got %+v", res.Clauses)
+	}
+	runes := []rune(query)
+	for _, c := range res.Clauses {
+		// Offsets are in characters, not bytes
+		if got := string(runes[c.Start:c.End]); got != c.Text {
+			t.Errorf("Clause %s: span [%d,%d) is %q, want %q", c.Rule, c.Start, c.End, got, c.Text)
+		}
+	}
+	contains := res.Clauses[1]
+	if contains.Rule != "contains" || contains.Text != "contenant la lettre é" || contains.Start != 20 {
+		t.Errorf("Unexpected contains clause %+v", contains)
+	}
+	if last := contains.Terms[len(contains.Terms)-1]; last.Concept != ConceptLiteral || last.Text != "é" {
+		t.Errorf("Expected literal é as last term, got %+v", last)
+	}
+	if len(res.Unmatched) != 0 {
+		t.Errorf("Expected no unmatched words, got %+v", res.Unmatched)
+	}
+
+	res, _ = Parse("palindrms from mars", English, testNow)
+	if len(res.Terms) == 0 || res.Terms[0].Corrected != "palindrome" {
+		t.Errorf("Expected first term to carry its correction, got %+v", res.Terms)
+	}
+	if len(res.Unmatched) != 1 || res.Unmatched[0].Text != "from" {
+		t.Errorf("Expected 'from' to be unmatched, got %+v", res.Unmatched)
+	}
+}
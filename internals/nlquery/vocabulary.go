@@ -0,0 +1,215 @@
+package nlquery
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Concept is the canonical meaning of a keyword, independent of the synonym
+// the user actually typed ("chars", "letters" and "characters" all map to
+// ConceptCharacters).
+type Concept string
+
+const (
+	ConceptUnknown       Concept = ""
+	ConceptFiller        Concept = "filler" // known word with no meaning for filters ("the", "strings")
+	ConceptArticle       Concept = "article"
+	ConceptNumber        Concept = "number"
+	ConceptPalindrome    Concept = "palindrome"
+	ConceptNotPalindrome Concept = "not_palindrome"
+	ConceptNot           Concept = "not"
+	ConceptWord          Concept = "word"
+	ConceptSingle        Concept = "single"
+	ConceptCharacters    Concept = "characters"
+	ConceptLength        Concept = "length"
+	ConceptLonger        Concept = "longer"
+	ConceptShorter       Concept = "shorter"
+	ConceptAtLeast       Concept = "at_least"
+	ConceptAtMost        Concept = "at_most"
+	ConceptExactly       Concept = "exactly"
+	ConceptOrMore        Concept = "or_more"
+	ConceptOrLess        Concept = "or_less"
+	ConceptContaining    Concept = "containing"
+	ConceptToday         Concept = "today"
+	ConceptYesterday     Concept = "yesterday"
+	ConceptLast          Concept = "last"
+	ConceptBefore        Concept = "before"
+	ConceptAfter         Concept = "after"
+	ConceptSince         Concept = "since"
+	ConceptMonth         Concept = "month_name"
+	ConceptTimeUnit      Concept = "time_unit"
+	ConceptDate          Concept = "date"
+	ConceptLiteral       Concept = "literal" // a character the query refers to ("containing z")
+)
+
+// Time units carried in Entry.Value for ConceptTimeUnit.
+const (
+	UnitMinute = iota + 1
+	UnitHour
+	UnitDay
+	UnitWeek
+	UnitMonth
+	UnitYear
+)
+
+// Entry is what a vocabulary phrase resolves to. Value carries the number for
+// number words, the month for month names and the unit for time units.
+type Entry struct {
+	Concept Concept
+	Value   int
+}
+
+// Synonyms lists phrases that all resolve to the same Entry. Exact phrases
+// are never the target of a typo correction.
+type Synonyms struct {
+	Entry   Entry
+	Phrases []string
+	Exact   bool
+}
+
+// words groups synonyms for a concept that carries no value.
+func words(concept Concept, phrases ...string) Synonyms {
+	return Synonyms{Entry: Entry{Concept: concept}, Phrases: phrases}
+}
+
+// valued groups synonyms for a concept with a value (numbers, months, units).
+func valued(concept Concept, value int, phrases ...string) Synonyms {
+	return Synonyms{Entry: Entry{Concept: concept, Value: value}, Phrases: phrases}
+}
+
+// exact marks g as matching only when typed exactly. It is for keywords one
+// edit away from common words ("many" is not "may", "match" not "march"),
+// which would otherwise turn ordinary queries into date filters.
+func exact(g Synonyms) Synonyms {
+	g.Exact = true
+	return g
+}
+
+// Vocabulary maps known phrases (one or more words) to concepts and supports
+// typo-tolerant lookup. Phrases are matched case- and accent-insensitively.
+type Vocabulary struct {
+	phrases  map[string]Entry  // folded phrase -> entry
+	display  map[string]string // folded phrase -> phrase as written in the pack
+	maxWords int
+	// byWords lists the phrases open to fuzzy matching grouped by word
+	// count, each group sorted so fuzzy matching is deterministic.
+	byWords [][][]string
+}
+
+// NewVocabulary builds a Vocabulary from groups of synonyms.
+func NewVocabulary(groups ...Synonyms) *Vocabulary {
+	v := &Vocabulary{phrases: make(map[string]Entry), display: make(map[string]string)}
+	var keys []string
+	for _, g := range groups {
+		for _, phrase := range g.Phrases {
+			key := fold(phrase)
+			v.phrases[key] = g.Entry
+			v.display[key] = phrase
+			if !g.Exact {
+				keys = append(keys, key)
+			}
+			if n := len(strings.Fields(key)); n > v.maxWords {
+				v.maxWords = n
+			}
+		}
+	}
+	sort.Strings(keys)
+	v.byWords = make([][][]string, v.maxWords+1)
+	for _, phrase := range keys {
+		words := strings.Fields(phrase)
+		v.byWords[len(words)] = append(v.byWords[len(words)], words)
+	}
+	return v
+}
+
+// match finds the best vocabulary phrase starting at tokens[i]. Exact matches
+// win over fuzzy ones and longer phrases win over shorter ones. It returns the
+// entry, the canonical phrase, the number of tokens consumed and whether any
+// word had to be corrected. n is 0 when nothing matched.
+func (v *Vocabulary) match(tokens []Token, i int) (entry Entry, phrase string, n int, corrected bool) {
+	for k := min(v.maxWords, len(tokens)-i); k >= 1; k-- {
+		words := make([]string, k)
+		for j := range words {
+			words[j] = tokens[i+j].Key
+		}
+		key := strings.Join(words, " ")
+		if e, ok := v.phrases[key]; ok {
+			return e, v.display[key], k, false
+		}
+	}
+
+	for k := min(v.maxWords, len(tokens)-i); k >= 1; k-- {
+		bestDist := -1
+		var best []string
+		for _, candidate := range v.byWords[k] {
+			dist := 0
+			for j, word := range candidate {
+				d, ok := fuzzyDistance(tokens[i+j].Key, word)
+				if !ok {
+					dist = -1
+					break
+				}
+				dist += d
+			}
+			if dist > 0 && (bestDist == -1 || dist < bestDist) {
+				bestDist, best = dist, candidate
+			}
+		}
+		if best != nil {
+			key := strings.Join(best, " ")
+			return v.phrases[key], v.display[key], k, true
+		}
+	}
+
+	return Entry{}, "", 0, false
+}
+
+// fuzzyDistance reports the edit distance between a typed word and a
+// vocabulary word, and whether it is small enough to count as a typo.
+// Short words must match exactly; longer words tolerate one or two edits.
+func fuzzyDistance(typed, word string) (int, bool) {
+	if typed == word {
+		return 0, true
+	}
+	n := utf8.RuneCountInString(typed)
+	var allowed int
+	switch {
+	case n <= 3:
+		return 0, false
+	case n <= 5:
+		allowed = 1
+	default:
+		allowed = 2
+	}
+	d := editDistance(typed, word)
+	return d, d <= allowed
+}
+
+// editDistance computes the optimal string alignment distance (Levenshtein
+// plus adjacent transpositions) between a and b, so "lenght" is one edit from
+// "length".
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,48 @@
+package storecache
+
+import (
+	"context"
+	"sync"
+)
+
+// call is an in-flight load shared by every caller asking for the same key.
+type call struct {
+	done chan struct{}
+	val  any
+	err  error
+}
+
+// flight coalesces concurrent loads of the same key, like
+// golang.org/x/sync/singleflight.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do runs load once per key at a time. Callers that join an in-flight load
+// get its result and shared=true; they stop waiting when their own ctx ends.
+func (f *flight) do(ctx context.Context, key string, load func() (any, error)) (val any, err error, shared bool) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*call)
+	}
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	c.val, c.err = load()
+	f.mu.Lock()
+	delete(f.calls, key)
+	f.mu.Unlock()
+	close(c.done)
+	return c.val, c.err, false
+}
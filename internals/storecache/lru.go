@@ -0,0 +1,81 @@
+package storecache
+
+import (
+	"container/list"
+	"time"
+)
+
+// entry is one cached result. gen is the write generation it was loaded in;
+// List entries are only valid while no write has happened since. loadedAt
+// is the time the store judged expiry by (see handlers.NowFrom), and
+// expiresAt the earliest ExpiresAt among the cached resources, zero if none.
+type entry struct {
+	key       string
+	value     any
+	size      int64
+	gen       uint64
+	storedAt  time.Time
+	loadedAt  time.Time
+	expiresAt time.Time
+}
+
+// lru is a least-recently-used cache bounded by entry count and total size.
+// It is not safe for concurrent use.
+type lru struct {
+	maxEntries int
+	maxBytes   int64
+
+	ll    *list.List // front is most recent
+	items map[string]*list.Element
+	bytes int64
+
+	evictions uint64
+}
+
+func newLRU(maxEntries int, maxBytes int64) *lru {
+	return &lru{maxEntries: maxEntries, maxBytes: maxBytes, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lru) get(key string) (*entry, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*entry), true
+}
+
+// add inserts or replaces e and evicts from the back until both bounds hold.
+// An entry larger than maxBytes on its own is not stored.
+func (c *lru) add(e *entry) {
+	if e.size > c.maxBytes {
+		c.remove(e.key)
+		return
+	}
+	if el, ok := c.items[e.key]; ok {
+		c.bytes += e.size - el.Value.(*entry).size
+		el.Value = e
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[e.key] = c.ll.PushFront(e)
+		c.bytes += e.size
+	}
+	for c.ll.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+func (c *lru) remove(key string) bool {
+	el, ok := c.items[key]
+	if ok {
+		c.removeElement(el)
+	}
+	return ok
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,107 @@
+package storecache
+
+import (
+	"context"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// In implements handlers.NamespaceStore, returning a view that shares this
+// store's cache. Without namespaces in the wrapped store every call on the
+// view fails with handlers.ErrNotSupported.
+func (s *Store) In(name string) handlers.StringStore {
+	if name == s.ns {
+		return s
+	}
+	var next handlers.StringStore = noNamespaces{}
+	if ns, ok := s.next.(handlers.NamespaceStore); ok {
+		next = ns.In(name)
+	}
+	return &Store{next: next, ns: name, cache: s.cache}
+}
+
+// namespaces returns the wrapped store's handlers.NamespaceStore.
+func (s *Store) namespaces() (handlers.NamespaceStore, error) {
+	ns, ok := s.next.(handlers.NamespaceStore)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return ns, nil
+}
+
+// CreateNamespace implements handlers.NamespaceStore when the wrapped store
+// does.
+func (s *Store) CreateNamespace(ctx context.Context, n handlers.Namespace) error {
+	ns, err := s.namespaces()
+	if err != nil {
+		return err
+	}
+	return ns.CreateNamespace(ctx, n)
+}
+
+// GetNamespace is not cached; it forwards to the wrapped store.
+func (s *Store) GetNamespace(ctx context.Context, name string) (*handlers.Namespace, error) {
+	ns, err := s.namespaces()
+	if err != nil {
+		return nil, err
+	}
+	return ns.GetNamespace(ctx, name)
+}
+
+// ListNamespaces is not cached; it forwards to the wrapped store.
+func (s *Store) ListNamespaces(ctx context.Context) ([]handlers.Namespace, error) {
+	ns, err := s.namespaces()
+	if err != nil {
+		return nil, err
+	}
+	return ns.ListNamespaces(ctx)
+}
+
+// SetNamespaceQuota implements handlers.NamespaceStore when the wrapped
+// store does. Quotas only affect writes, so nothing cached changes.
+func (s *Store) SetNamespaceQuota(ctx context.Context, name string, maxStrings int) (*handlers.Namespace, error) {
+	ns, err := s.namespaces()
+	if err != nil {
+		return nil, err
+	}
+	return ns.SetNamespaceQuota(ctx, name, maxStrings)
+}
+
+// DeleteNamespace implements handlers.NamespaceStore when the wrapped store
+// does, emptying the cache.
+func (s *Store) DeleteNamespace(ctx context.Context, name string) error {
+	ns, err := s.namespaces()
+	if err != nil {
+		return err
+	}
+	err = ns.DeleteNamespace(ctx, name)
+	s.invalidateAll()
+	return err
+}
+
+// noNamespaces stands in for a namespace of a wrapped store that has none.
+type noNamespaces struct{}
+
+func (noNamespaces) Create(context.Context, *handlers.StringResource) error { return errUnsupported }
+
+func (noNamespaces) Get(context.Context, string) (*handlers.StringResource, error) {
+	return nil, errUnsupported
+}
+
+func (noNamespaces) Delete(context.Context, string) error { return errUnsupported }
+
+func (noNamespaces) List(context.Context, map[string]any, int, int) ([]handlers.StringResource, int, error) {
+	return nil, 0, errUnsupported
+}
+
+func (noNamespaces) Exists(context.Context, string) (bool, error) { return false, errUnsupported }
+
+func (noNamespaces) CreateIfAbsent(context.Context, *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	return nil, false, errUnsupported
+}
+
+func (noNamespaces) GetByID(context.Context, string) (*handlers.StringResource, error) {
+	return nil, errUnsupported
+}
+
+func (noNamespaces) DeleteByID(context.Context, string) error { return errUnsupported }
@@ -0,0 +1,523 @@
+// Package storecache is a caching decorator for handlers.StringStore. It
+// keeps recent Get results and List pages in a size-bounded LRU, coalesces
+// concurrent identical misses into one store call, and drops affected
+// entries on every write made through it.
+//
+// Writes made by other processes sharing the underlying store are not seen
+// until entries expire, so Options.TTL bounds how stale a result can be.
+// The same bound applies to strings reaching their own ExpiresAt: an entry
+// holding an expired resource is never served, but a List total may count
+// one that is not on the cached page until the entry's TTL runs out. Expiry
+// is judged by the time in the context (see handlers.NowFrom), like the
+// wrapped store does; the TTL follows the wall clock.
+package storecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// Defaults used by New for zero Options fields.
+const (
+	DefaultMaxEntries = 10000
+	DefaultMaxBytes   = 64 << 20
+	DefaultTTL        = time.Minute
+)
+
+// Options bound the cache.
+type Options struct {
+	MaxEntries int
+	// MaxBytes bounds the approximate memory held by cached resources.
+	MaxBytes int64
+	// TTL is how long an entry is served after it was loaded.
+	TTL time.Duration
+}
+
+// Store wraps another store. It implements handlers.StringStore,
+// handlers.ReanalysisStore, handlers.TrashStore, handlers.RetentionStore,
+// handlers.AnnotationStore, handlers.NamespaceStore, handlers.EventStore,
+// handlers.QueryExplainer and handlers.CacheReporter, forwarding the
+// optional interfaces when the wrapped store supports them and failing with
+// handlers.ErrNotSupported otherwise.
+//
+// The views returned by In share one cache, with keys qualified by the
+// namespace; a write in any namespace drops every cached List page.
+type Store struct {
+	next handlers.StringStore
+	ns   string
+	*cache
+}
+
+// cache is the state shared by a Store and its namespace views.
+type cache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	lru   *lru
+	gen   uint64            // bumped by every write
+	byID  map[string]string // namespace and ID -> key of cached Get entries
+	stats handlers.CacheStats
+
+	flight flight
+}
+
+func New(next handlers.StringStore, opts Options) *Store {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	return &Store{
+		next: next,
+		ns:   handlers.DefaultNamespace,
+		cache: &cache{
+			ttl:  opts.TTL,
+			now:  time.Now,
+			lru:  newLRU(opts.MaxEntries, opts.MaxBytes),
+			byID: make(map[string]string),
+		},
+	}
+}
+
+// CacheStats implements handlers.CacheReporter.
+func (s *Store) CacheStats() handlers.CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Evictions = s.lru.evictions
+	st.Entries = s.lru.ll.Len()
+	st.Bytes = s.lru.bytes
+	return st
+}
+
+// listPage is a cached List result.
+type listPage struct {
+	page  []handlers.StringResource
+	total int
+}
+
+func getKey(ns, value string) string { return "g\x00" + ns + "\x00" + value }
+
+// idKey qualifies an ID for byID.
+func idKey(ns, id string) string { return ns + "\x00" + id }
+
+// listKey canonicalizes a List call; map order must not matter.
+func listKey(ns string, filters map[string]any, limit, offset int) string {
+	keys := make([]string, 0, len(filters))
+	for k := range filters {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	b.WriteString("l\x00" + ns)
+	for _, k := range keys {
+		v := filters[k]
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(&b, "\x00%s=%T:%v", k, v, v)
+	}
+	b.WriteString("\x00" + strconv.Itoa(limit) + "/" + strconv.Itoa(offset))
+	return b.String()
+}
+
+// resourceSize approximates the memory held by sr.
+func resourceSize(sr *handlers.StringResource) int64 {
+	n := 128 + len(sr.Value) + len(sr.ID) + 2*len(sr.Properties.SHA256Hash) + 24*len(sr.Properties.CharacterFrequencyMap)
+	for _, tag := range sr.Tags {
+		n += 16 + len(tag)
+	}
+	return int64(n + 64*len(sr.Metadata))
+}
+
+func cloneResource(sr handlers.StringResource) handlers.StringResource {
+	m := make(map[string]int, len(sr.Properties.CharacterFrequencyMap))
+	for k, v := range sr.Properties.CharacterFrequencyMap {
+		m[k] = v
+	}
+	sr.Properties.CharacterFrequencyMap = m
+	if sr.DeletedAt != nil {
+		at := *sr.DeletedAt
+		sr.DeletedAt = &at
+	}
+	if sr.ExpiresAt != nil {
+		at := *sr.ExpiresAt
+		sr.ExpiresAt = &at
+	}
+	sr.Tags = slices.Clone(sr.Tags)
+	sr.Metadata = handlers.CloneMetadata(sr.Metadata)
+	return sr
+}
+
+// firstExpiry returns the earliest ExpiresAt in a cached value, after
+// which the entry must not be served.
+func firstExpiry(value any) time.Time {
+	var first time.Time
+	check := func(sr *handlers.StringResource) {
+		if sr.ExpiresAt != nil && (first.IsZero() || sr.ExpiresAt.Before(first)) {
+			first = *sr.ExpiresAt
+		}
+	}
+	switch v := value.(type) {
+	case *handlers.StringResource:
+		check(v)
+	case *listPage:
+		for i := range v.page {
+			check(&v.page[i])
+		}
+	}
+	return first
+}
+
+// lookup returns a fresh cached value for key, valid at at (the caller's
+// handlers.NowFrom). An entry loaded at a later time may lack resources
+// that had not yet expired at at, so it is not served. List entries must
+// also be from the current write generation. Callers hold mu.
+func (s *cache) lookup(key string, needCurrentGen bool, at time.Time) (any, bool) {
+	e, ok := s.lru.get(key)
+	if !ok {
+		return nil, false
+	}
+	expired := (!e.expiresAt.IsZero() && !at.Before(e.expiresAt)) || at.Before(e.loadedAt)
+	if s.now().Sub(e.storedAt) >= s.ttl || expired || (needCurrentGen && e.gen != s.gen) {
+		s.lru.remove(key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// store caches value, loaded at the time at, unless a write happened since
+// the load began at gen, in which case the value may already be stale.
+// Callers hold mu.
+func (s *Store) store(key string, value any, size int64, gen uint64, at time.Time) {
+	if gen != s.gen {
+		return
+	}
+	s.lru.add(&entry{key: key, value: value, size: size, gen: gen, storedAt: s.now(), loadedAt: at, expiresAt: firstExpiry(value)})
+	if sr, ok := value.(*handlers.StringResource); ok {
+		if _, cached := s.lru.items[key]; cached {
+			s.byID[idKey(s.ns, sr.ID)] = key
+		}
+	}
+	s.pruneIDs()
+}
+
+// pruneIDs drops byID entries whose Get entry was evicted, once they
+// clearly outnumber the cache. Callers hold mu.
+func (s *cache) pruneIDs() {
+	if len(s.byID) <= 2*s.lru.maxEntries {
+		return
+	}
+	for id, key := range s.byID {
+		if _, ok := s.lru.items[key]; !ok {
+			delete(s.byID, id)
+		}
+	}
+}
+
+// invalidateAll empties the cache, for writes that cannot name the values
+// they change.
+func (s *cache) invalidateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	s.stats.Invalidations++
+	for s.lru.ll.Len() > 0 {
+		s.lru.removeElement(s.lru.ll.Back())
+	}
+	clear(s.byID)
+}
+
+// invalidate drops the Get entries for values and IDs and, by starting a
+// new generation, every List page.
+func (s *Store) invalidate(values []string, ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	s.stats.Invalidations++
+	for _, id := range ids {
+		if key, ok := s.byID[idKey(s.ns, id)]; ok {
+			s.lru.remove(key)
+			delete(s.byID, idKey(s.ns, id))
+		}
+	}
+	for _, v := range values {
+		s.lru.remove(getKey(s.ns, v))
+	}
+}
+
+// load serves key from the cache or, coalescing concurrent misses, from
+// fetch. counters selects the Get or List metrics.
+func (s *Store) load(ctx context.Context, key string, counters *handlers.CacheCounters, listEntry bool,
+	fetch func(context.Context) (any, int64, error)) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	at := handlers.NowFrom(ctx)
+	s.mu.Lock()
+	if v, ok := s.lookup(key, listEntry, at); ok {
+		counters.Hits++
+		s.mu.Unlock()
+		return v, nil
+	}
+	counters.Misses++
+	gen := s.gen
+	s.mu.Unlock()
+
+	v, err, shared := s.flight.do(ctx, key, func() (any, error) {
+		v, size, err := fetch(ctx)
+		if err == nil {
+			s.mu.Lock()
+			s.store(key, v, size, gen, at)
+			s.mu.Unlock()
+		}
+		return v, err
+	})
+	if shared {
+		s.mu.Lock()
+		counters.Coalesced++
+		s.mu.Unlock()
+		// The leader's own context may have ended its load; retry on ours
+		if isContextErr(err) && ctx.Err() == nil {
+			v, _, err = fetch(ctx)
+		}
+	}
+	return v, err
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (s *Store) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	v, err := s.load(ctx, getKey(s.ns, value), &s.stats.Get, false, func(ctx context.Context) (any, int64, error) {
+		sr, err := s.next.Get(ctx, value)
+		if err != nil {
+			return nil, 0, err
+		}
+		return sr, resourceSize(sr), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sr := cloneResource(*v.(*handlers.StringResource))
+	return &sr, nil
+}
+
+func (s *Store) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	v, err := s.load(ctx, listKey(s.ns, filters, limit, offset), &s.stats.List, true, func(ctx context.Context) (any, int64, error) {
+		page, total, err := s.next.List(ctx, filters, limit, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		size := int64(64)
+		for i := range page {
+			size += resourceSize(&page[i])
+		}
+		return &listPage{page: page, total: total}, size, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	lp := v.(*listPage)
+	page := make([]handlers.StringResource, len(lp.page))
+	for i := range lp.page {
+		page[i] = cloneResource(lp.page[i])
+	}
+	return page, lp.total, nil
+}
+
+// Exists is answered from a cached Get entry when there is one.
+func (s *Store) Exists(ctx context.Context, value string) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.lookup(getKey(s.ns, value), false, handlers.NowFrom(ctx))
+	s.mu.Unlock()
+	if ok {
+		return true, nil
+	}
+	return s.next.Exists(ctx, value)
+}
+
+// GetByID is not cached: a new string can make a cached prefix ambiguous.
+func (s *Store) GetByID(ctx context.Context, id string) (*handlers.StringResource, error) {
+	return s.next.GetByID(ctx, id)
+}
+
+func (s *Store) Create(ctx context.Context, sr *handlers.StringResource) error {
+	err := s.next.Create(ctx, sr)
+	if err == nil {
+		s.invalidate([]string{sr.Value}, nil)
+	}
+	return err
+}
+
+func (s *Store) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	stored, created, err := s.next.CreateIfAbsent(ctx, sr)
+	if created {
+		s.invalidate([]string{sr.Value}, nil)
+	}
+	return stored, created, err
+}
+
+// Delete invalidates even on failure: the store may have applied it.
+func (s *Store) Delete(ctx context.Context, value string) error {
+	err := s.next.Delete(ctx, value)
+	s.invalidate([]string{value}, nil)
+	return err
+}
+
+func (s *Store) DeleteByID(ctx context.Context, id string) error {
+	err := s.next.DeleteByID(ctx, id)
+	s.invalidate(nil, []string{id})
+	return err
+}
+
+var errUnsupported = fmt.Errorf("storecache: wrapped store: %w", handlers.ErrNotSupported)
+
+// ListStale implements handlers.ReanalysisStore when the wrapped store does.
+func (s *Store) ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]handlers.StringResource, int, error) {
+	rs, ok := s.next.(handlers.ReanalysisStore)
+	if !ok {
+		return nil, 0, errUnsupported
+	}
+	return rs.ListStale(ctx, filters, version, afterID, limit)
+}
+
+// UpdateProperties implements handlers.ReanalysisStore when the wrapped
+// store does.
+func (s *Store) UpdateProperties(ctx context.Context, sr *handlers.StringResource) error {
+	rs, ok := s.next.(handlers.ReanalysisStore)
+	if !ok {
+		return errUnsupported
+	}
+	err := rs.UpdateProperties(ctx, sr)
+	s.invalidate(nil, []string{sr.ID})
+	return err
+}
+
+// Trash implements handlers.TrashStore when the wrapped store does.
+func (s *Store) Trash(ctx context.Context, value string, at time.Time) error {
+	ts, ok := s.next.(handlers.TrashStore)
+	if !ok {
+		return errUnsupported
+	}
+	err := ts.Trash(ctx, value, at)
+	s.invalidate([]string{value}, nil)
+	return err
+}
+
+// Restore implements handlers.TrashStore when the wrapped store does.
+func (s *Store) Restore(ctx context.Context, value string) (*handlers.StringResource, error) {
+	ts, ok := s.next.(handlers.TrashStore)
+	if !ok {
+		return nil, errUnsupported
+	}
+	sr, err := ts.Restore(ctx, value)
+	s.invalidate([]string{value}, nil)
+	return sr, err
+}
+
+// Purge implements handlers.TrashStore when the wrapped store does.
+func (s *Store) Purge(ctx context.Context, before time.Time) (int, error) {
+	ts, ok := s.next.(handlers.TrashStore)
+	if !ok {
+		return 0, errUnsupported
+	}
+	n, err := ts.Purge(ctx, before)
+	if n > 0 || err != nil {
+		s.invalidateAll()
+	}
+	return n, err
+}
+
+// Annotate implements handlers.AnnotationStore when the wrapped store does.
+func (s *Store) Annotate(ctx context.Context, value string, patch handlers.AnnotationPatch) (*handlers.StringResource, error) {
+	as, ok := s.next.(handlers.AnnotationStore)
+	if !ok {
+		return nil, errUnsupported
+	}
+	sr, err := as.Annotate(ctx, value, patch)
+	s.invalidate([]string{value}, nil)
+	return sr, err
+}
+
+// TagCounts is not cached; it forwards to the wrapped store.
+func (s *Store) TagCounts(ctx context.Context) ([]handlers.TagCount, error) {
+	as, ok := s.next.(handlers.AnnotationStore)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return as.TagCounts(ctx)
+}
+
+// Events is not cached; it forwards to the wrapped store.
+func (s *Store) Events(ctx context.Context, filter handlers.EventFilter, limit, offset int) ([]handlers.Event, int, error) {
+	es, ok := s.next.(handlers.EventStore)
+	if !ok {
+		return nil, 0, errUnsupported
+	}
+	return es.Events(ctx, filter, limit, offset)
+}
+
+// retention forwards a handlers.RetentionStore call to the wrapped store
+// and, since it cannot tell which values went, empties the cache if any did.
+func (s *Store) retention(del func(handlers.RetentionStore) (int, error)) (int, error) {
+	rs, ok := s.next.(handlers.RetentionStore)
+	if !ok {
+		return 0, errUnsupported
+	}
+	n, err := del(rs)
+	if n > 0 || err != nil {
+		s.invalidateAll()
+	}
+	return n, err
+}
+
+// DeleteExpired implements handlers.RetentionStore when the wrapped store
+// does.
+func (s *Store) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	return s.retention(func(rs handlers.RetentionStore) (int, error) { return rs.DeleteExpired(ctx, now, limit) })
+}
+
+// DeleteCreatedBefore implements handlers.RetentionStore when the wrapped
+// store does.
+func (s *Store) DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	return s.retention(func(rs handlers.RetentionStore) (int, error) { return rs.DeleteCreatedBefore(ctx, cutoff, limit) })
+}
+
+// DeleteOldest implements handlers.RetentionStore when the wrapped store
+// does.
+func (s *Store) DeleteOldest(ctx context.Context, keep, limit int) (int, error) {
+	return s.retention(func(rs handlers.RetentionStore) (int, error) { return rs.DeleteOldest(ctx, keep, limit) })
+}
+
+// ExplainList forwards to the wrapped store. Without a QueryExplainer
+// underneath it returns no plan.
+func (s *Store) ExplainList(ctx context.Context, filters map[string]any, limit, offset int) (*handlers.QueryPlan, error) {
+	if qe, ok := s.next.(handlers.QueryExplainer); ok {
+		return qe.ExplainList(ctx, filters, limit, offset)
+	}
+	return nil, nil
+}
+
+// Close closes the wrapped store if it has a Close method.
+func (s *Store) Close() error {
+	if c, ok := s.next.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
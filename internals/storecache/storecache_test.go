@@ -0,0 +1,278 @@
+package storecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+	"github.com/kodevoid/string_analyzer/internals/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.StringStore {
+		return New(memstore.New(), Options{})
+	})
+}
+
+// counting counts reads reaching the wrapped store. When gate is set, reads
+// block until it is closed.
+type counting struct {
+	*memstore.Store
+	gets, lists atomic.Int64
+	gate        chan struct{}
+}
+
+func (c *counting) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	c.gets.Add(1)
+	if c.gate != nil {
+		<-c.gate
+	}
+	return c.Store.Get(ctx, value)
+}
+
+func (c *counting) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	c.lists.Add(1)
+	if c.gate != nil {
+		<-c.gate
+	}
+	return c.Store.List(ctx, filters, limit, offset)
+}
+
+func newResource(value string) *handlers.StringResource {
+	props := handlers.ComputeProperties(value)
+	return &handlers.StringResource{ID: props.SHA256Hash, Value: value, Properties: props, CreatedAt: time.Now().UTC().Truncate(time.Second), AnalyzerVersion: handlers.AnalyzerVersion}
+}
+
+func seed(t *testing.T, s handlers.StringStore, values ...string) {
+	t.Helper()
+	for _, v := range values {
+		if err := s.Create(context.Background(), newResource(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	back := &counting{Store: memstore.New()}
+	s := New(back, Options{})
+	seed(t, s, "racecar", "hello")
+
+	for range 3 {
+		if _, err := s.Get(ctx, "racecar"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.List(ctx, map[string]any{"is_palindrome": true}, 10, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if back.gets.Load() != 1 || back.lists.Load() != 1 {
+		t.Fatalf("store reads = %d gets, %d lists; want 1 each", back.gets.Load(), back.lists.Load())
+	}
+
+	// A new palindrome must show up in the cached page
+	seed(t, s, "noon")
+	page, total, err := s.List(ctx, map[string]any{"is_palindrome": true}, 10, 0)
+	if err != nil || total != 2 || len(page) != 2 {
+		t.Errorf("list after create = %d items, total %d, %v; want 2", len(page), total, err)
+	}
+
+	// Deleting by ID drops the Get entry cached by value
+	sr, _ := s.Get(ctx, "racecar")
+	if err := s.DeleteByID(ctx, sr.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "racecar"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get after DeleteByID: %v, want ErrNotFound", err)
+	}
+	if ok, _ := s.Exists(ctx, "racecar"); ok {
+		t.Error("Exists after DeleteByID = true")
+	}
+
+	st := s.CacheStats()
+	if st.Get.Hits != 3 || st.Get.Misses != 2 || st.List.Hits != 2 || st.List.Misses != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+	if st.Invalidations != 4 {
+		t.Errorf("invalidations = %d, want 4", st.Invalidations)
+	}
+}
+
+func TestResultsAreCopies(t *testing.T) {
+	ctx := context.Background()
+	s := New(memstore.New(), Options{})
+	seed(t, s, "abc")
+	sr, _ := s.Get(ctx, "abc")
+	sr.Properties.CharacterFrequencyMap["a"] = 99
+	sr, _ = s.Get(ctx, "abc")
+	if sr.Properties.CharacterFrequencyMap["a"] != 1 {
+		t.Errorf("caller mutated the cached resource: %v", sr.Properties.CharacterFrequencyMap)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	ctx := context.Background()
+	back := &counting{Store: memstore.New()}
+	s := New(back, Options{})
+	seed(t, s, "racecar")
+	back.gate = make(chan struct{})
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Get(ctx, "racecar")
+			errs <- err
+		}()
+	}
+	// Let every caller reach the flight before the load finishes
+	for s.CacheStats().Get.Misses < n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(back.gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := back.gets.Load(); got != 1 {
+		t.Errorf("store gets = %d, want 1", got)
+	}
+	if got := s.CacheStats().Get.Coalesced; got != n-1 {
+		t.Errorf("coalesced = %d, want %d", got, n-1)
+	}
+}
+
+// TestNoStaleFill checks that a page loaded before a write finishes is not
+// cached after it.
+func TestNoStaleFill(t *testing.T) {
+	ctx := context.Background()
+	back := &counting{Store: memstore.New(), gate: make(chan struct{})}
+	s := New(back, Options{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.List(ctx, nil, 10, 0)
+	}()
+	for back.lists.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	seed(t, s, "hello")
+	close(back.gate)
+	<-done
+
+	_, total, err := s.List(ctx, nil, 10, 0)
+	if err != nil || total != 1 {
+		t.Errorf("total = %d, %v; want 1", total, err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	back := &counting{Store: memstore.New()}
+	s := New(back, Options{MaxEntries: 2})
+	seed(t, s, "a", "b", "c")
+	for _, v := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := s.Get(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a, b, (a hit), c evicts b, (a hit), b evicts c
+	if got := back.gets.Load(); got != 4 {
+		t.Errorf("store gets = %d, want 4", got)
+	}
+	st := s.CacheStats()
+	if st.Entries != 2 || st.Evictions != 2 {
+		t.Errorf("entries = %d, evictions = %d; want 2, 2", st.Entries, st.Evictions)
+	}
+
+	big := strings.Repeat("x", 4096)
+	s = New(back, Options{MaxBytes: 1024})
+	seed(t, s, big)
+	s.Get(ctx, big)
+	if st := s.CacheStats(); st.Entries != 0 || st.Bytes != 0 {
+		t.Errorf("oversized entry cached: %+v", st)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	back := &counting{Store: memstore.New()}
+	s := New(back, Options{TTL: time.Minute})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	seed(t, s, "hello")
+
+	s.Get(ctx, "hello")
+	now = now.Add(59 * time.Second)
+	s.Get(ctx, "hello")
+	now = now.Add(time.Second)
+	s.Get(ctx, "hello")
+	if got := back.gets.Load(); got != 2 {
+		t.Errorf("store gets = %d, want 2", got)
+	}
+}
+
+// TestResourceExpiry checks that entries holding a resource are dropped
+// once its ExpiresAt passes at the context's time, before the cache TTL.
+func TestResourceExpiry(t *testing.T) {
+	ctx := context.Background()
+	back := &counting{Store: memstore.New()}
+	s := New(back, Options{TTL: time.Hour})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	sr := newResource("short-lived")
+	expiresAt := now.Add(30 * time.Second)
+	sr.ExpiresAt = &expiresAt
+	if err := s.Create(ctx, sr); err != nil {
+		t.Fatal(err)
+	}
+	seed(t, s, "kept")
+
+	for range 2 {
+		at := handlers.WithNow(ctx, now)
+		s.Get(at, "short-lived")
+		s.Get(at, "kept")
+		s.List(at, nil, 10, 0)
+		now = now.Add(30 * time.Second)
+	}
+	if gets, lists := back.gets.Load(), back.lists.Load(); gets != 3 || lists != 2 {
+		t.Errorf("store gets, lists = %d, %d; want 3, 2", gets, lists)
+	}
+}
+
+func TestCacheEndpoint(t *testing.T) {
+	s := New(memstore.New(), Options{})
+	seed(t, s, "hello")
+	router := handlers.SetupRoutes(s)
+	for range 2 {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/strings/hello", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"get":{"hits":1,"misses":1,"coalesced":0}`) {
+		t.Errorf("GET /admin/cache = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handlers.SetupRoutes(memstore.New()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cache", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("uncached store: status %d, want 501", rec.Code)
+	}
+}
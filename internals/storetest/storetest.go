@@ -0,0 +1,1245 @@
+// Package storetest is a behavioral test suite for handlers.StringStore
+// implementations. Every backend runs the same suite, so filter semantics,
+// pagination and error types cannot drift apart:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) handlers.StringStore {
+//			return newStore(t)
+//		})
+//	}
+//
+// Timestamps in the suite have whole-second precision, the finest that every
+// backend is required to keep. List may return matches in any order, but the
+// order must be stable so that pages neither overlap nor skip items.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+// Run runs the suite. newStore must return a new, empty store on every call;
+// it is responsible for registering any cleanup with t.
+func Run(t *testing.T, newStore func(t *testing.T) handlers.StringStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s handlers.StringStore)
+	}{
+		{"CRUD", testCRUD},
+		{"Errors", testErrors},
+		{"Filters", testFilters},
+		{"Pagination", testPagination},
+		{"Unicode", testUnicode},
+		{"Concurrency", testConcurrency},
+		{"Reanalysis", testReanalysis},
+		{"Trash", testTrash},
+		{"Retention", testRetention},
+		{"Annotations", testAnnotations},
+		{"AnnotationPatches", testAnnotationPatches},
+		{"Namespaces", testNamespaces},
+		{"Events", testEvents},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+// t0 is the creation time of the first seeded resource.
+var t0 = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func resource(value string, createdAt time.Time) *handlers.StringResource {
+	props := handlers.ComputeProperties(value)
+	return &handlers.StringResource{
+		ID:              props.SHA256Hash,
+		Value:           value,
+		Properties:      props,
+		CreatedAt:       createdAt,
+		AnalyzerVersion: handlers.AnalyzerVersion,
+	}
+}
+
+func create(t *testing.T, s handlers.StringStore, sr *handlers.StringResource) {
+	t.Helper()
+	if err := s.Create(context.Background(), sr); err != nil {
+		t.Fatalf("Create(%q): %v", sr.Value, err)
+	}
+}
+
+// seed stores values created one hour apart, starting at t0.
+func seed(t *testing.T, s handlers.StringStore, values ...string) {
+	t.Helper()
+	for i, v := range values {
+		create(t, s, resource(v, t0.Add(time.Duration(i)*time.Hour)))
+	}
+}
+
+// checkResource fails unless got holds the same data as want.
+func checkResource(t *testing.T, got, want *handlers.StringResource) {
+	t.Helper()
+	switch {
+	case got == nil:
+		t.Errorf("got nil, want %q", want.Value)
+	case got.ID != want.ID || got.Value != want.Value:
+		t.Errorf("got %s/%q, want %s/%q", got.ID, got.Value, want.ID, want.Value)
+	case !reflect.DeepEqual(got.Properties, want.Properties):
+		t.Errorf("%q: properties = %+v, want %+v", want.Value, got.Properties, want.Properties)
+	case !got.CreatedAt.Equal(want.CreatedAt):
+		t.Errorf("%q: created_at = %v, want %v", want.Value, got.CreatedAt, want.CreatedAt)
+	case got.AnalyzerVersion != want.AnalyzerVersion:
+		t.Errorf("%q: analyzer_version = %d, want %d", want.Value, got.AnalyzerVersion, want.AnalyzerVersion)
+	}
+}
+
+// sortedValues returns the values of page in sorted order.
+func sortedValues(page []handlers.StringResource) []string {
+	vs := make([]string, len(page))
+	for i, sr := range page {
+		vs[i] = sr.Value
+	}
+	slices.Sort(vs)
+	return vs
+}
+
+func testCRUD(t *testing.T, s handlers.StringStore) {
+	ctx := context.Background()
+	sr := resource("racecar", t0)
+
+	if ok, err := s.Exists(ctx, sr.Value); err != nil || ok {
+		t.Fatalf("Exists before Create = %v, %v; want false, nil", ok, err)
+	}
+	create(t, s, sr)
+	if ok, err := s.Exists(ctx, sr.Value); err != nil || !ok {
+		t.Errorf("Exists after Create = %v, %v; want true, nil", ok, err)
+	}
+
+	got, err := s.Get(ctx, sr.Value)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	checkResource(t, got, sr)
+
+	got, err = s.GetByID(ctx, sr.ID)
+	if err != nil {
+		t.Fatalf("GetByID(full): %v", err)
+	}
+	checkResource(t, got, sr)
+	got, err = s.GetByID(ctx, sr.ID[:8])
+	if err != nil {
+		t.Fatalf("GetByID(prefix): %v", err)
+	}
+	checkResource(t, got, sr)
+
+	// CreateIfAbsent returns the stored resource, not its argument
+	dup := resource(sr.Value, t0.Add(time.Hour))
+	stored, created, err := s.CreateIfAbsent(ctx, dup)
+	if err != nil || created {
+		t.Fatalf("CreateIfAbsent(existing) = created %v, %v; want false, nil", created, err)
+	}
+	checkResource(t, stored, sr)
+
+	other := resource("level", t0.Add(time.Hour))
+	stored, created, err = s.CreateIfAbsent(ctx, other)
+	if err != nil || !created {
+		t.Fatalf("CreateIfAbsent(new) = created %v, %v; want true, nil", created, err)
+	}
+	checkResource(t, stored, other)
+
+	if err := s.Delete(ctx, sr.Value); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if ok, _ := s.Exists(ctx, sr.Value); ok {
+		t.Error("Exists after Delete = true")
+	}
+	if _, err := s.GetByID(ctx, sr.ID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("GetByID after Delete: expected ErrNotFound, got %v", err)
+	}
+
+	if err := s.DeleteByID(ctx, other.ID); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	if _, err := s.Get(ctx, other.Value); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get after DeleteByID: expected ErrNotFound, got %v", err)
+	}
+
+	// A deleted value can be created again
+	create(t, s, sr)
+	if _, total, err := s.List(ctx, nil, 10, 0); err != nil || total != 1 {
+		t.Errorf("List after re-create = total %d, %v; want 1", total, err)
+	}
+}
+
+func testErrors(t *testing.T, s handlers.StringStore) {
+	ctx := context.Background()
+	create(t, s, resource("racecar", t0))
+
+	if err := s.Create(ctx, resource("racecar", t0)); !errors.Is(err, handlers.ErrConflict) {
+		t.Errorf("duplicate Create: expected ErrConflict, got %v", err)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get(missing): expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete(ctx, "missing"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Delete(missing): expected ErrNotFound, got %v", err)
+	}
+	missingID := strings.Repeat("0", 64)
+	if _, err := s.GetByID(ctx, missingID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("GetByID(missing): expected ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteByID(ctx, missingID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("DeleteByID(missing): expected ErrNotFound, got %v", err)
+	}
+
+	// Two IDs sharing a prefix
+	a, b := resource("ambiguous a", t0), resource("ambiguous b", t0)
+	a.ID = "abcd0001" + strings.Repeat("0", 56)
+	b.ID = "abcd0002" + strings.Repeat("0", 56)
+	create(t, s, a)
+	create(t, s, b)
+	if _, err := s.GetByID(ctx, "abcd000"); !errors.Is(err, handlers.ErrAmbiguous) {
+		t.Errorf("GetByID(shared prefix): expected ErrAmbiguous, got %v", err)
+	}
+	if got, err := s.GetByID(ctx, "abcd0002"); err != nil || got.Value != b.Value {
+		t.Errorf("GetByID(unique prefix) = %v, %v; want %q", got, err, b.Value)
+	}
+	// DeleteByID takes full IDs only
+	if err := s.DeleteByID(ctx, "abcd0002"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("DeleteByID(prefix): expected ErrNotFound, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Get(cancelled, "racecar"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get with cancelled context: expected context.Canceled, got %v", err)
+	}
+	if _, _, err := s.List(cancelled, nil, 10, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("List with cancelled context: expected context.Canceled, got %v", err)
+	}
+	if err := s.Create(cancelled, resource("late", t0)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create with cancelled context: expected context.Canceled, got %v", err)
+	}
+	if ok, _ := s.Exists(ctx, "late"); ok {
+		t.Error("Create with cancelled context stored the resource")
+	}
+}
+
+// filterData is seeded one hour apart from t0, so "+N" below means
+// t0.Add(N * time.Hour).
+var filterData = []string{
+	"racecar",             // +0 palindrome, length 7, 1 word
+	"hello world",         // +1 length 11, 2 words
+	"level",               // +2 palindrome, length 5
+	"a",                   // +3 palindrome, length 1
+	"step on no pets",     // +4 palindrome, length 15, 4 words
+	"the quick brown dog", // +5 length 19, 4 words
+	"xyz",                 // +6 length 3
+	"noon",                // +7 palindrome, length 4
+}
+
+func hours(n int) time.Time { return t0.Add(time.Duration(n) * time.Hour) }
+
+func testFilters(t *testing.T, s handlers.StringStore) {
+	seed(t, s, filterData...)
+
+	cases := []struct {
+		name    string
+		filters map[string]any
+		want    []string
+	}{
+		{"none", nil, filterData},
+		{"empty", map[string]any{}, filterData},
+		{"is_palindrome=true", map[string]any{"is_palindrome": true},
+			[]string{"racecar", "level", "a", "step on no pets", "noon"}},
+		{"is_palindrome=false", map[string]any{"is_palindrome": false},
+			[]string{"hello world", "the quick brown dog", "xyz"}},
+		{"min_length inclusive", map[string]any{"min_length": 5},
+			[]string{"racecar", "hello world", "level", "step on no pets", "the quick brown dog"}},
+		{"max_length inclusive", map[string]any{"max_length": 4},
+			[]string{"a", "xyz", "noon"}},
+		{"length range", map[string]any{"min_length": 4, "max_length": 7},
+			[]string{"racecar", "level", "noon"}},
+		{"empty length range", map[string]any{"min_length": 8, "max_length": 3}, nil},
+		{"word_count", map[string]any{"word_count": 4},
+			[]string{"step on no pets", "the quick brown dog"}},
+		{"word_count none", map[string]any{"word_count": 0}, nil},
+		{"contains_character", map[string]any{"contains_character": "o"},
+			[]string{"hello world", "step on no pets", "the quick brown dog", "noon"}},
+		{"contains_character space", map[string]any{"contains_character": " "},
+			[]string{"hello world", "step on no pets", "the quick brown dog"}},
+		{"contains_character is case sensitive", map[string]any{"contains_character": "Z"}, nil},
+		{"created_after inclusive", map[string]any{"created_after": hours(5)},
+			[]string{"the quick brown dog", "xyz", "noon"}},
+		{"created_before exclusive", map[string]any{"created_before": hours(2)},
+			[]string{"racecar", "hello world"}},
+		{"created window", map[string]any{"created_after": hours(1), "created_before": hours(4)},
+			[]string{"hello world", "level", "a"}},
+		{"combined", map[string]any{"is_palindrome": true, "contains_character": "o", "word_count": 1},
+			[]string{"noon"}},
+		{"combined with time", map[string]any{"is_palindrome": false, "min_length": 3, "created_after": hours(3)},
+			[]string{"the quick brown dog", "xyz"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, total, err := s.List(context.Background(), tc.filters, 100, 0)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			want := slices.Clone(tc.want)
+			slices.Sort(want)
+			if got := sortedValues(page); !slices.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if total != len(want) {
+				t.Errorf("total = %d, want %d", total, len(want))
+			}
+		})
+	}
+}
+
+func testPagination(t *testing.T, s handlers.StringStore) {
+	ctx := context.Background()
+	seed(t, s, filterData...)
+
+	// walk pages of size limit and check they partition the full result
+	walk := func(filters map[string]any, limit, wantTotal int) {
+		t.Helper()
+		var all []handlers.StringResource
+		for offset := 0; offset < wantTotal; offset += limit {
+			page, total, err := s.List(ctx, filters, limit, offset)
+			if err != nil {
+				t.Fatalf("List(limit %d, offset %d): %v", limit, offset, err)
+			}
+			if total != wantTotal {
+				t.Errorf("List(limit %d, offset %d) total = %d, want %d", limit, offset, total, wantTotal)
+			}
+			if want := min(limit, wantTotal-offset); len(page) != want {
+				t.Errorf("List(limit %d, offset %d) returned %d items, want %d", limit, offset, len(page), want)
+			}
+			all = append(all, page...)
+		}
+		got := sortedValues(all)
+		if len(slices.Compact(slices.Clone(got))) != len(got) {
+			t.Errorf("pages of %d overlap: %q", limit, got)
+		}
+		if len(got) != wantTotal {
+			t.Errorf("pages of %d covered %d items, want %d", limit, len(got), wantTotal)
+		}
+	}
+	for _, limit := range []int{1, 3, 7, 8, 100} {
+		walk(nil, limit, len(filterData))
+	}
+	walk(map[string]any{"is_palindrome": true}, 2, 5)
+
+	for _, offset := range []int{len(filterData), len(filterData) + 1, 1000} {
+		page, total, err := s.List(ctx, nil, 10, offset)
+		if err != nil {
+			t.Fatalf("List(offset %d): %v", offset, err)
+		}
+		if len(page) != 0 || total != len(filterData) {
+			t.Errorf("List(offset %d) = %d items, total %d; want 0, %d", offset, len(page), total, len(filterData))
+		}
+	}
+}
+
+func testUnicode(t *testing.T, s handlers.StringStore) {
+	ctx := context.Background()
+	values := []string{
+		"café",              // precomposed é
+		"cafe\u0301",        // e + combining acute accent
+		"日本語",               // multi-byte CJK
+		"👍🏽",                // emoji + skin tone modifier
+		"Ünïcödé façade",    // Latin-1 supplement
+		"∑ ∫ √",             // symbols
+		"tab\tand\nnewline", // control characters
+		`quote ' and "`,     // SQL and JSON metacharacters
+	}
+	seed(t, s, values...)
+
+	for i, v := range values {
+		got, err := s.Get(ctx, v)
+		if err != nil {
+			t.Errorf("Get(%q): %v", v, err)
+			continue
+		}
+		checkResource(t, got, resource(v, hours(i)))
+	}
+	// No normalization or case folding on lookup
+	for _, v := range []string{"cafe", "CAFÉ", "👍"} {
+		if _, err := s.Get(ctx, v); !errors.Is(err, handlers.ErrNotFound) {
+			t.Errorf("Get(%q): expected ErrNotFound, got %v", v, err)
+		}
+	}
+
+	for ch, want := range map[string][]string{
+		"é":      {"café", "Ünïcödé façade"},
+		"\u0301": {"cafe\u0301"},
+		"日":      {"日本語"},
+		"👍":      {"👍🏽"},
+		"🏽":      {"👍🏽"},
+		"∫":      {"∑ ∫ √"},
+		"\n":     {"tab\tand\nnewline"},
+		"'":      {`quote ' and "`},
+		"%":      nil, // LIKE wildcards must not match anything
+		"_":      nil,
+	} {
+		page, total, err := s.List(ctx, map[string]any{"contains_character": ch}, 100, 0)
+		if err != nil {
+			t.Fatalf("List(contains %q): %v", ch, err)
+		}
+		slices.Sort(want)
+		if got := sortedValues(page); !slices.Equal(got, want) || total != len(want) {
+			t.Errorf("contains %q = %q (total %d), want %q", ch, got, total, want)
+		}
+	}
+}
+
+func testConcurrency(t *testing.T, s handlers.StringStore) {
+	ctx := context.Background()
+	const workers = 16
+
+	// Racing CreateIfAbsent calls for one value: exactly one creates it
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	ids := make(map[string]bool)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sr := resource("contended", hours(i))
+			stored, ok, err := s.CreateIfAbsent(ctx, sr)
+			if err != nil {
+				t.Errorf("CreateIfAbsent: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				created++
+			}
+			ids[stored.ID] = true
+		}()
+	}
+	wg.Wait()
+	if created != 1 || len(ids) != 1 {
+		t.Errorf("racing CreateIfAbsent: %d created, %d distinct IDs; want 1 and 1", created, len(ids))
+	}
+
+	// Distinct writes interleaved with reads all land
+	const perWorker = 10
+	for w := range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				if err := s.Create(ctx, resource(fmt.Sprintf("w%d-%d", w, i), t0)); err != nil {
+					t.Errorf("Create: %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				if _, _, err := s.List(ctx, map[string]any{"min_length": 4}, 20, 0); err != nil {
+					t.Errorf("List: %v", err)
+				}
+				if _, err := s.Get(ctx, "contended"); err != nil {
+					t.Errorf("Get: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if _, total, err := s.List(ctx, nil, 1, 0); err != nil || total != workers*perWorker+1 {
+		t.Errorf("List total after concurrent creates = %d, %v; want %d", total, err, workers*perWorker+1)
+	}
+
+	// Racing deletes: exactly one succeeds, the rest see ErrNotFound
+	deleted := 0
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Delete(ctx, "contended")
+			switch {
+			case err == nil:
+				mu.Lock()
+				deleted++
+				mu.Unlock()
+			case !errors.Is(err, handlers.ErrNotFound):
+				t.Errorf("racing Delete: expected nil or ErrNotFound, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if deleted != 1 {
+		t.Errorf("racing Delete: %d succeeded, want 1", deleted)
+	}
+}
+
+// testReanalysis covers handlers.ReanalysisStore for stores that implement it.
+func testReanalysis(t *testing.T, s handlers.StringStore) {
+	rs, ok := s.(handlers.ReanalysisStore)
+	if !ok {
+		t.Skip("store does not implement handlers.ReanalysisStore")
+	}
+	ctx := context.Background()
+	version := handlers.AnalyzerVersion + 1
+
+	var stale []string
+	for i, v := range []string{"racecar", "hello world", "level", "noon"} {
+		sr := resource(v, hours(i))
+		create(t, s, sr)
+		stale = append(stale, sr.ID)
+	}
+	current := resource("current", hours(9))
+	current.AnalyzerVersion = version
+	create(t, s, current)
+	slices.Sort(stale)
+
+	// Keyset pages ordered by ID
+	var got []string
+	for afterID := ""; ; {
+		page, total, err := rs.ListStale(ctx, nil, version, afterID, 3)
+		if err != nil {
+			t.Fatalf("ListStale: %v", err)
+		}
+		if total != len(stale) {
+			t.Errorf("ListStale total = %d, want %d", total, len(stale))
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, sr := range page {
+			got = append(got, sr.ID)
+		}
+		afterID = page[len(page)-1].ID
+	}
+	if !slices.Equal(got, stale) {
+		t.Errorf("ListStale IDs = %q, want %q", got, stale)
+	}
+
+	page, total, err := rs.ListStale(ctx, map[string]any{"is_palindrome": true}, version, "", 10)
+	if err != nil || total != 3 || len(page) != 3 {
+		t.Errorf("filtered ListStale = %d items, total %d, %v; want 3, 3", len(page), total, err)
+	}
+
+	sr := page[0]
+	sr.AnalyzerVersion = version
+	if err := rs.UpdateProperties(ctx, &sr); err != nil {
+		t.Fatalf("UpdateProperties: %v", err)
+	}
+	if got, err := s.Get(ctx, sr.Value); err != nil || got.AnalyzerVersion != version {
+		t.Errorf("after UpdateProperties got %+v, %v; want analyzer_version %d", got, err, version)
+	}
+	if _, total, _ := rs.ListStale(ctx, nil, version, "", 10); total != len(stale)-1 {
+		t.Errorf("ListStale total after update = %d, want %d", total, len(stale)-1)
+	}
+
+	missing := resource("missing", t0)
+	if err := rs.UpdateProperties(ctx, missing); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("UpdateProperties(missing): expected ErrNotFound, got %v", err)
+	}
+}
+
+// listValues returns the sorted values of every resource matching filters.
+func listValues(t *testing.T, s handlers.StringStore, filters map[string]any) []string {
+	t.Helper()
+	page, total, err := s.List(context.Background(), filters, 100, 0)
+	if err != nil {
+		t.Fatalf("List(%v): %v", filters, err)
+	}
+	if total != len(page) {
+		t.Errorf("List(%v) total = %d, want %d", filters, total, len(page))
+	}
+	return sortedValues(page)
+}
+
+// testTrash covers handlers.TrashStore for stores that implement it.
+func testTrash(t *testing.T, s handlers.StringStore) {
+	ts, ok := s.(handlers.TrashStore)
+	if !ok {
+		t.Skip("store does not implement handlers.TrashStore")
+	}
+	ctx := context.Background()
+	seed(t, s, "racecar", "hello", "level", "noon")
+
+	if err := ts.Trash(ctx, "racecar", hours(10)); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	if err := ts.Trash(ctx, "hello", hours(20)); err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	if err := ts.Trash(ctx, "hello", hours(21)); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Trash of a trashed value: expected ErrNotFound, got %v", err)
+	}
+	if err := ts.Trash(ctx, "missing", hours(21)); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Trash(missing): expected ErrNotFound, got %v", err)
+	}
+
+	// Lookups still see trashed resources, marked by DeletedAt
+	got, err := s.Get(ctx, "racecar")
+	if err != nil || got.DeletedAt == nil || !got.DeletedAt.Equal(hours(10)) {
+		t.Errorf("Get(trashed) = %+v, %v; want deleted_at %v", got, err, hours(10))
+	}
+	if ok, err := s.Exists(ctx, "racecar"); err != nil || !ok {
+		t.Errorf("Exists(trashed) = %v, %v; want true", ok, err)
+	}
+
+	lists := []struct {
+		filters map[string]any
+		want    []string
+	}{
+		{nil, []string{"level", "noon"}},
+		{map[string]any{"is_palindrome": true}, []string{"level", "noon"}},
+		{map[string]any{"include_deleted": true}, []string{"hello", "level", "noon", "racecar"}},
+		{map[string]any{"include_deleted": true, "is_palindrome": true}, []string{"level", "noon", "racecar"}},
+		{map[string]any{"deleted": true}, []string{"hello", "racecar"}},
+		{map[string]any{"deleted": true, "is_palindrome": true}, []string{"racecar"}},
+	}
+	for _, tc := range lists {
+		if got := listValues(t, s, tc.filters); !slices.Equal(got, tc.want) {
+			t.Errorf("List(%v) = %q, want %q", tc.filters, got, tc.want)
+		}
+	}
+
+	restored, err := ts.Restore(ctx, "racecar")
+	if err != nil || restored.Value != "racecar" || restored.DeletedAt != nil {
+		t.Fatalf("Restore = %+v, %v; want racecar without deleted_at", restored, err)
+	}
+	if got, err := s.Get(ctx, "racecar"); err != nil || got.DeletedAt != nil {
+		t.Errorf("Get after Restore = %+v, %v", got, err)
+	}
+	if _, err := ts.Restore(ctx, "racecar"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Restore of a live value: expected ErrNotFound, got %v", err)
+	}
+	if got := listValues(t, s, nil); !slices.Equal(got, []string{"level", "noon", "racecar"}) {
+		t.Errorf("List after Restore = %q", got)
+	}
+
+	// Purge removes only what was trashed before the cutoff
+	if err := ts.Trash(ctx, "level", hours(30)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := ts.Purge(ctx, hours(30))
+	if err != nil || n != 1 {
+		t.Errorf("Purge = %d, %v; want 1", n, err)
+	}
+	if ok, _ := s.Exists(ctx, "hello"); ok {
+		t.Error("purged value still exists")
+	}
+	if got := listValues(t, s, map[string]any{"deleted": true}); !slices.Equal(got, []string{"level"}) {
+		t.Errorf("trash after Purge = %q, want [level]", got)
+	}
+	if n, err := ts.Purge(ctx, hours(31)); err != nil || n != 1 {
+		t.Errorf("second Purge = %d, %v; want 1", n, err)
+	}
+	if got := listValues(t, s, map[string]any{"include_deleted": true}); !slices.Equal(got, []string{"noon", "racecar"}) {
+		t.Errorf("List after Purge = %q", got)
+	}
+}
+
+// testRetention covers expiry and handlers.RetentionStore for stores that
+// implement it. Stores compare ExpiresAt with the wall clock, so expiry
+// times here are relative to now.
+func testRetention(t *testing.T, s handlers.StringStore) {
+	rs, ok := s.(handlers.RetentionStore)
+	if !ok {
+		t.Skip("store does not implement handlers.RetentionStore")
+	}
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	expiring := func(value string, createdAt, expiresAt time.Time) *handlers.StringResource {
+		sr := resource(value, createdAt)
+		sr.ExpiresAt = &expiresAt
+		return sr
+	}
+	seed(t, s, "alpha", "beta", "gamma")
+	create(t, s, expiring("fresh", hours(3), now.Add(time.Hour)))
+	gone := expiring("gone", hours(4), now.Add(-time.Hour))
+	create(t, s, gone)
+	create(t, s, expiring("also gone", hours(5), now.Add(-time.Minute)))
+
+	// Expired resources are invisible before they are deleted
+	if _, err := s.Get(ctx, "gone"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get(expired): expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetByID(ctx, gone.ID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("GetByID(expired): expected ErrNotFound, got %v", err)
+	}
+	if ok, err := s.Exists(ctx, "gone"); err != nil || ok {
+		t.Errorf("Exists(expired) = %v, %v; want false", ok, err)
+	}
+	lists := []struct {
+		filters map[string]any
+		want    []string
+	}{
+		{nil, []string{"alpha", "beta", "fresh", "gamma"}},
+		{map[string]any{"include_deleted": true}, []string{"alpha", "beta", "fresh", "gamma"}},
+		{map[string]any{"created_after": hours(2)}, []string{"fresh", "gamma"}},
+	}
+	for _, tc := range lists {
+		if got := listValues(t, s, tc.filters); !slices.Equal(got, tc.want) {
+			t.Errorf("List(%v) = %q, want %q", tc.filters, got, tc.want)
+		}
+	}
+	got, err := s.Get(ctx, "fresh")
+	if err != nil || got.ExpiresAt == nil || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Get(unexpired) = %+v, %v; want expires_at %v", got, err, now.Add(time.Hour))
+	}
+
+	// The time in the context, not the wall clock, decides what has expired
+	later := handlers.WithNow(ctx, now.Add(2*time.Hour))
+	if _, err := s.Get(later, "fresh"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get(fresh) two hours later: expected ErrNotFound, got %v", err)
+	}
+	if _, total, err := s.List(later, nil, 10, 0); err != nil || total != 3 {
+		t.Errorf("List two hours later: total %d, %v; want 3", total, err)
+	}
+	earlier := handlers.WithNow(ctx, now.Add(-2*time.Hour))
+	if ok, err := s.Exists(earlier, "gone"); err != nil || !ok {
+		t.Errorf("Exists(gone) two hours earlier = %v, %v; want true", ok, err)
+	}
+	if _, total, err := s.List(earlier, nil, 10, 0); err != nil || total != 6 {
+		t.Errorf("List two hours earlier: total %d, %v; want 6", total, err)
+	}
+
+	// Creating an expired value again replaces it
+	stored, created, err := s.CreateIfAbsent(ctx, resource("gone", hours(6)))
+	if err != nil || !created || stored.ExpiresAt != nil {
+		t.Fatalf("CreateIfAbsent(expired value) = %+v, %v, %v; want created", stored, created, err)
+	}
+	if got, err := s.Get(ctx, "gone"); err != nil || !got.CreatedAt.Equal(hours(6)) || got.ExpiresAt != nil {
+		t.Errorf("Get after re-create = %+v, %v", got, err)
+	}
+
+	// Deletes happen in batches of at most limit
+	for i, want := range []int{1, 0} {
+		if n, err := rs.DeleteExpired(ctx, now, 1); err != nil || n != want {
+			t.Errorf("DeleteExpired #%d = %d, %v; want %d", i+1, n, err, want)
+		}
+	}
+	if n, err := rs.DeleteExpired(ctx, now.Add(2*time.Hour), 10); err != nil || n != 1 {
+		t.Errorf("DeleteExpired(later) = %d, %v; want 1", n, err)
+	}
+	if n, err := rs.DeleteCreatedBefore(ctx, hours(2), 1); err != nil || n != 1 {
+		t.Errorf("DeleteCreatedBefore(limit 1) = %d, %v; want 1", n, err)
+	}
+	if got := listValues(t, s, nil); !slices.Equal(got, []string{"beta", "gamma", "gone"}) {
+		t.Errorf("List after DeleteCreatedBefore = %q", got)
+	}
+	if n, err := rs.DeleteOldest(ctx, 1, 1); err != nil || n != 1 {
+		t.Errorf("DeleteOldest(keep 1, limit 1) = %d, %v; want 1", n, err)
+	}
+	if n, err := rs.DeleteOldest(ctx, 1, 10); err != nil || n != 1 {
+		t.Errorf("DeleteOldest(keep 1) = %d, %v; want 1", n, err)
+	}
+	if n, err := rs.DeleteOldest(ctx, 1, 10); err != nil || n != 0 {
+		t.Errorf("DeleteOldest with nothing to trim = %d, %v; want 0", n, err)
+	}
+	if got := listValues(t, s, nil); !slices.Equal(got, []string{"gone"}) {
+		t.Errorf("List after DeleteOldest = %q, want [gone]", got)
+	}
+}
+
+// replaceAnnotations is a patch that sets exactly these tags and metadata.
+func replaceAnnotations(tags []string, metadata map[string]any) handlers.AnnotationPatch {
+	return handlers.AnnotationPatch{Tags: &tags, ClearMetadata: true, Metadata: metadata}
+}
+
+func testAnnotations(t *testing.T, s handlers.StringStore) {
+	as, ok := s.(handlers.AnnotationStore)
+	if !ok {
+		t.Skip("store does not implement handlers.AnnotationStore")
+	}
+	ctx := context.Background()
+	annotated := func(value string, createdAt time.Time, tags []string, metadata map[string]any) *handlers.StringResource {
+		sr := resource(value, createdAt)
+		sr.Tags, sr.Metadata = tags, metadata
+		return sr
+	}
+	create(t, s, annotated("alpha", hours(0), []string{"greek", "letter"}, map[string]any{"source": "crawler", "priority": float64(3)}))
+	create(t, s, annotated("beta", hours(1), []string{"greek"}, map[string]any{"source": "import", "nested": map[string]any{"a": true}}))
+	if _, _, err := s.CreateIfAbsent(ctx, annotated("gamma", hours(2), []string{"greek", "letter"}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	seed(t, s, "plain")
+
+	got, err := s.Get(ctx, "beta")
+	if err != nil || !slices.Equal(got.Tags, []string{"greek"}) || got.Metadata["source"] != "import" ||
+		got.Metadata["nested"].(map[string]any)["a"] != true {
+		t.Errorf("Get(annotated) = %+v, %v", got, err)
+	}
+	if got, err := s.Get(ctx, "plain"); err != nil || got.Tags != nil || got.Metadata != nil {
+		t.Errorf("Get(plain) = %+v, %v; want no tags or metadata", got, err)
+	}
+
+	lists := []struct {
+		filters map[string]any
+		want    []string
+	}{
+		{map[string]any{"tag": "greek"}, []string{"alpha", "beta", "gamma"}},
+		{map[string]any{"tag": "letter", "min_length": 5}, []string{"alpha", "gamma"}},
+		{map[string]any{"tag": "missing"}, []string{}},
+		{map[string]any{"meta.source": "crawler"}, []string{"alpha"}},
+		{map[string]any{"meta.priority": "3"}, []string{"alpha"}},
+		{map[string]any{"meta.source": "import", "tag": "letter"}, []string{}},
+		{map[string]any{"meta.nested": `{"a":true}`}, []string{"beta"}},
+	}
+	for _, tc := range lists {
+		if got := listValues(t, s, tc.filters); !slices.Equal(got, tc.want) {
+			t.Errorf("List(%v) = %q, want %q", tc.filters, got, tc.want)
+		}
+	}
+
+	// Annotate replaces both sets
+	updated, err := as.Annotate(ctx, "alpha", replaceAnnotations([]string{"first"}, map[string]any{"source": "manual"}))
+	if err != nil || !slices.Equal(updated.Tags, []string{"first"}) || len(updated.Metadata) != 1 || updated.Metadata["source"] != "manual" {
+		t.Errorf("Annotate = %+v, %v", updated, err)
+	}
+	if got, err := s.Get(ctx, "alpha"); err != nil || !slices.Equal(got.Tags, []string{"first"}) || got.Metadata["source"] != "manual" {
+		t.Errorf("Get after Annotate = %+v, %v", got, err)
+	}
+	if got := listValues(t, s, map[string]any{"meta.source": "crawler"}); len(got) != 0 {
+		t.Errorf("List(meta.source=crawler) after Annotate = %q, want none", got)
+	}
+	if updated, err := as.Annotate(ctx, "beta", replaceAnnotations(nil, nil)); err != nil || updated.Tags != nil || updated.Metadata != nil {
+		t.Errorf("Annotate(clear) = %+v, %v", updated, err)
+	}
+	if _, err := as.Annotate(ctx, "missing", replaceAnnotations([]string{"x"}, nil)); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Annotate(missing): expected ErrNotFound, got %v", err)
+	}
+
+	want := []handlers.TagCount{{Tag: "first", Count: 1}, {Tag: "greek", Count: 1}, {Tag: "letter", Count: 1}}
+	if counts, err := as.TagCounts(ctx); err != nil || !slices.Equal(counts, want) {
+		t.Errorf("TagCounts = %v, %v; want %v", counts, err, want)
+	}
+
+	// Trashed and expired strings are not counted or annotatable
+	if ts, ok := s.(handlers.TrashStore); ok {
+		if err := ts.Trash(ctx, "gamma", hours(10)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := as.Annotate(ctx, "gamma", replaceAnnotations([]string{"x"}, nil)); !errors.Is(err, handlers.ErrNotFound) {
+			t.Errorf("Annotate(trashed): expected ErrNotFound, got %v", err)
+		}
+		if got := listValues(t, s, map[string]any{"tag": "greek", "deleted": true}); !slices.Equal(got, []string{"gamma"}) {
+			t.Errorf("List(tag=greek, deleted) = %q, want [gamma]", got)
+		}
+	}
+	if _, ok := s.(handlers.RetentionStore); ok {
+		past := time.Now().Add(-time.Minute)
+		sr := annotated("expired", hours(11), []string{"first"}, nil)
+		sr.ExpiresAt = &past
+		create(t, s, sr)
+		if _, err := as.Annotate(ctx, "expired", replaceAnnotations([]string{"x"}, nil)); !errors.Is(err, handlers.ErrNotFound) {
+			t.Errorf("Annotate(expired): expected ErrNotFound, got %v", err)
+		}
+	}
+	want = []handlers.TagCount{{Tag: "first", Count: 1}}
+	if counts, err := as.TagCounts(ctx); err != nil || !slices.Equal(counts, want) {
+		t.Errorf("TagCounts after trash = %v, %v; want %v", counts, err, want)
+	}
+
+	// Deleting a string drops its annotations
+	if err := s.Delete(ctx, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if counts, err := as.TagCounts(ctx); err != nil || len(counts) != 0 {
+		t.Errorf("TagCounts after Delete = %v, %v; want none", counts, err)
+	}
+}
+
+// testAnnotationPatches covers merge patches applied by Annotate, including
+// concurrent patches that must not overwrite each other.
+func testAnnotationPatches(t *testing.T, s handlers.StringStore) {
+	as, ok := s.(handlers.AnnotationStore)
+	if !ok {
+		t.Skip("store does not implement handlers.AnnotationStore")
+	}
+	ctx := context.Background()
+	sr := resource("racecar", t0)
+	sr.Tags, sr.Metadata = []string{"sample"}, map[string]any{"source": "crawler", "nested": map[string]any{"a": true, "b": true}}
+	create(t, s, sr)
+
+	// Metadata merges key by key; tags are kept unless given
+	patch := handlers.AnnotationPatch{Metadata: map[string]any{"source": nil, "priority": float64(1), "nested": map[string]any{"b": nil}}}
+	got, err := as.Annotate(ctx, "racecar", patch)
+	want := map[string]any{"priority": float64(1), "nested": map[string]any{"a": true}}
+	if err != nil || !slices.Equal(got.Tags, []string{"sample"}) || !reflect.DeepEqual(got.Metadata, want) {
+		t.Errorf("Annotate(merge) = %+v, %v; want tags [sample], metadata %v", got, err, want)
+	}
+	if got, err := s.Get(ctx, "racecar"); err != nil || !reflect.DeepEqual(got.Metadata, want) {
+		t.Errorf("Get after merge = %+v, %v; want metadata %v", got, err, want)
+	}
+
+	// A patch that would exceed the size limit leaves the string alone
+	big := map[string]any{"big": strings.Repeat("x", handlers.MaxMetadataBytes)}
+	if _, err := as.Annotate(ctx, "racecar", handlers.AnnotationPatch{Metadata: big}); !errors.Is(err, handlers.ErrInvalid) {
+		t.Errorf("Annotate(too large): expected ErrInvalid, got %v", err)
+	}
+	if got, err := s.Get(ctx, "racecar"); err != nil || !reflect.DeepEqual(got.Metadata, want) {
+		t.Errorf("Get after rejected patch = %+v, %v; want metadata %v", got, err, want)
+	}
+
+	// Concurrent patches to different keys all land
+	if _, err := as.Annotate(ctx, "racecar", replaceAnnotations(nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	const workers = 16
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			patch := handlers.AnnotationPatch{Metadata: map[string]any{fmt.Sprintf("k%d", i): float64(i)}}
+			if i == 0 {
+				tags := []string{"tagged"}
+				patch = handlers.AnnotationPatch{Tags: &tags}
+			}
+			if _, err := as.Annotate(ctx, "racecar", patch); err != nil {
+				t.Errorf("Annotate: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	got, err = s.Get(ctx, "racecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Tags, []string{"tagged"}) {
+		t.Errorf("tags after concurrent patches = %q, want [tagged]", got.Tags)
+	}
+	for i := 1; i < workers; i++ {
+		if key := fmt.Sprintf("k%d", i); got.Metadata[key] != float64(i) {
+			t.Errorf("metadata after concurrent patches lacks %s: %v", key, got.Metadata)
+		}
+	}
+}
+
+// testNamespaces covers handlers.NamespaceStore for stores that implement it:
+// isolation between namespaces, quotas and the namespace lifecycle.
+func testNamespaces(t *testing.T, s handlers.StringStore) {
+	ns, ok := s.(handlers.NamespaceStore)
+	if !ok {
+		t.Skip("store does not implement handlers.NamespaceStore")
+	}
+	ctx := context.Background()
+	if _, err := ns.ListNamespaces(ctx); errors.Is(err, handlers.ErrNotSupported) {
+		t.Skip("store does not support namespaces")
+	}
+	if ns.In(handlers.DefaultNamespace) != s {
+		t.Error("In(DefaultNamespace) should return the store itself")
+	}
+
+	for _, n := range []handlers.Namespace{{Name: "acme", MaxStrings: 2, CreatedAt: t0}, {Name: "beta", CreatedAt: t0}} {
+		if err := ns.CreateNamespace(ctx, n); err != nil {
+			t.Fatalf("CreateNamespace(%s): %v", n.Name, err)
+		}
+	}
+	for _, name := range []string{"acme", handlers.DefaultNamespace} {
+		if err := ns.CreateNamespace(ctx, handlers.Namespace{Name: name, CreatedAt: t0}); !errors.Is(err, handlers.ErrConflict) {
+			t.Errorf("CreateNamespace(%s) again: expected ErrConflict, got %v", name, err)
+		}
+	}
+	acme, beta := ns.In("acme"), ns.In("beta")
+
+	// The same value lives independently in each namespace
+	seed(t, s, "shared", "root only")
+	other := resource("shared", hours(5))
+	create(t, acme, other)
+	create(t, acme, resource("acme only", hours(6)))
+	if got, err := s.Get(ctx, "shared"); err != nil || !got.CreatedAt.Equal(t0) {
+		t.Errorf("Get(shared) = %+v, %v; want the default namespace's", got, err)
+	}
+	if got, err := acme.Get(ctx, "shared"); err != nil || !got.CreatedAt.Equal(other.CreatedAt) {
+		t.Errorf("acme Get(shared) = %+v, %v; want acme's", got, err)
+	}
+	if got := listValues(t, s, nil); !slices.Equal(got, []string{"root only", "shared"}) {
+		t.Errorf("List = %q, want the default namespace's strings", got)
+	}
+	if got := listValues(t, acme, nil); !slices.Equal(got, []string{"acme only", "shared"}) {
+		t.Errorf("acme List = %q, want acme's strings", got)
+	}
+	if got := listValues(t, beta, nil); len(got) != 0 {
+		t.Errorf("beta List = %q, want none", got)
+	}
+	onlyID := resource("acme only", t0).ID
+	if _, err := s.GetByID(ctx, onlyID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("GetByID(other namespace): expected ErrNotFound, got %v", err)
+	}
+	if ok, err := beta.Exists(ctx, "shared"); err != nil || ok {
+		t.Errorf("beta Exists(shared) = %v, %v; want false", ok, err)
+	}
+	if err := beta.Delete(ctx, "shared"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("beta Delete(shared): expected ErrNotFound, got %v", err)
+	}
+	if err := beta.DeleteByID(ctx, onlyID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("beta DeleteByID: expected ErrNotFound, got %v", err)
+	}
+
+	// acme is full; an existing value is still returned, trash still counts
+	if err := acme.Create(ctx, resource("third", hours(7))); !errors.Is(err, handlers.ErrQuotaExceeded) {
+		t.Errorf("Create beyond quota: expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, created, err := acme.CreateIfAbsent(ctx, resource("shared", hours(7))); err != nil || created {
+		t.Errorf("CreateIfAbsent(existing) at quota = %v, %v; want existing", created, err)
+	}
+	if ts, ok := acme.(handlers.TrashStore); ok {
+		if err := ts.Trash(ctx, "shared", hours(8)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Get(ctx, "shared"); err != nil || got.DeletedAt != nil {
+			t.Errorf("Get(shared) after trashing acme's = %+v, %v; want live", got, err)
+		}
+		if err := acme.Create(ctx, resource("third", hours(7))); !errors.Is(err, handlers.ErrQuotaExceeded) {
+			t.Errorf("Create beyond quota with trash: expected ErrQuotaExceeded, got %v", err)
+		}
+	}
+	got, err := ns.SetNamespaceQuota(ctx, "acme", 4)
+	if err != nil || got.MaxStrings != 4 || got.Count != 2 {
+		t.Errorf("SetNamespaceQuota = %+v, %v; want max 4, count 2", got, err)
+	}
+	create(t, acme, resource("third", hours(7)))
+
+	// Expired strings do not count against the quota
+	if _, ok := s.(handlers.RetentionStore); ok {
+		past := time.Now().Add(-time.Minute)
+		expired := resource("expired", hours(9))
+		expired.ExpiresAt = &past
+		create(t, acme, expired)
+		create(t, acme, resource("fourth", hours(10)))
+	}
+
+	if as, ok := acme.(handlers.AnnotationStore); ok {
+		if _, err := as.Annotate(ctx, "third", replaceAnnotations([]string{"acme-tag"}, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if counts, err := s.(handlers.AnnotationStore).TagCounts(ctx); err != nil || len(counts) != 0 {
+			t.Errorf("TagCounts = %v, %v; want none outside acme", counts, err)
+		}
+		if got := listValues(t, s, map[string]any{"tag": "acme-tag"}); len(got) != 0 {
+			t.Errorf("List(tag) = %q, want none outside acme", got)
+		}
+	}
+	if rs, ok := beta.(handlers.RetentionStore); ok {
+		seed(t, beta, "beta only")
+		if n, err := rs.DeleteOldest(ctx, 0, 10); err != nil || n != 1 {
+			t.Errorf("beta DeleteOldest = %d, %v; want 1", n, err)
+		}
+		if got := listValues(t, s, nil); len(got) != 2 {
+			t.Errorf("List after beta DeleteOldest = %q, want the default namespace untouched", got)
+		}
+	}
+
+	list, err := ns.ListNamespaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, n := range list {
+		names = append(names, n.Name)
+		if n.Name == handlers.DefaultNamespace && n.Count != 2 {
+			t.Errorf("default namespace count = %d, want 2", n.Count)
+		}
+	}
+	if !slices.Equal(names, []string{"acme", "beta", handlers.DefaultNamespace}) {
+		t.Errorf("ListNamespaces = %q, want acme, beta, default", names)
+	}
+	if _, err := ns.GetNamespace(ctx, "missing"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("GetNamespace(missing): expected ErrNotFound, got %v", err)
+	}
+	if _, err := ns.SetNamespaceQuota(ctx, "missing", 1); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("SetNamespaceQuota(missing): expected ErrNotFound, got %v", err)
+	}
+	if err := ns.In("missing").Create(ctx, resource("x", t0)); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Create in a missing namespace: expected ErrNotFound, got %v", err)
+	}
+
+	// Deleting a namespace removes its strings and nothing else
+	if err := ns.DeleteNamespace(ctx, "acme"); err != nil {
+		t.Fatalf("DeleteNamespace: %v", err)
+	}
+	if err := ns.DeleteNamespace(ctx, "acme"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("DeleteNamespace again: expected ErrNotFound, got %v", err)
+	}
+	if err := ns.DeleteNamespace(ctx, handlers.DefaultNamespace); err == nil {
+		t.Error("DeleteNamespace(default) should fail")
+	}
+	if _, err := ns.GetNamespace(ctx, "acme"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("GetNamespace(deleted): expected ErrNotFound, got %v", err)
+	}
+	if _, err := acme.Get(ctx, "third"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get in a deleted namespace: expected ErrNotFound, got %v", err)
+	}
+	if err := ns.In("acme").Create(ctx, resource("x", t0)); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Create in a deleted namespace: expected ErrNotFound, got %v", err)
+	}
+	if got := listValues(t, s, nil); !slices.Equal(got, []string{"root only", "shared"}) {
+		t.Errorf("List after DeleteNamespace = %q, want the default namespace untouched", got)
+	}
+	if err := ns.CreateNamespace(ctx, handlers.Namespace{Name: "acme", CreatedAt: t0}); err != nil {
+		t.Fatal(err)
+	}
+	if got := listValues(t, ns.In("acme"), nil); len(got) != 0 {
+		t.Errorf("List in a recreated namespace = %q, want none", got)
+	}
+}
+
+func testEvents(t *testing.T, s handlers.StringStore) {
+	es, ok := s.(handlers.EventStore)
+	if !ok {
+		t.Skip("store does not implement handlers.EventStore")
+	}
+	bg := context.Background()
+	if _, _, err := es.Events(bg, handlers.EventFilter{}, 1, 0); errors.Is(err, handlers.ErrNotSupported) {
+		t.Skip("store does not keep an audit trail")
+	}
+	ctx := handlers.WithActor(bg, "alice")
+
+	// Each change to racecar is recorded; a delete and re-create included
+	racecar := resource("racecar", t0)
+	racecar.AnalyzerVersion = 0
+	if err := s.Create(ctx, racecar); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{handlers.EventCreate}
+	if rs, ok := s.(handlers.ReanalysisStore); ok {
+		updated := *racecar
+		updated.AnalyzerVersion = handlers.AnalyzerVersion
+		if err := rs.UpdateProperties(ctx, &updated); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, handlers.EventUpdate)
+	}
+	if as, ok := s.(handlers.AnnotationStore); ok {
+		if _, err := as.Annotate(ctx, "racecar", replaceAnnotations([]string{"sample"}, nil)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, handlers.EventUpdate)
+	}
+	if ts, ok := s.(handlers.TrashStore); ok {
+		if err := ts.Trash(ctx, "racecar", hours(1)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.Restore(ctx, "racecar"); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, handlers.EventDelete, handlers.EventRestore)
+	}
+	if err := s.Delete(ctx, "racecar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CreateIfAbsent(ctx, resource("racecar", hours(2))); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, handlers.EventDelete, handlers.EventCreate)
+	create(t, s, resource("level", hours(3)))
+
+	history, total, err := es.Events(bg, handlers.EventFilter{Value: "racecar"}, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for i, e := range history {
+		types = append(types, e.Type)
+		if e.Value != "racecar" || e.StringID != racecar.ID || e.Actor != "alice" {
+			t.Errorf("event %d = %s/%q by %q, want racecar by alice", i, e.StringID, e.Value, e.Actor)
+		}
+		if i > 0 && e.ID <= history[i-1].ID {
+			t.Errorf("event IDs out of order: %d after %d", e.ID, history[i-1].ID)
+		}
+	}
+	if !slices.Equal(types, want) || total != len(want) {
+		t.Fatalf("history = %q (total %d), want %q", types, total, want)
+	}
+	first, last := history[0], history[len(history)-1]
+	if first.Before != nil || first.After == nil || first.After.AnalyzerVersion != 0 {
+		t.Errorf("create event before/after = %+v/%+v, want nil and the new resource", first.Before, first.After)
+	}
+	if removed := history[len(history)-2]; removed.Before == nil || removed.After != nil {
+		t.Errorf("delete event before/after = %+v/%+v, want the old resource and nil", removed.Before, removed.After)
+	}
+	if !last.After.CreatedAt.Equal(hours(2)) {
+		t.Errorf("re-create event after.created_at = %v, want %v", last.After.CreatedAt, hours(2))
+	}
+	if len(want) > 4 {
+		if update := history[1]; update.Before.AnalyzerVersion != 0 || update.After.AnalyzerVersion != handlers.AnalyzerVersion {
+			t.Errorf("update event versions = %d -> %d, want 0 -> %d", update.Before.AnalyzerVersion, update.After.AnalyzerVersion, handlers.AnalyzerVersion)
+		}
+		if trash := history[3]; trash.After == nil || trash.After.DeletedAt == nil || !trash.After.DeletedAt.Equal(hours(1)) {
+			t.Errorf("trash event after = %+v, want deleted_at %v", trash.After, hours(1))
+		}
+	}
+
+	// Filters and paging
+	all, total, err := es.Events(bg, handlers.EventFilter{}, 100, 0)
+	if err != nil || total != len(want)+1 || all[len(all)-1].Value != "level" {
+		t.Fatalf("Events() = %d of %d, %v; want %d ending with level", len(all), total, err, len(want)+1)
+	}
+	for _, tc := range []struct {
+		filter handlers.EventFilter
+		want   int
+	}{
+		{handlers.EventFilter{Type: handlers.EventCreate}, 3},
+		{handlers.EventFilter{Actor: "alice"}, len(want)},
+		{handlers.EventFilter{Actor: "bob"}, 0},
+		{handlers.EventFilter{AfterID: all[len(all)-3].ID}, 2},
+		{handlers.EventFilter{Since: time.Now().Add(-time.Hour)}, len(all)},
+		{handlers.EventFilter{Until: time.Now().Add(-time.Hour)}, 0},
+		{handlers.EventFilter{Value: "missing"}, 0},
+	} {
+		if _, n, err := es.Events(bg, tc.filter, 100, 0); err != nil || n != tc.want {
+			t.Errorf("Events(%+v) total = %d, %v; want %d", tc.filter, n, err, tc.want)
+		}
+	}
+	page, total, err := es.Events(bg, handlers.EventFilter{}, 2, 1)
+	if err != nil || total != len(all) || len(page) != 2 || page[0].ID != all[1].ID {
+		t.Errorf("Events page 2 = %d of %d, %v; want 2 starting at event %d", len(page), total, err, all[1].ID)
+	}
+
+	// Removals by background jobs are recorded as purges
+	if rs, ok := s.(handlers.RetentionStore); ok {
+		if n, err := rs.DeleteOldest(handlers.WithActor(bg, handlers.ActorReaper), 0, 10); err != nil || n != 2 {
+			t.Fatalf("DeleteOldest = %d, %v; want 2", n, err)
+		}
+		purged, _, err := es.Events(bg, handlers.EventFilter{Type: handlers.EventPurge}, 100, 0)
+		if err != nil || len(purged) != 2 || purged[0].Actor != handlers.ActorReaper || purged[0].After != nil {
+			t.Errorf("purge events = %+v, %v; want 2 by %s", purged, err, handlers.ActorReaper)
+		}
+	}
+
+	if ns, ok := s.(handlers.NamespaceStore); ok {
+		if _, err := ns.ListNamespaces(bg); !errors.Is(err, handlers.ErrNotSupported) {
+			if err := ns.CreateNamespace(bg, handlers.Namespace{Name: "acme", CreatedAt: t0}); err != nil {
+				t.Fatal(err)
+			}
+			acme := ns.In("acme")
+			create(t, acme, resource("racecar", t0))
+			if _, n, err := acme.(handlers.EventStore).Events(bg, handlers.EventFilter{}, 100, 0); err != nil || n != 1 {
+				t.Errorf("acme events = %d, %v; want only its own create", n, err)
+			}
+			if err := ns.DeleteNamespace(handlers.WithActor(bg, "admin"), "acme"); err != nil {
+				t.Fatal(err)
+			}
+			if _, n, _ := es.Events(bg, handlers.EventFilter{}, 100, 0); n == 0 {
+				t.Error("Deleting a namespace removed the default namespace's events")
+			}
+			// The trail is append-only, so the namespace's events outlive it
+			events, n, err := acme.(handlers.EventStore).Events(bg, handlers.EventFilter{}, 100, 0)
+			if err != nil || n != 2 || events[1].Type != handlers.EventDelete || events[1].Actor != "admin" {
+				t.Errorf("acme events after DeleteNamespace = %+v, %v; want its create and a delete by admin", events, err)
+			}
+		}
+	}
+}
@@ -1,263 +1,232 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json" // <-- 1. FIXED: Added missing import
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog" // <-- 2. CLEANUP: Using structured logging
 	"net/http"
 	"os" // <-- 3. CLEANUP: Added for slog and PORT
-	"strings"
-	"sync"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/kodevoid/string_analyzer/internals/filestore"
 	"github.com/kodevoid/string_analyzer/internals/handlers"
-	_ "modernc.org/sqlite" // SQLite driver in pure Go
+	"github.com/kodevoid/string_analyzer/internals/kv"
+	"github.com/kodevoid/string_analyzer/internals/kvstore"
+	"github.com/kodevoid/string_analyzer/internals/memstore"
+	"github.com/kodevoid/string_analyzer/internals/nlquery"
+	"github.com/kodevoid/string_analyzer/internals/storecache"
 )
 
-// SQLiteStore implements the handlers.StringStore interface with a SQLite backend
-type SQLiteStore struct {
-	db *sql.DB
-	mu sync.Mutex // for simple serialization of writes
-}
-
-// NewSQLiteStore opens/creates the DB file and prepares the table
-func NewSQLiteStore(path string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite", path)
-	if err != nil {
-		return nil, err
+// extractorFromEnv builds the natural language intent extractor. Without
+// NL_MODEL_URL only the rule parser is used; with it, the rule parser and the
+// model server run side by side and their filters are merged.
+func extractorFromEnv() nlquery.Extractor {
+	endpoint := os.Getenv("NL_MODEL_URL")
+	if endpoint == "" {
+		return nlquery.RuleExtractor{}
 	}
 
-	store := &SQLiteStore{db: db}
-
-	// Create table if not exists
-	createTable := `
-	CREATE TABLE IF NOT EXISTS strings (
-		id TEXT PRIMARY KEY,
-		value TEXT UNIQUE,
-		length INTEGER,
-		is_palindrome INTEGER,
-		unique_characters INTEGER,
-		word_count INTEGER,
-		sha256_hash TEXT,
-		char_freq_map TEXT,
-		created_at TEXT
-	);
-	`
-	_, err = db.Exec(createTable)
-	if err != nil {
-		return nil, err
+	timeout := durationEnv("NL_MODEL_TIMEOUT", nlquery.DefaultHTTPTimeout)
+	cacheTTL := durationEnv("NL_MODEL_CACHE_TTL", 5*time.Minute)
+	prefer := os.Getenv("NL_MODEL_PREFER") // "rules" (default) or "model"
+
+	slog.Info("natural language model extractor enabled",
+		"endpoint", endpoint, "timeout", timeout, "cache_ttl", cacheTTL, "prefer", prefer)
+
+	return &nlquery.Combined{
+		Rules: nlquery.RuleExtractor{},
+		Model: &nlquery.Cache{
+			Next:       &nlquery.HTTPExtractor{Endpoint: endpoint, Timeout: timeout},
+			TTL:        cacheTTL,
+			MaxEntries: 1000,
+		},
+		Prefer: prefer,
 	}
-
-	return store, nil
 }
 
-// Create inserts a new string resource
-func (s *SQLiteStore) Create(sr *handlers.StringResource) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Serialize CharacterFrequencyMap as JSON
-	charMapJSON, err := json.Marshal(sr.Properties.CharacterFrequencyMap)
-	if err != nil {
-		return err
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
 	}
-
-	_, err = s.db.Exec(`
-	INSERT INTO strings (id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		sr.ID, sr.Value, sr.Properties.Length,
-		boolToInt(sr.Properties.IsPalindrome),
-		sr.Properties.UniqueCharacters,
-		sr.Properties.WordCount,
-		sr.Properties.SHA256Hash,
-		string(charMapJSON),
-		sr.CreatedAt.Format(time.RFC3339),
-	)
-	return err
-}
-
-// Get retrieves a string resource by value
-func (s *SQLiteStore) Get(value string) (*handlers.StringResource, error) {
-	row := s.db.QueryRow(`SELECT id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at
-		FROM strings WHERE value = ?`, value)
-
-	var sr handlers.StringResource
-	var charMapStr string
-	var isPalInt int
-	var createdAtStr string
-
-	err := row.Scan(&sr.ID, &sr.Value, &sr.Properties.Length, &isPalInt,
-		&sr.Properties.UniqueCharacters, &sr.Properties.WordCount,
-		&sr.Properties.SHA256Hash, &charMapStr, &createdAtStr)
+	d, err := time.ParseDuration(val)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("string not found")
-		}
-		return nil, err
+		slog.Warn("invalid duration, using default", "key", key, "value", val, "default", fallback)
+		return fallback
 	}
+	return d
+}
 
-	// Decode JSON map
-	if err := json.Unmarshal([]byte(charMapStr), &sr.Properties.CharacterFrequencyMap); err != nil {
-		return nil, err
+// intEnv reads an integer from the environment, falling back on missing or
+// invalid values.
+func intEnv(key string, fallback int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
 	}
-
-	sr.Properties.IsPalindrome = intToBool(isPalInt)
-
-	// Parse time
-	sr.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	n, err := strconv.Atoi(val)
 	if err != nil {
-		return nil, err
+		slog.Warn("invalid integer, using default", "key", key, "value", val, "default", fallback)
+		return fallback
 	}
-
-	return &sr, nil
+	return n
 }
 
-// Delete removes a string resource
-func (s *SQLiteStore) Delete(value string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// --- Main Application ---
 
-	res, err := s.db.Exec(`DELETE FROM strings WHERE value = ?`, value)
-	if err != nil {
-		return err
-	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("string not found")
-	}
-	return nil
+// defaultDBPath is the SQLite database used by the server and subcommands.
+const defaultDBPath = "strings.db"
+
+// serverStore is what the server needs from a storage backend.
+type serverStore interface {
+	handlers.StringStore
+	handlers.ReanalysisStore
+	handlers.TrashStore
+	handlers.RetentionStore
+	handlers.AnnotationStore
+	Close() error
 }
 
-// Exists checks if a string exists
-func (s *SQLiteStore) Exists(value string) bool {
-	row := s.db.QueryRow(`SELECT 1 FROM strings WHERE value = ?`, value)
-	var dummy int
-	err := row.Scan(&dummy)
-	return err == nil
+// storeFlags are the command-line settings of the storage backends.
+type storeFlags struct {
+	kind     string
+	memDir   string
+	filePath string
+	kvPath   string
 }
 
-// List retrieves filtered, paginated resources
-func (s *SQLiteStore) List(filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
-	// --- 4. FIXED: Logic for List function ---
-	baseQuery := `SELECT id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at FROM strings`
-	countBaseQuery := `SELECT COUNT(*) FROM strings`
-
-	whereClauses := []string{}
-	args := []any{}
-
-	if v, ok := filters["is_palindrome"]; ok {
-		whereClauses = append(whereClauses, "is_palindrome = ?")
-		args = append(args, boolToInt(v.(bool)))
-	}
-	if v, ok := filters["min_length"]; ok {
-		whereClauses = append(whereClauses, "length >= ?")
-		args = append(args, v.(int))
-	}
-	if v, ok := filters["max_length"]; ok {
-		whereClauses = append(whereClauses, "length <= ?")
-		args = append(args, v.(int))
-	}
-	if v, ok := filters["word_count"]; ok {
-		whereClauses = append(whereClauses, "word_count = ?")
-		args = append(args, v.(int))
-	}
-	if v, ok := filters["contains_character"]; ok {
-		// Use json_extract to check if the key (character) exists in the JSON map.
-		whereClauses = append(whereClauses, "json_extract(char_freq_map, '$.' || ?) IS NOT NULL")
-		args = append(args, v.(string))
-	}
-
-	// Build the final queries
-	query := baseQuery
-	countQuery := countBaseQuery
-
-	if len(whereClauses) > 0 {
-		whereStr := " WHERE " + strings.Join(whereClauses, " AND ")
-		query += whereStr
-		countQuery += whereStr
-	}
-
-	// Add pagination to the main query *after* filters
-	query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
-
-	// Run the main query
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
-
-	var results []handlers.StringResource
-	for rows.Next() {
-		var sr handlers.StringResource
-		var charMapStr string
-		var isPalInt int
-		var createdAtStr string
-
-		if err := rows.Scan(&sr.ID, &sr.Value, &sr.Properties.Length, &isPalInt,
-			&sr.Properties.UniqueCharacters, &sr.Properties.WordCount,
-			&sr.Properties.SHA256Hash, &charMapStr, &createdAtStr); err != nil {
-			return nil, 0, err
-		}
-
-		if err := json.Unmarshal([]byte(charMapStr), &sr.Properties.CharacterFrequencyMap); err != nil {
-			return nil, 0, err
+// openStore opens the backend named by f.kind: "sqlite" (default), "memory",
+// "file" or "kv". The memory store persists to f.memDir unless it is empty.
+func openStore(f storeFlags) (serverStore, error) {
+	switch f.kind {
+	case "sqlite":
+		return OpenSQLiteStore(SQLiteConfig{
+			Path:        defaultDBPath,
+			JournalMode: os.Getenv("SQLITE_JOURNAL_MODE"),
+			Synchronous: os.Getenv("SQLITE_SYNCHRONOUS"),
+			BusyTimeout: durationEnv("SQLITE_BUSY_TIMEOUT", 0),
+			MaxReaders:  intEnv("SQLITE_MAX_READERS", 0),
+		})
+	case "memory":
+		if f.memDir == "" {
+			return memstore.New(), nil
 		}
-
-		sr.Properties.IsPalindrome = intToBool(isPalInt)
-		sr.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
-		if err != nil {
-			return nil, 0, err
-		}
-
-		results = append(results, sr)
-	}
-
-	// Run the count query
-	var total int
-	row := s.db.QueryRow(countQuery, args...)
-	if err := row.Scan(&total); err != nil {
-		return nil, 0, err
+		return memstore.Open(memstore.Options{
+			Dir:              f.memDir,
+			SnapshotInterval: durationEnv("MEMSTORE_SNAPSHOT_INTERVAL", 0),
+			SyncWrites:       os.Getenv("MEMSTORE_SYNC_WRITES") == "true",
+		})
+	case "file":
+		return filestore.Open(filestore.Options{
+			Path:            f.filePath,
+			Sync:            filestore.SyncPolicy(os.Getenv("FILESTORE_SYNC")),
+			SyncInterval:    durationEnv("FILESTORE_SYNC_INTERVAL", 0),
+			CompactInterval: durationEnv("FILESTORE_COMPACT_INTERVAL", 0),
+		})
+	case "kv":
+		return kvstore.Open(f.kvPath, kv.Options{NoSync: os.Getenv("KV_NO_SYNC") == "true"})
+	default:
+		return nil, fmt.Errorf("unknown store %q (want sqlite, memory, file or kv)", f.kind)
 	}
-
-	return results, total, nil
 }
 
-// --- Helper Functions ---
-
-func boolToInt(b bool) int {
-	if b {
-		return 1
+func main() {
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:], os.Stdout, os.Stderr))
+		case "backup":
+			os.Exit(runBackup(os.Args[2:], os.Stdout, os.Stderr))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:], os.Stdout, os.Stderr))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:], os.Stdout, os.Stderr))
+		}
 	}
-	return 0
-}
-
-func intToBool(i int) bool {
-	return i != 0
+	os.Exit(run())
 }
 
-// --- Main Application ---
-
-func main() {
+// run starts the server and returns the exit code once it has stopped. It
+// returns instead of calling os.Exit so the deferred cleanup always runs.
+func run() int {
 	// --- 5. CLEANUP: Setup structured JSON logging ---
 	// This single line configures the global logger used in handlers.go
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	})))
 
-	// 1. Create SQLite-backed store
-	store, err := NewSQLiteStore("strings.db")
+	var sf storeFlags
+	flag.StringVar(&sf.kind, "store", "sqlite", "storage backend: sqlite, memory, file or kv")
+	flag.StringVar(&sf.memDir, "memory-dir", "", "snapshot and WAL directory for -store=memory; empty keeps data in memory only")
+	flag.StringVar(&sf.filePath, "file-path", "strings.jsonl", "JSON-lines log for -store=file")
+	flag.StringVar(&sf.kvPath, "kv-path", "strings.kv", "database file for -store=kv")
+	flag.Parse()
+
+	// 1. Open the storage backend
+	store, err := openStore(sf)
 	if err != nil {
-		slog.Error("Failed to open SQLite store", "error", err)
-		os.Exit(1)
+		slog.Error("Failed to open store", "store", sf.kind, "error", err)
+		return 1
+	}
+	defer store.Close() // Flush and close the store when program exits
+	slog.Info("store opened", "store", sf.kind)
+
+	// Cache reads in front of the store when CACHE_MAX_ENTRIES is set
+	if maxEntries := intEnv("CACHE_MAX_ENTRIES", 0); maxEntries > 0 {
+		opts := storecache.Options{
+			MaxEntries: maxEntries,
+			MaxBytes:   int64(intEnv("CACHE_MAX_BYTES", 0)),
+			TTL:        durationEnv("CACHE_TTL", 0),
+		}
+		store = storecache.New(store, opts)
+		slog.Info("store cache enabled", "max_entries", opts.MaxEntries, "max_bytes", opts.MaxBytes, "ttl", opts.TTL)
+	}
+
+	// Re-analyze rows written by an older ComputeProperties in the background
+	reanalysis := handlers.NewReanalysis(store,
+		intEnv("REANALYSIS_BATCH_SIZE", handlers.DefaultReanalysisBatchSize),
+		durationEnv("REANALYSIS_PAUSE", handlers.DefaultReanalysisPause),
+	)
+	if err := reanalysis.Start(nil); err != nil {
+		slog.Error("Failed to start re-analysis", "error", err)
+	}
+	defer reanalysis.Stop()
+
+	// Permanently delete strings that have been in the trash for
+	// TRASH_RETENTION_DAYS; 0 keeps them until restored
+	if days := intEnv("TRASH_RETENTION_DAYS", 30); days > 0 {
+		purger := handlers.NewPurger(store, time.Duration(days)*24*time.Hour,
+			durationEnv("TRASH_PURGE_INTERVAL", handlers.DefaultPurgeInterval))
+		purger.Start()
+		defer purger.Stop()
 	}
-	defer store.db.Close() // Close DB when program exits
-	slog.Info("database connection established", "path", "strings.db")
+
+	// Delete expired strings, plus any older than RETENTION_MAX_AGE_DAYS or
+	// beyond the newest RETENTION_MAX_ROWS; 0 disables either limit
+	policy := handlers.RetentionPolicy{
+		MaxAge:  time.Duration(intEnv("RETENTION_MAX_AGE_DAYS", 0)) * 24 * time.Hour,
+		MaxRows: intEnv("RETENTION_MAX_ROWS", 0),
+	}
+	reaper := handlers.NewReaper(store, policy,
+		durationEnv("REAPER_INTERVAL", handlers.DefaultReapInterval),
+		intEnv("REAPER_BATCH_SIZE", handlers.DefaultReapBatchSize))
+	reaper.Start()
+	defer reaper.Stop()
+	slog.Info("retention reaper started", "max_age", policy.MaxAge, "max_rows", policy.MaxRows)
 
 	// 2. Setup HTTP routes
 	// This uses the SetupRoutes from your handlers package
-	router := handlers.SetupRoutes(store)
+	router := handlers.SetupRoutes(store,
+		handlers.WithExtractor(extractorFromEnv()),
+		handlers.WithStoreTimeout(durationEnv("STORE_TIMEOUT", handlers.DefaultStoreTimeout)),
+		handlers.WithReanalysis(reanalysis),
+	)
 
 	// --- 6. CLEANUP: Use PORT from environment for deployment ---
 	port := os.Getenv("PORT")
@@ -265,10 +234,30 @@ func main() {
 		port = "8000" // Default to 8080
 	}
 
-	// 3. Start HTTP server
+	// 3. Start HTTP server. On SIGINT or SIGTERM it stops accepting
+	// connections and drains in-flight requests for up to SHUTDOWN_TIMEOUT,
+	// then the deferred calls above stop the background jobs and close the
+	// store.
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		slog.Info("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), durationEnv("SHUTDOWN_TIMEOUT", 10*time.Second))
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Server shutdown incomplete", "error", err)
+		}
+	}()
+
 	slog.Info("Starting String Analyzer server", "port", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Server failed to start", "error", err)
-		os.Exit(1)
+		return 1
 	}
+	<-drained
+	return 0
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func newResource(value string) *handlers.StringResource {
+	props := handlers.ComputeProperties(value)
+	return &handlers.StringResource{ID: props.SHA256Hash, Value: value, Properties: props, CreatedAt: time.Now().UTC()}
+}
+
+func TestSQLiteStoreErrors(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.Create(ctx, newResource("racecar")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.Create(ctx, newResource("racecar")); !errors.Is(err, handlers.ErrConflict) {
+		t.Errorf("Expected ErrConflict for duplicate Create, got %v", err)
+	}
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Get, got %v", err)
+	}
+	if err := store.Delete(ctx, "missing"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Delete, got %v", err)
+	}
+
+	store.Close()
+	if _, err := store.Get(ctx, "racecar"); !errors.Is(err, handlers.ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable from a closed database, got %v", err)
+	}
+}
+
+// TestConcurrentCreate races duplicate POSTs through the real SQLite store:
+// exactly one must win and the rest must get 409, never 500.
+func TestConcurrentCreate(t *testing.T) {
+	server := httptest.NewServer(handlers.SetupRoutes(newTestStore(t)))
+	defer server.Close()
+
+	const n = 20
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := server.Client().Post(server.URL+"/strings", "application/json", bytes.NewBufferString(`{"value": "level"}`))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("Expected only 201 or 409, got %d", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly one 201, got %d", created)
+	}
+}
+
+func TestSQLiteCreateIfAbsent(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	first := newResource("racecar")
+	stored, created, err := store.CreateIfAbsent(ctx, first)
+	if err != nil || !created || stored != first {
+		t.Fatalf("Expected first call to create, got created=%v err=%v", created, err)
+	}
+
+	second := newResource("racecar")
+	second.CreatedAt = first.CreatedAt.Add(time.Hour)
+	stored, created, err = store.CreateIfAbsent(ctx, second)
+	if err != nil || created {
+		t.Fatalf("Expected second call to find the existing row, got created=%v err=%v", created, err)
+	}
+	if stored.ID != first.ID || !stored.CreatedAt.Equal(first.CreatedAt.Truncate(time.Second)) {
+		t.Errorf("Expected the original resource back, got %+v", stored)
+	}
+}
+
+func TestSQLiteGetByID(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	for _, id := range []string{"abcd01", "abcd02", "abce00"} {
+		sr := newResource("value-" + id)
+		sr.ID = id
+		if err := store.Create(ctx, sr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if sr, err := store.GetByID(ctx, "abce"); err != nil || sr.Value != "value-abce00" {
+		t.Errorf("Expected unique prefix to resolve, got %v, %v", sr, err)
+	}
+	if sr, err := store.GetByID(ctx, "abcd02"); err != nil || sr.Value != "value-abcd02" {
+		t.Errorf("Expected full ID to resolve, got %v, %v", sr, err)
+	}
+	if _, err := store.GetByID(ctx, "abcd"); !errors.Is(err, handlers.ErrAmbiguous) {
+		t.Errorf("Expected ErrAmbiguous, got %v", err)
+	}
+	if _, err := store.GetByID(ctx, "abcf"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := store.DeleteByID(ctx, "abcd"); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Expected DeleteByID to require a full ID, got %v", err)
+	}
+	if err := store.DeleteByID(ctx, "abcd01"); err != nil {
+		t.Errorf("DeleteByID: %v", err)
+	}
+}
+
+func TestSQLiteReanalysis(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	values := []string{"racecar", "level", "hello world", "noon", "abc"}
+	for _, v := range values {
+		sr := newResource(v)
+		sr.Properties.WordCount = 99 // as computed by a buggy older analyzer
+		if err := store.Create(ctx, sr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fresh := newResource("fresh")
+	fresh.AnalyzerVersion = handlers.AnalyzerVersion
+	if err := store.Create(ctx, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	job := handlers.NewReanalysis(store, 2, 0)
+	if err := job.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	job.Wait()
+
+	status := job.Status()
+	if status.State != handlers.ReanalysisCompleted || status.Total != len(values) || status.Processed != len(values) {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+	for _, v := range values {
+		sr, err := store.Get(ctx, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sr.Properties.WordCount != handlers.ComputeProperties(v).WordCount || sr.AnalyzerVersion != handlers.AnalyzerVersion {
+			t.Errorf("Expected %q to be re-analyzed, got %+v", v, sr)
+		}
+	}
+	if stale, total, _ := store.ListStale(ctx, nil, handlers.AnalyzerVersion, "", 10); len(stale) != 0 || total != 0 {
+		t.Errorf("Expected no stale rows left, got %d", total)
+	}
+}
+
+// TestAuditTrail follows a string through the API and reads its history
+// back from GET /strings/{value}/history and GET /events.
+func TestAuditTrail(t *testing.T) {
+	server := httptest.NewServer(handlers.SetupRoutes(newTestStore(t)))
+	defer server.Close()
+	send := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set(handlers.ActorHeader, "alice")
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var decoded map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&decoded)
+		return resp.StatusCode, decoded
+	}
+
+	for _, step := range []struct{ method, path, body string }{
+		{http.MethodPost, "/strings", `{"value":"racecar"}`},
+		{http.MethodPatch, "/strings/racecar", `{"tags":["sample"]}`},
+		{http.MethodDelete, "/strings/racecar", ""},
+		{http.MethodPost, "/strings/racecar/restore", ""},
+		{http.MethodPost, "/strings", `{"value":"level"}`},
+	} {
+		if code, body := send(step.method, step.path, step.body); code >= 300 {
+			t.Fatalf("%s %s: %d %v", step.method, step.path, code, body)
+		}
+	}
+
+	code, body := send(http.MethodGet, "/strings/racecar/history", "")
+	if code != http.StatusOK || body["count"] != float64(4) {
+		t.Fatalf("GET history: %d %v", code, body)
+	}
+	var types []string
+	for _, e := range body["data"].([]any) {
+		event := e.(map[string]any)
+		types = append(types, event["type"].(string))
+		if event["actor"] != "alice" {
+			t.Errorf("event actor = %v, want alice", event["actor"])
+		}
+	}
+	if got := strings.Join(types, ","); got != "create,update,delete,restore" {
+		t.Errorf("history = %s, want create,update,delete,restore", got)
+	}
+	update := body["data"].([]any)[1].(map[string]any)
+	if before, after := update["before"].(map[string]any), update["after"].(map[string]any); before["tags"] != nil || after["tags"] == nil {
+		t.Errorf("update event before/after tags = %v/%v, want none then [sample]", before["tags"], after["tags"])
+	}
+
+	for _, tc := range []struct {
+		path string
+		code int
+		want float64
+	}{
+		{"/events", http.StatusOK, 5},
+		{"/events?type=create", http.StatusOK, 2},
+		{"/events?value=level&actor=alice", http.StatusOK, 1},
+		{"/events?after_id=4", http.StatusOK, 1},
+		{"/events?since=2000-01-01T00:00:00Z&limit=2", http.StatusOK, 5},
+		{"/ns/default/events?actor=bob", http.StatusOK, 0},
+		{"/events?type=rename", http.StatusBadRequest, 0},
+		{"/events?since=yesterday", http.StatusBadRequest, 0},
+		{"/events?after_id=-1", http.StatusBadRequest, 0},
+		{"/strings/missing/history", http.StatusNotFound, 0},
+	} {
+		code, body := send(http.MethodGet, tc.path, "")
+		if code != tc.code || (code == http.StatusOK && body["count"] != tc.want) {
+			t.Errorf("GET %s: %d %v, want %d with count %v", tc.path, code, body, tc.code, tc.want)
+		}
+	}
+
+	// Clients cannot claim to be a background job
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/strings", strings.NewReader(`{"value":"noon"}`))
+	req.Header.Set(handlers.ActorHeader, handlers.ActorReaper)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, body := send(http.MethodGet, "/strings/noon/history", ""); body["count"] != float64(1) ||
+		body["data"].([]any)[0].(map[string]any)["actor"] != handlers.DefaultActor {
+		t.Errorf("history of a create claiming %s = %v, want actor %s", handlers.ActorReaper, body, handlers.DefaultActor)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `usage: string_analyzer migrate [-db path] [-dry-run] <command>
+
+commands:
+  up [version]   apply pending migrations, up to version (default: latest)
+  down [steps]   revert the latest applied migrations (default: 1)
+  status         list migrations and whether they are applied
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+func runMigrate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, migrateUsage) }
+	dbPath := fs.String("db", defaultDBPath, "SQLite database file")
+	dryRun := fs.Bool("dry-run", false, "print what would change without touching the database")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	command := fs.Arg(0)
+	n := 0
+	if fs.NArg() == 2 {
+		var err error
+		if n, err = strconv.Atoi(fs.Arg(1)); err != nil || n < 0 {
+			fmt.Fprintf(stderr, "migrate %s: %q is not a non-negative number\n", command, fs.Arg(1))
+			return 2
+		}
+	}
+
+	// Dry runs and status only read: the database is opened read-only, and
+	// a missing file reads as an empty database instead of being created
+	var db *sql.DB
+	var err error
+	readOnly := *dryRun || command == "status"
+	if _, statErr := os.Stat(*dbPath); readOnly && errors.Is(statErr, os.ErrNotExist) {
+		db, err = sql.Open("sqlite", ":memory:")
+	} else if readOnly {
+		db, err = openExisting(*dbPath, true)
+	} else {
+		db, err = sql.Open("sqlite", *dbPath)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	prefix := ""
+	if *dryRun {
+		prefix = "(dry run) would "
+	}
+
+	switch command {
+	case "up":
+		target := latestVersion()
+		if fs.NArg() == 2 {
+			target = n
+		}
+		applied, err := migrateUp(ctx, db, target, *dryRun)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, m := range applied {
+			fmt.Fprintf(stdout, "%sapply %d %s\n", prefix, m.Version, m.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if fs.NArg() == 2 {
+			steps = n
+		}
+		reverted, err := migrateDown(ctx, db, steps, *dryRun)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, m := range reverted {
+			fmt.Fprintf(stdout, "%srevert %d %s\n", prefix, m.Version, m.Name)
+		}
+		if len(reverted) == 0 {
+			fmt.Fprintln(stdout, "no applied migrations")
+		}
+	case "status":
+		states, err := migrationStatus(ctx, db)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != "" {
+				applied = "applied " + st.AppliedAt
+			}
+			fmt.Fprintf(stdout, "%4d  %-30s %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		fmt.Fprintf(stderr, "migrate: unknown command %q\n", command)
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
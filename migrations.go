@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// migration is one versioned schema change. Up and Down hold one or more SQL
+// statements and each direction runs in its own transaction, together with
+// the schema_migrations bookkeeping row.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrations lists every schema change in order. Append new entries with the
+// next version number; never edit or renumber one that has been released.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create_strings",
+		// IF NOT EXISTS adopts databases created before migrations existed
+		Up: `
+		CREATE TABLE IF NOT EXISTS strings (
+			id TEXT PRIMARY KEY,
+			value TEXT UNIQUE,
+			length INTEGER,
+			is_palindrome INTEGER,
+			unique_characters INTEGER,
+			word_count INTEGER,
+			sha256_hash TEXT,
+			char_freq_map TEXT,
+			created_at TEXT
+		);`,
+		Down: `DROP TABLE strings;`,
+	},
+	{
+		Version: 2,
+		Name:    "add_analyzer_version",
+		// Existing rows get 0, so the first re-analysis run refreshes them all
+		Up: `
+		ALTER TABLE strings ADD COLUMN analyzer_version INTEGER NOT NULL DEFAULT 0;
+		CREATE INDEX idx_strings_analyzer_version ON strings (analyzer_version, id);`,
+		Down: `
+		DROP INDEX idx_strings_analyzer_version;
+		ALTER TABLE strings DROP COLUMN analyzer_version;`,
+	},
+	{
+		Version: 3,
+		Name:    "add_filter_indexes",
+		// One index per range/equality filter. contains_character cannot use
+		// an index on char_freq_map (the key is a bound parameter, and a
+		// generated column holds only one value per row), so each string's
+		// distinct characters go to a side table kept in sync by triggers.
+		Up: `
+		CREATE INDEX idx_strings_length ON strings (length);
+		CREATE INDEX idx_strings_word_count ON strings (word_count);
+		CREATE INDEX idx_strings_is_palindrome ON strings (is_palindrome);
+		CREATE INDEX idx_strings_created_at ON strings (created_at);
+
+		CREATE TABLE string_characters (
+			character TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			PRIMARY KEY (character, string_id)
+		) WITHOUT ROWID;
+		CREATE INDEX idx_string_characters_string_id ON string_characters (string_id);
+		INSERT INTO string_characters (character, string_id)
+			SELECT j.key, s.id FROM strings s, json_each(s.char_freq_map) j;
+
+		CREATE TRIGGER strings_characters_insert AFTER INSERT ON strings BEGIN
+			INSERT INTO string_characters (character, string_id)
+				SELECT key, NEW.id FROM json_each(NEW.char_freq_map);
+		END;
+		CREATE TRIGGER strings_characters_update AFTER UPDATE OF char_freq_map ON strings BEGIN
+			DELETE FROM string_characters WHERE string_id = OLD.id;
+			INSERT INTO string_characters (character, string_id)
+				SELECT key, NEW.id FROM json_each(NEW.char_freq_map);
+		END;
+		CREATE TRIGGER strings_characters_delete AFTER DELETE ON strings BEGIN
+			DELETE FROM string_characters WHERE string_id = OLD.id;
+		END;`,
+		Down: `
+		DROP TRIGGER strings_characters_delete;
+		DROP TRIGGER strings_characters_update;
+		DROP TRIGGER strings_characters_insert;
+		DROP TABLE string_characters;
+		DROP INDEX idx_strings_created_at;
+		DROP INDEX idx_strings_is_palindrome;
+		DROP INDEX idx_strings_word_count;
+		DROP INDEX idx_strings_length;`,
+	},
+	{
+		Version: 4,
+		Name:    "add_deleted_at",
+		// Almost every row is live, so the index only covers the trash; live
+		// queries keep using the filter indexes above.
+		Up: `
+		ALTER TABLE strings ADD COLUMN deleted_at TEXT;
+		CREATE INDEX idx_strings_deleted_at ON strings (deleted_at) WHERE deleted_at IS NOT NULL;`,
+		Down: `
+		DROP INDEX idx_strings_deleted_at;
+		ALTER TABLE strings DROP COLUMN deleted_at;`,
+	},
+	{
+		Version: 5,
+		Name:    "add_expires_at",
+		// Like the trash index, this only covers rows with a TTL; the
+		// reaper reads its expired prefix.
+		Up: `
+		ALTER TABLE strings ADD COLUMN expires_at TEXT;
+		CREATE INDEX idx_strings_expires_at ON strings (expires_at) WHERE expires_at IS NOT NULL;`,
+		Down: `
+		DROP INDEX idx_strings_expires_at;
+		ALTER TABLE strings DROP COLUMN expires_at;`,
+	},
+	{
+		Version: 6,
+		Name:    "add_annotations",
+		// User tags and metadata live in side tables like string_characters.
+		// string_metadata.text is handlers.MetaText(value), the form that
+		// meta.<key> filters compare against.
+		Up: `
+		CREATE TABLE string_tags (
+			tag TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			PRIMARY KEY (tag, string_id)
+		) WITHOUT ROWID;
+		CREATE INDEX idx_string_tags_string_id ON string_tags (string_id);
+
+		CREATE TABLE string_metadata (
+			string_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			text TEXT NOT NULL,
+			PRIMARY KEY (string_id, key)
+		) WITHOUT ROWID;
+		CREATE INDEX idx_string_metadata_key_text ON string_metadata (key, text);
+
+		CREATE TRIGGER strings_annotations_delete AFTER DELETE ON strings BEGIN
+			DELETE FROM string_tags WHERE string_id = OLD.id;
+			DELETE FROM string_metadata WHERE string_id = OLD.id;
+		END;`,
+		Down: `
+		DROP TRIGGER strings_annotations_delete;
+		DROP TABLE string_metadata;
+		DROP TABLE string_tags;`,
+	},
+	{
+		Version: 7,
+		Name:    "add_namespaces",
+		// Values become unique per namespace, so strings and its side tables
+		// are rebuilt with the namespace leading every key and index;
+		// existing rows move to the default namespace. Down keeps only the
+		// default namespace.
+		Up: `
+		CREATE TABLE namespaces (
+			name TEXT PRIMARY KEY,
+			max_strings INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL
+		);
+		INSERT INTO namespaces (name, created_at) VALUES ('default', strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));
+
+		DROP TRIGGER strings_annotations_delete;
+		DROP TRIGGER strings_characters_delete;
+		DROP TRIGGER strings_characters_update;
+		DROP TRIGGER strings_characters_insert;
+
+		CREATE TABLE strings_v7 (
+			namespace TEXT NOT NULL DEFAULT 'default',
+			id TEXT,
+			value TEXT,
+			length INTEGER,
+			is_palindrome INTEGER,
+			unique_characters INTEGER,
+			word_count INTEGER,
+			sha256_hash TEXT,
+			char_freq_map TEXT,
+			created_at TEXT,
+			analyzer_version INTEGER NOT NULL DEFAULT 0,
+			deleted_at TEXT,
+			expires_at TEXT,
+			PRIMARY KEY (namespace, id),
+			UNIQUE (namespace, value)
+		);
+		INSERT INTO strings_v7 (id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at, analyzer_version, deleted_at, expires_at)
+			SELECT id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at, analyzer_version, deleted_at, expires_at FROM strings;
+		DROP TABLE strings;
+		ALTER TABLE strings_v7 RENAME TO strings;
+		CREATE INDEX idx_strings_analyzer_version ON strings (namespace, analyzer_version, id);
+		CREATE INDEX idx_strings_length ON strings (namespace, length);
+		CREATE INDEX idx_strings_word_count ON strings (namespace, word_count);
+		CREATE INDEX idx_strings_is_palindrome ON strings (namespace, is_palindrome);
+		CREATE INDEX idx_strings_created_at ON strings (namespace, created_at);
+		CREATE INDEX idx_strings_deleted_at ON strings (namespace, deleted_at) WHERE deleted_at IS NOT NULL;
+		CREATE INDEX idx_strings_expires_at ON strings (namespace, expires_at) WHERE expires_at IS NOT NULL;
+
+		CREATE TABLE string_characters_v7 (
+			namespace TEXT NOT NULL,
+			character TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			PRIMARY KEY (namespace, character, string_id)
+		) WITHOUT ROWID;
+		INSERT INTO string_characters_v7 SELECT 'default', character, string_id FROM string_characters;
+		DROP TABLE string_characters;
+		ALTER TABLE string_characters_v7 RENAME TO string_characters;
+		CREATE INDEX idx_string_characters_string_id ON string_characters (namespace, string_id);
+
+		CREATE TABLE string_tags_v7 (
+			namespace TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			PRIMARY KEY (namespace, tag, string_id)
+		) WITHOUT ROWID;
+		INSERT INTO string_tags_v7 SELECT 'default', tag, string_id FROM string_tags;
+		DROP TABLE string_tags;
+		ALTER TABLE string_tags_v7 RENAME TO string_tags;
+		CREATE INDEX idx_string_tags_string_id ON string_tags (namespace, string_id);
+
+		CREATE TABLE string_metadata_v7 (
+			namespace TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			text TEXT NOT NULL,
+			PRIMARY KEY (namespace, string_id, key)
+		) WITHOUT ROWID;
+		INSERT INTO string_metadata_v7 SELECT 'default', string_id, key, value, text FROM string_metadata;
+		DROP TABLE string_metadata;
+		ALTER TABLE string_metadata_v7 RENAME TO string_metadata;
+		CREATE INDEX idx_string_metadata_key_text ON string_metadata (namespace, key, text);
+
+		CREATE TRIGGER strings_characters_insert AFTER INSERT ON strings BEGIN
+			INSERT INTO string_characters (namespace, character, string_id)
+				SELECT NEW.namespace, key, NEW.id FROM json_each(NEW.char_freq_map);
+		END;
+		CREATE TRIGGER strings_characters_update AFTER UPDATE OF char_freq_map ON strings BEGIN
+			DELETE FROM string_characters WHERE namespace = OLD.namespace AND string_id = OLD.id;
+			INSERT INTO string_characters (namespace, character, string_id)
+				SELECT NEW.namespace, key, NEW.id FROM json_each(NEW.char_freq_map);
+		END;
+		CREATE TRIGGER strings_characters_delete AFTER DELETE ON strings BEGIN
+			DELETE FROM string_characters WHERE namespace = OLD.namespace AND string_id = OLD.id;
+		END;
+		CREATE TRIGGER strings_annotations_delete AFTER DELETE ON strings BEGIN
+			DELETE FROM string_tags WHERE namespace = OLD.namespace AND string_id = OLD.id;
+			DELETE FROM string_metadata WHERE namespace = OLD.namespace AND string_id = OLD.id;
+		END;`,
+		Down: `
+		DROP TRIGGER strings_annotations_delete;
+		DROP TRIGGER strings_characters_delete;
+		DROP TRIGGER strings_characters_update;
+		DROP TRIGGER strings_characters_insert;
+
+		CREATE TABLE strings_v6 (
+			id TEXT PRIMARY KEY,
+			value TEXT UNIQUE,
+			length INTEGER,
+			is_palindrome INTEGER,
+			unique_characters INTEGER,
+			word_count INTEGER,
+			sha256_hash TEXT,
+			char_freq_map TEXT,
+			created_at TEXT,
+			analyzer_version INTEGER NOT NULL DEFAULT 0,
+			deleted_at TEXT,
+			expires_at TEXT
+		);
+		INSERT INTO strings_v6
+			SELECT id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at, analyzer_version, deleted_at, expires_at
+			FROM strings WHERE namespace = 'default';
+		DROP TABLE strings;
+		ALTER TABLE strings_v6 RENAME TO strings;
+		CREATE INDEX idx_strings_analyzer_version ON strings (analyzer_version, id);
+		CREATE INDEX idx_strings_length ON strings (length);
+		CREATE INDEX idx_strings_word_count ON strings (word_count);
+		CREATE INDEX idx_strings_is_palindrome ON strings (is_palindrome);
+		CREATE INDEX idx_strings_created_at ON strings (created_at);
+		CREATE INDEX idx_strings_deleted_at ON strings (deleted_at) WHERE deleted_at IS NOT NULL;
+		CREATE INDEX idx_strings_expires_at ON strings (expires_at) WHERE expires_at IS NOT NULL;
+
+		CREATE TABLE string_characters_v6 (
+			character TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			PRIMARY KEY (character, string_id)
+		) WITHOUT ROWID;
+		INSERT INTO string_characters_v6 SELECT character, string_id FROM string_characters WHERE namespace = 'default';
+		DROP TABLE string_characters;
+		ALTER TABLE string_characters_v6 RENAME TO string_characters;
+		CREATE INDEX idx_string_characters_string_id ON string_characters (string_id);
+
+		CREATE TABLE string_tags_v6 (
+			tag TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			PRIMARY KEY (tag, string_id)
+		) WITHOUT ROWID;
+		INSERT INTO string_tags_v6 SELECT tag, string_id FROM string_tags WHERE namespace = 'default';
+		DROP TABLE string_tags;
+		ALTER TABLE string_tags_v6 RENAME TO string_tags;
+		CREATE INDEX idx_string_tags_string_id ON string_tags (string_id);
+
+		CREATE TABLE string_metadata_v6 (
+			string_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			text TEXT NOT NULL,
+			PRIMARY KEY (string_id, key)
+		) WITHOUT ROWID;
+		INSERT INTO string_metadata_v6 SELECT string_id, key, value, text FROM string_metadata WHERE namespace = 'default';
+		DROP TABLE string_metadata;
+		ALTER TABLE string_metadata_v6 RENAME TO string_metadata;
+		CREATE INDEX idx_string_metadata_key_text ON string_metadata (key, text);
+
+		CREATE TRIGGER strings_characters_insert AFTER INSERT ON strings BEGIN
+			INSERT INTO string_characters (character, string_id)
+				SELECT key, NEW.id FROM json_each(NEW.char_freq_map);
+		END;
+		CREATE TRIGGER strings_characters_update AFTER UPDATE OF char_freq_map ON strings BEGIN
+			DELETE FROM string_characters WHERE string_id = OLD.id;
+			INSERT INTO string_characters (character, string_id)
+				SELECT key, NEW.id FROM json_each(NEW.char_freq_map);
+		END;
+		CREATE TRIGGER strings_characters_delete AFTER DELETE ON strings BEGIN
+			DELETE FROM string_characters WHERE string_id = OLD.id;
+		END;
+		CREATE TRIGGER strings_annotations_delete AFTER DELETE ON strings BEGIN
+			DELETE FROM string_tags WHERE string_id = OLD.id;
+			DELETE FROM string_metadata WHERE string_id = OLD.id;
+		END;
+
+		DROP TABLE namespaces;`,
+	},
+	{
+		Version: 8,
+		Name:    "add_string_events",
+		// The audit trail. Rows are only ever inserted; before and after
+		// hold the resource as JSON.
+		// AUTOINCREMENT keeps IDs from being reused, so clients can follow
+		// the feed by ID. Both indexes end in the rowid, which orders each
+		// namespace's and each value's events.
+		Up: `
+		CREATE TABLE string_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			namespace TEXT NOT NULL,
+			type TEXT NOT NULL,
+			string_id TEXT NOT NULL,
+			value TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			at TEXT NOT NULL,
+			before TEXT,
+			after TEXT
+		);
+		CREATE INDEX idx_string_events_namespace ON string_events (namespace);
+		CREATE INDEX idx_string_events_value ON string_events (namespace, value);`,
+		Down: `
+		DROP TABLE string_events;`,
+	},
+}
+
+// latestVersion is the schema version the current binary expects.
+func latestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// validateMigrations checks that versions start at 1 and increase by one,
+// so a bad merge fails loudly instead of skipping a change.
+func validateMigrations(ms []migration) error {
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return fmt.Errorf("migration %d (%s) needs both Up and Down", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+const createMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	);`
+
+// migrationState is one row of `migrate status`.
+type migrationState struct {
+	migration
+	AppliedAt string // empty when pending
+}
+
+// hasMigrationsTable reports whether db has a schema_migrations table.
+func hasMigrationsTable(ctx context.Context, db *sql.DB) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&n)
+	return n > 0, err
+}
+
+// schemaVersion returns the highest applied migration version, 0 for an
+// empty database or one without schema_migrations. It never writes.
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	if ok, err := hasMigrationsTable(ctx, db); !ok || err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// migrationStatus reports every known migration and when it was applied.
+// It never writes.
+func migrationStatus(ctx context.Context, db *sql.DB) ([]migrationState, error) {
+	applied := make(map[int]string)
+	if ok, err := hasMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	} else if ok {
+		rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var at string
+			if err := rows.Scan(&version, &at); err != nil {
+				return nil, err
+			}
+			applied[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	states := make([]migrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = migrationState{migration: m, AppliedAt: applied[m.Version]}
+	}
+	return states, nil
+}
+
+// migrateUp applies pending migrations up to and including target, each in
+// its own transaction. With dryRun it only returns what would be applied.
+func migrateUp(ctx context.Context, db *sql.DB, target int, dryRun bool) ([]migration, error) {
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if current > latestVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary (%d)", current, latestVersion())
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.Version > current && m.Version <= target {
+			pending = append(pending, m)
+		}
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, err
+	}
+	for _, m := range pending {
+		err := inTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	return pending, nil
+}
+
+// migrateDown reverts the latest steps applied migrations, newest first.
+func migrateDown(ctx context.Context, db *sql.DB, steps int, dryRun bool) ([]migration, error) {
+	if err := validateMigrations(migrations); err != nil {
+		return nil, err
+	}
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if current > latestVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary (%d)", current, latestVersion())
+	}
+
+	var reverted []migration
+	for v := current; v > 0 && len(reverted) < steps; v-- {
+		reverted = append(reverted, migrations[v-1])
+	}
+	if dryRun {
+		return reverted, nil
+	}
+	for _, m := range reverted {
+		err := inTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reverting migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("reverted migration", "version", m.Version, "name", m.Name)
+	}
+	return reverted, nil
+}
+
+// inTx runs fn in a transaction, committing only if it succeeds.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
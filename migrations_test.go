@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMigrationsAreValid(t *testing.T) {
+	if err := validateMigrations(migrations); err != nil {
+		t.Fatal(err)
+	}
+	bad := []migration{{Version: 1, Name: "a", Up: "x", Down: "y"}, {Version: 3, Name: "b", Up: "x", Down: "y"}}
+	if err := validateMigrations(bad); err == nil {
+		t.Error("Expected a gap in versions to be rejected")
+	}
+}
+
+// withTestMigration appends a throwaway migration for the duration of a test.
+func withTestMigration(t *testing.T) {
+	t.Helper()
+	saved := migrations
+	migrations = append(append([]migration(nil), saved...), migration{
+		Version: latestVersion() + 1,
+		Name:    "add_test_column",
+		Up:      `ALTER TABLE strings ADD COLUMN test_column TEXT;`,
+		Down:    `ALTER TABLE strings DROP COLUMN test_column;`,
+	})
+	t.Cleanup(func() { migrations = saved })
+}
+
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func hasColumn(t *testing.T, db *sql.DB, column string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('strings') WHERE name = ?`, column).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n == 1
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	withTestMigration(t)
+	db, _ := openTestDB(t)
+	ctx := context.Background()
+	latest := latestVersion()
+
+	// Dry run reports without applying
+	pending, err := migrateUp(ctx, db, latest, true)
+	if err != nil || len(pending) != latest {
+		t.Fatalf("Expected %d pending migrations, got %d (%v)", latest, len(pending), err)
+	}
+	if v, _ := schemaVersion(ctx, db); v != 0 {
+		t.Errorf("Expected dry run to leave version 0, got %d", v)
+	}
+
+	if _, err := migrateUp(ctx, db, latest, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := schemaVersion(ctx, db); v != latest || !hasColumn(t, db, "test_column") {
+		t.Fatalf("Expected version %d with test_column, got %d", latest, v)
+	}
+	if again, _ := migrateUp(ctx, db, latest, false); len(again) != 0 {
+		t.Errorf("Expected up to be idempotent, got %v", again)
+	}
+
+	reverted, err := migrateDown(ctx, db, 1, false)
+	if err != nil || len(reverted) != 1 || reverted[0].Name != "add_test_column" {
+		t.Fatalf("Expected to revert add_test_column, got %v (%v)", reverted, err)
+	}
+	if v, _ := schemaVersion(ctx, db); v != latest-1 || hasColumn(t, db, "test_column") {
+		t.Errorf("Expected version %d without test_column, got %d", latest-1, v)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	db, _ := openTestDB(t)
+	ctx := context.Background()
+	saved := migrations
+	migrations = append(append([]migration(nil), saved...), migration{
+		Version: latestVersion() + 1,
+		Name:    "broken",
+		Up:      `CREATE TABLE half_done (x INTEGER); SELECT * FROM no_such_table;`,
+		Down:    `DROP TABLE half_done;`,
+	})
+	defer func() { migrations = saved }()
+
+	if _, err := migrateUp(ctx, db, latestVersion(), false); err == nil {
+		t.Fatal("Expected broken migration to fail")
+	}
+	if v, _ := schemaVersion(ctx, db); v != latestVersion()-1 {
+		t.Errorf("Expected earlier migrations to stay applied at %d, got %d", latestVersion()-1, v)
+	}
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n)
+	if n != 0 {
+		t.Error("Expected the failed migration's statements to be rolled back")
+	}
+}
+
+func TestMigrateAdoptsLegacyDatabase(t *testing.T) {
+	db, path := openTestDB(t)
+	// Schema and data as written by versions without migrations
+	if _, err := db.Exec(migrations[0].Up); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO strings (id, value) VALUES ('abc', 'legacy')`); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if exists, _ := store.Exists(context.Background(), "legacy"); !exists {
+		t.Error("Expected legacy rows to survive migration")
+	}
+	if v, _ := schemaVersion(context.Background(), db); v != latestVersion() {
+		t.Errorf("Expected version %d, got %d", latestVersion(), v)
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	_, path := openTestDB(t)
+	run := func(args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		code := runMigrate(append([]string{"-db", path}, args...), &stdout, &stderr)
+		return code, stdout.String() + stderr.String()
+	}
+
+	if code, out := run("-dry-run", "up"); code != 0 || !strings.Contains(out, "(dry run) would apply 1 create_strings") {
+		t.Errorf("Unexpected dry run output (%d): %s", code, out)
+	}
+	if code, out := run("status"); code != 0 || !strings.Contains(out, "pending") {
+		t.Errorf("Expected pending status after dry run (%d): %s", code, out)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected dry run and status not to create the database, got %v", err)
+	}
+	if code, out := run("up"); code != 0 || !strings.Contains(out, "apply 1 create_strings") {
+		t.Errorf("Unexpected up output (%d): %s", code, out)
+	}
+	if code, out := run("status"); code != 0 || !strings.Contains(out, "applied") {
+		t.Errorf("Expected applied status (%d): %s", code, out)
+	}
+	if code, out := run("down", strconv.Itoa(latestVersion())); code != 0 || !strings.Contains(out, "revert 1 create_strings") {
+		t.Errorf("Unexpected down output (%d): %s", code, out)
+	}
+	for _, args := range [][]string{{}, {"sideways"}, {"down", "x"}} {
+		if code, _ := run(args...); code != 2 {
+			t.Errorf("%v: expected usage error exit code 2, got %d", args, code)
+		}
+	}
+}
+
+func TestMigrateDryRunDoesNotWrite(t *testing.T) {
+	db, path := openTestDB(t)
+	// A database from before migrations, without schema_migrations
+	if _, err := db.Exec(migrations[0].Up); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"-dry-run", "up"}, {"-dry-run", "down"}, {"status"}} {
+		if code, out := runCommand(runMigrate, append([]string{"-db", path}, args...)...); code != 0 {
+			t.Errorf("migrate %v (%d): %s", args, code, out)
+		}
+	}
+	if ok, err := hasMigrationsTable(context.Background(), db); ok || err != nil {
+		t.Errorf("Expected no schema_migrations table after read-only commands, got %v (%v)", ok, err)
+	}
+}
@@ -0,0 +1,1160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"modernc.org/sqlite" // SQLite driver in pure Go
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStore implements the handlers.StringStore interface with a SQLite backend.
+// Writes go through a single-connection pool, so they are serialized without
+// an in-process lock, while reads use a separate pool of read-only
+// connections that, in WAL mode, never wait for the writer.
+//
+// Every row belongs to a namespace; a store only sees the rows of its own
+// (see In), and the store returned by OpenSQLiteStore serves the default
+// namespace.
+type SQLiteStore struct {
+	db  *sql.DB // writer: exactly one connection
+	rdb *sql.DB // readers
+	ns  string
+}
+
+// SQLiteConfig tunes the connections opened by OpenSQLiteStore. Zero values
+// select the defaults noted on each field.
+type SQLiteConfig struct {
+	Path string
+	// JournalMode is a SQLite journal_mode; default WAL.
+	JournalMode string
+	// Synchronous is a SQLite synchronous level; default NORMAL, which is
+	// durable against crashes in WAL mode and avoids an fsync per commit.
+	Synchronous string
+	// BusyTimeout is how long a connection waits on a lock before failing
+	// with SQLITE_BUSY; default 5s.
+	BusyTimeout time.Duration
+	// MaxReaders caps the reader pool; default 4.
+	MaxReaders int
+}
+
+var (
+	journalModes = map[string]bool{"WAL": true, "DELETE": true, "TRUNCATE": true, "PERSIST": true, "MEMORY": true, "OFF": true}
+	syncModes    = map[string]bool{"OFF": true, "NORMAL": true, "FULL": true, "EXTRA": true}
+)
+
+// withDefaults fills in zero fields and validates the rest.
+func (c SQLiteConfig) withDefaults() (SQLiteConfig, error) {
+	if c.JournalMode == "" {
+		c.JournalMode = "WAL"
+	}
+	if c.Synchronous == "" {
+		c.Synchronous = "NORMAL"
+	}
+	if c.BusyTimeout == 0 {
+		c.BusyTimeout = 5 * time.Second
+	}
+	if c.MaxReaders == 0 {
+		c.MaxReaders = 4
+	}
+	c.JournalMode = strings.ToUpper(c.JournalMode)
+	c.Synchronous = strings.ToUpper(c.Synchronous)
+	switch {
+	case !journalModes[c.JournalMode]:
+		return c, fmt.Errorf("invalid journal mode %q", c.JournalMode)
+	case !syncModes[c.Synchronous]:
+		return c, fmt.Errorf("invalid synchronous mode %q", c.Synchronous)
+	case c.BusyTimeout < 0 || c.MaxReaders < 0:
+		return c, fmt.Errorf("busy timeout and max readers must not be negative")
+	}
+	return c, nil
+}
+
+// fileURI returns a SQLite URI filename for path with the query q. The path
+// is escaped, so "?" or "#" in it are not read as the start of the query.
+func fileURI(path string, q url.Values) string {
+	u := url.URL{Scheme: "file", Path: path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// dsn builds a modernc.org/sqlite data source name whose pragmas run on every
+// new connection. Writers take the write lock when a transaction begins, so a
+// read-then-write transaction cannot fail halfway with SQLITE_BUSY.
+func (c SQLiteConfig) dsn(readOnly bool) string {
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", c.BusyTimeout.Milliseconds()))
+	q.Add("_pragma", "journal_mode("+c.JournalMode+")")
+	q.Add("_pragma", "synchronous("+c.Synchronous+")")
+	if readOnly {
+		q.Add("_pragma", "query_only(1)")
+	} else {
+		q.Set("_txlock", "immediate")
+	}
+	return fileURI(c.Path, q)
+}
+
+// NewSQLiteStore opens/creates the DB file with the default SQLiteConfig
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	return OpenSQLiteStore(SQLiteConfig{Path: path})
+}
+
+// OpenSQLiteStore opens the writer and reader pools and applies pending
+// migrations.
+func OpenSQLiteStore(cfg SQLiteConfig) (*SQLiteStore, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", cfg.dsn(false))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxIdleTime(0) // keep the writer connection for the store's lifetime
+
+	// Bring the schema up to date before serving (this also creates the
+	// file and switches it to WAL before any reader opens it)
+	if _, err := migrateUp(context.Background(), db, latestVersion(), false); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	rdb, err := sql.Open("sqlite", cfg.dsn(true))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	rdb.SetMaxOpenConns(cfg.MaxReaders)
+	rdb.SetMaxIdleConns(cfg.MaxReaders)
+
+	return &SQLiteStore{db: db, rdb: rdb, ns: handlers.DefaultNamespace}, nil
+}
+
+// Close closes both connection pools.
+func (s *SQLiteStore) Close() error {
+	return errors.Join(s.rdb.Close(), s.db.Close())
+}
+
+// Create inserts a new string resource
+func (s *SQLiteStore) Create(ctx context.Context, sr *handlers.StringResource) error {
+	// Serialize CharacterFrequencyMap as JSON
+	charMapJSON, err := json.Marshal(sr.Properties.CharacterFrequencyMap)
+	if err != nil {
+		return err
+	}
+
+	return classifyError(inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, insertStringSQL, insertArgs(s.ns, sr, charMapJSON)...); err != nil {
+			return err
+		}
+		if err := writeAnnotations(ctx, tx, s.ns, sr.ID, sr.Tags, sr.Metadata); err != nil {
+			return err
+		}
+		if err := s.admit(ctx, tx); err != nil {
+			return err
+		}
+		return s.recordEvent(ctx, tx, handlers.EventCreate, nil, sr)
+	}))
+}
+
+// admit runs after an insert, in its transaction, and fails it if the
+// store's namespace does not exist or now holds more strings than its
+// quota allows. Expired rows do not count.
+func (s *SQLiteStore) admit(ctx context.Context, tx *sql.Tx) error {
+	var maxStrings int
+	err := tx.QueryRowContext(ctx, `SELECT max_strings FROM namespaces WHERE name = ?`, s.ns).Scan(&maxStrings)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: namespace %q does not exist", handlers.ErrNotFound, s.ns)
+	}
+	if err != nil || maxStrings == 0 {
+		return err
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT `+countSQL, s.ns, s.ns, nowArg(ctx)).Scan(&count); err != nil {
+		return err
+	}
+	if count > maxStrings {
+		return fmt.Errorf("%w: namespace %q holds at most %d strings", handlers.ErrQuotaExceeded, s.ns, maxStrings)
+	}
+	return nil
+}
+
+// countSQL counts the strings of a namespace, trashed but not expired ones,
+// taking the namespace twice and nowArg(ctx). Subtracting the expired rows
+// lets both counts use an index instead of reading every row.
+const countSQL = `(SELECT COUNT(*) FROM strings WHERE namespace = ?) -
+	(SELECT COUNT(*) FROM strings WHERE namespace = ? AND expires_at <= ?)`
+
+// writeAnnotations replaces the rows of string_tags and string_metadata
+// for the string with this ID.
+func writeAnnotations(ctx context.Context, tx *sql.Tx, ns, id string, tags []string, metadata map[string]any) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM string_tags WHERE namespace = ? AND string_id = ?`, ns, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM string_metadata WHERE namespace = ? AND string_id = ?`, ns, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO string_tags (namespace, tag, string_id) VALUES (?, ?, ?)`, ns, tag, id); err != nil {
+			return err
+		}
+	}
+	for key, v := range metadata {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO string_metadata (namespace, string_id, key, value, text) VALUES (?, ?, ?, ?, ?)`,
+			ns, id, key, string(value), handlers.MetaText(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateIfAbsent inserts sr unless its value is already stored, in which case
+// the stored resource is returned with created=false. The insert and the
+// lookup share one transaction, so concurrent calls cannot both create.
+func (s *SQLiteStore) CreateIfAbsent(ctx context.Context, sr *handlers.StringResource) (*handlers.StringResource, bool, error) {
+	charMapJSON, err := json.Marshal(sr.Properties.CharacterFrequencyMap)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, classifyError(err)
+	}
+	defer tx.Rollback()
+
+	// An expired row no longer counts as stored, so make way for the new one
+	if _, err := s.remove(ctx, tx, handlers.EventPurge, `value = ? AND expires_at <= ?`, sr.Value, nowArg(ctx)); err != nil {
+		return nil, false, classifyError(err)
+	}
+	res, err := tx.ExecContext(ctx, insertStringSQL+` ON CONFLICT DO NOTHING`, insertArgs(s.ns, sr, charMapJSON)...)
+	if err != nil {
+		return nil, false, classifyError(err)
+	}
+	stored, created := sr, true
+	if n, _ := res.RowsAffected(); n == 0 {
+		if stored, err = getByValue(ctx, tx, s.ns, sr.Value); err != nil {
+			return nil, false, err
+		}
+		created = false
+	} else if err := writeAnnotations(ctx, tx, s.ns, sr.ID, sr.Tags, sr.Metadata); err != nil {
+		return nil, false, classifyError(err)
+	} else if err := s.admit(ctx, tx); err != nil {
+		return nil, false, classifyError(err)
+	} else if err := s.recordEvent(ctx, tx, handlers.EventCreate, nil, sr); err != nil {
+		return nil, false, classifyError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, classifyError(err)
+	}
+	return stored, created, nil
+}
+
+const insertStringSQL = `
+	INSERT INTO strings (namespace, id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at, analyzer_version, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+func insertArgs(ns string, sr *handlers.StringResource, charMapJSON []byte) []any {
+	return []any{
+		ns, sr.ID, sr.Value, sr.Properties.Length,
+		boolToInt(sr.Properties.IsPalindrome),
+		sr.Properties.UniqueCharacters,
+		sr.Properties.WordCount,
+		sr.Properties.SHA256Hash,
+		string(charMapJSON),
+		sr.CreatedAt.Format(time.RFC3339),
+		sr.AnalyzerVersion,
+		timeArg(sr.ExpiresAt),
+	}
+}
+
+// timeArg formats an optional time for a nullable TEXT column.
+func timeArg(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// liveClause excludes expired rows; it takes nowArg(ctx) as its argument.
+// Times are RFC3339 in UTC, so string comparison orders correctly.
+const liveClause = `(expires_at IS NULL OR expires_at > ?)`
+
+// nowArg is the current time of ctx (see handlers.NowFrom) as a column
+// value.
+func nowArg(ctx context.Context) string {
+	return handlers.NowFrom(ctx).UTC().Format(time.RFC3339)
+}
+
+// selectColumns lists the columns read by scanResource, in order. Tags and
+// metadata are gathered from their side tables as JSON.
+const selectColumns = `id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map, created_at, analyzer_version, deleted_at, expires_at,
+	(SELECT json_group_array(tag) FROM string_tags WHERE namespace = strings.namespace AND string_id = strings.id),
+	(SELECT json_group_object(key, json(value)) FROM string_metadata WHERE namespace = strings.namespace AND string_id = strings.id)`
+
+// scanResource decodes one row of selectColumns from *sql.Row or *sql.Rows.
+func scanResource(row interface{ Scan(dest ...any) error }) (*handlers.StringResource, error) {
+	var sr handlers.StringResource
+	var charMapStr string
+	var isPalInt int
+	var createdAtStr string
+	var deletedAtStr, expiresAtStr sql.NullString
+	var tagsJSON, metadataJSON string
+
+	err := row.Scan(&sr.ID, &sr.Value, &sr.Properties.Length, &isPalInt,
+		&sr.Properties.UniqueCharacters, &sr.Properties.WordCount,
+		&sr.Properties.SHA256Hash, &charMapStr, &createdAtStr, &sr.AnalyzerVersion, &deletedAtStr, &expiresAtStr,
+		&tagsJSON, &metadataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty side tables give "[]" and "{}", which leave the fields nil
+	if tagsJSON != "[]" {
+		if err := json.Unmarshal([]byte(tagsJSON), &sr.Tags); err != nil {
+			return nil, err
+		}
+		slices.Sort(sr.Tags)
+	}
+	if metadataJSON != "{}" {
+		if err := json.Unmarshal([]byte(metadataJSON), &sr.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	// Decode JSON map
+	if err := json.Unmarshal([]byte(charMapStr), &sr.Properties.CharacterFrequencyMap); err != nil {
+		return nil, err
+	}
+
+	sr.Properties.IsPalindrome = intToBool(isPalInt)
+
+	// Parse time
+	sr.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return nil, err
+	}
+	if sr.DeletedAt, err = parseNullTime(deletedAtStr); err != nil {
+		return nil, err
+	}
+	if sr.ExpiresAt, err = parseNullTime(expiresAtStr); err != nil {
+		return nil, err
+	}
+
+	return &sr, nil
+}
+
+// parseNullTime parses an optional RFC3339 column.
+func parseNullTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Get retrieves a string resource by value
+func (s *SQLiteStore) Get(ctx context.Context, value string) (*handlers.StringResource, error) {
+	return getByValue(ctx, s.rdb, s.ns, value)
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getByValue(ctx context.Context, q rowQuerier, ns, value string) (*handlers.StringResource, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM strings WHERE namespace = ? AND value = ? AND `+liveClause, ns, value, nowArg(ctx))
+	sr, err := scanResource(row)
+	if err == sql.ErrNoRows {
+		return nil, handlers.ErrNotFound
+	}
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return sr, nil
+}
+
+// GetByID retrieves a string resource by full ID or unique ID prefix. The
+// range scan on the primary key index keeps prefix lookups cheap; LIMIT 2 is
+// enough to tell a unique match from an ambiguous one.
+func (s *SQLiteStore) GetByID(ctx context.Context, id string) (*handlers.StringResource, error) {
+	// '~' sorts after every hex digit, bounding the range of IDs with this prefix
+	rows, err := s.rdb.QueryContext(ctx, `SELECT value FROM strings WHERE namespace = ? AND id >= ? AND id < ? AND `+liveClause+` ORDER BY id LIMIT 2`,
+		s.ns, id, id+"~", nowArg(ctx))
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	switch len(values) {
+	case 0:
+		return nil, handlers.ErrNotFound
+	case 1:
+		return getByValue(ctx, s.rdb, s.ns, values[0])
+	default:
+		return nil, fmt.Errorf("%w: %q", handlers.ErrAmbiguous, id)
+	}
+}
+
+// DeleteByID removes the string resource with exactly this ID
+func (s *SQLiteStore) DeleteByID(ctx context.Context, id string) error {
+	return s.deleteOne(ctx, `id = ?`, id)
+}
+
+// ListStale returns the next batch of rows analyzed by an older version, in
+// ID order after afterID, and how many stale rows match filters in total.
+func (s *SQLiteStore) ListStale(ctx context.Context, filters map[string]any, version int, afterID string, limit int) ([]handlers.StringResource, int, error) {
+	whereClauses, args := filterClauses(s.ns, filters, nowArg(ctx))
+	whereClauses = append(whereClauses, "analyzer_version < ?")
+	args = append(args, version)
+	where := " WHERE " + strings.Join(whereClauses, " AND ")
+
+	var total int
+	if err := s.rdb.QueryRowContext(ctx, `SELECT COUNT(*) FROM strings`+where, args...).Scan(&total); err != nil {
+		return nil, 0, classifyError(err)
+	}
+
+	rows, err := s.rdb.QueryContext(ctx, `SELECT `+selectColumns+` FROM strings`+where+` AND id > ? ORDER BY id LIMIT ?`,
+		append(args, afterID, limit)...)
+	if err != nil {
+		return nil, 0, classifyError(err)
+	}
+	defer rows.Close()
+
+	var results []handlers.StringResource
+	for rows.Next() {
+		sr, err := scanResource(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, *sr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, classifyError(err)
+	}
+	return results, total, nil
+}
+
+// UpdateProperties rewrites the computed columns of an existing row
+func (s *SQLiteStore) UpdateProperties(ctx context.Context, sr *handlers.StringResource) error {
+	charMapJSON, err := json.Marshal(sr.Properties.CharacterFrequencyMap)
+	if err != nil {
+		return err
+	}
+	return classifyError(inTx(ctx, s.db, func(tx *sql.Tx) error {
+		found, err := s.find(ctx, tx, `id = ?`, sr.ID)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return handlers.ErrNotFound
+		}
+		if _, err := tx.ExecContext(ctx, `
+		UPDATE strings SET length = ?, is_palindrome = ?, unique_characters = ?, word_count = ?,
+			sha256_hash = ?, char_freq_map = ?, analyzer_version = ?
+		WHERE namespace = ? AND id = ?`,
+			sr.Properties.Length,
+			boolToInt(sr.Properties.IsPalindrome),
+			sr.Properties.UniqueCharacters,
+			sr.Properties.WordCount,
+			sr.Properties.SHA256Hash,
+			string(charMapJSON),
+			sr.AnalyzerVersion,
+			s.ns, sr.ID,
+		); err != nil {
+			return err
+		}
+		after := *found[0]
+		after.Properties, after.AnalyzerVersion = sr.Properties, sr.AnalyzerVersion
+		return s.recordEvent(ctx, tx, handlers.EventUpdate, found[0], &after)
+	}))
+}
+
+// Trash implements handlers.TrashStore by stamping deleted_at on a live row
+func (s *SQLiteStore) Trash(ctx context.Context, value string, at time.Time) error {
+	return classifyError(inTx(ctx, s.db, func(tx *sql.Tx) error {
+		found, err := s.find(ctx, tx, `value = ? AND deleted_at IS NULL AND `+liveClause, value, nowArg(ctx))
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return handlers.ErrNotFound
+		}
+		at = at.UTC().Truncate(time.Second)
+		if _, err := tx.ExecContext(ctx, `UPDATE strings SET deleted_at = ? WHERE namespace = ? AND id = ?`,
+			at.Format(time.RFC3339), s.ns, found[0].ID); err != nil {
+			return err
+		}
+		after := *found[0]
+		after.DeletedAt = &at
+		return s.recordEvent(ctx, tx, handlers.EventDelete, found[0], &after)
+	}))
+}
+
+// Restore implements handlers.TrashStore by clearing deleted_at
+func (s *SQLiteStore) Restore(ctx context.Context, value string) (*handlers.StringResource, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer tx.Rollback()
+
+	found, err := s.find(ctx, tx, `value = ? AND deleted_at IS NOT NULL AND `+liveClause, value, nowArg(ctx))
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if len(found) == 0 {
+		return nil, handlers.ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE strings SET deleted_at = NULL WHERE namespace = ? AND id = ?`, s.ns, found[0].ID); err != nil {
+		return nil, classifyError(err)
+	}
+	sr, err := getByValue(ctx, tx, s.ns, value)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recordEvent(ctx, tx, handlers.EventRestore, found[0], sr); err != nil {
+		return nil, classifyError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, classifyError(err)
+	}
+	return sr, nil
+}
+
+// Purge implements handlers.TrashStore. deleted_at is RFC3339 in UTC, so
+// string comparison orders correctly.
+func (s *SQLiteStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	return s.deleteBatch(ctx, `SELECT id FROM strings WHERE namespace = ? AND deleted_at < ?`, s.ns, before.UTC().Format(time.RFC3339))
+}
+
+// Annotate implements handlers.AnnotationStore by rewriting the string's
+// rows in string_tags and string_metadata. The write transaction starts
+// with BEGIN IMMEDIATE, so no other patch can change them in between.
+func (s *SQLiteStore) Annotate(ctx context.Context, value string, patch handlers.AnnotationPatch) (*handlers.StringResource, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer tx.Rollback()
+
+	before, err := getByValue(ctx, tx, s.ns, value)
+	if err == nil && before.DeletedAt != nil {
+		err = handlers.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	updated := *before
+	if err := patch.Apply(&updated); err != nil {
+		return nil, err
+	}
+	if err := writeAnnotations(ctx, tx, s.ns, before.ID, updated.Tags, updated.Metadata); err != nil {
+		return nil, classifyError(err)
+	}
+	sr, err := getByValue(ctx, tx, s.ns, value)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.recordEvent(ctx, tx, handlers.EventUpdate, before, sr); err != nil {
+		return nil, classifyError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, classifyError(err)
+	}
+	return sr, nil
+}
+
+// TagCounts implements handlers.AnnotationStore, counting live strings only.
+func (s *SQLiteStore) TagCounts(ctx context.Context) ([]handlers.TagCount, error) {
+	rows, err := s.rdb.QueryContext(ctx, `
+	SELECT t.tag, COUNT(*) FROM string_tags t JOIN strings ON strings.namespace = t.namespace AND strings.id = t.string_id
+	WHERE t.namespace = ? AND strings.deleted_at IS NULL AND `+liveClause+`
+	GROUP BY t.tag ORDER BY COUNT(*) DESC, t.tag`, s.ns, nowArg(ctx))
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+	var counts []handlers.TagCount
+	for rows.Next() {
+		var tc handlers.TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+	return counts, nil
+}
+
+// DeleteExpired implements handlers.RetentionStore using the partial
+// expires_at index.
+func (s *SQLiteStore) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	return s.deleteBatch(ctx, `SELECT id FROM strings WHERE namespace = ? AND expires_at <= ? LIMIT ?`,
+		s.ns, now.UTC().Format(time.RFC3339), limit)
+}
+
+// DeleteCreatedBefore implements handlers.RetentionStore.
+func (s *SQLiteStore) DeleteCreatedBefore(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	return s.deleteBatch(ctx, `SELECT id FROM strings WHERE namespace = ? AND created_at < ? ORDER BY created_at LIMIT ?`,
+		s.ns, cutoff.UTC().Format(time.RFC3339), limit)
+}
+
+// DeleteOldest implements handlers.RetentionStore. The count and the delete
+// share one transaction, so concurrent inserts cannot make it overshoot.
+func (s *SQLiteStore) DeleteOldest(ctx context.Context, keep, limit int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	defer tx.Rollback()
+
+	now := nowArg(ctx)
+	var live int
+	if err := tx.QueryRowContext(ctx, `SELECT `+countSQL, s.ns, s.ns, now).Scan(&live); err != nil {
+		return 0, classifyError(err)
+	}
+	if live <= keep {
+		return 0, nil
+	}
+	n, err := s.remove(ctx, tx, handlers.EventPurge, `id IN (
+		SELECT id FROM strings WHERE namespace = ? AND `+liveClause+` ORDER BY created_at, value LIMIT ?)`, s.ns, now, min(live-keep, limit))
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, classifyError(err)
+	}
+	return n, nil
+}
+
+// deleteBatch purges the rows of the store's namespace whose IDs the
+// subquery selects.
+func (s *SQLiteStore) deleteBatch(ctx context.Context, subquery string, args ...any) (int, error) {
+	var n int
+	err := inTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		n, err = s.remove(ctx, tx, handlers.EventPurge, `id IN (`+subquery+`)`, args...)
+		return err
+	})
+	if err != nil {
+		return 0, classifyError(err)
+	}
+	return n, nil
+}
+
+// find returns the rows of the store's namespace matching where, expired
+// and trashed ones included.
+func (s *SQLiteStore) find(ctx context.Context, tx *sql.Tx, where string, args ...any) ([]*handlers.StringResource, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+selectColumns+` FROM strings WHERE namespace = ? AND `+where, append([]any{s.ns}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var found []*handlers.StringResource
+	for rows.Next() {
+		sr, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, sr)
+	}
+	return found, rows.Err()
+}
+
+// remove permanently deletes the rows matching where, recording an event
+// of type typ for each, and returns how many it removed.
+func (s *SQLiteStore) remove(ctx context.Context, tx *sql.Tx, typ, where string, args ...any) (int, error) {
+	found, err := s.find(ctx, tx, where, args...)
+	if err != nil {
+		return 0, err
+	}
+	for _, sr := range found {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM strings WHERE namespace = ? AND id = ?`, s.ns, sr.ID); err != nil {
+			return 0, err
+		}
+		if err := s.recordEvent(ctx, tx, typ, sr, nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(found), nil
+}
+
+// recordEvent appends an event for a change from before to after (nil for
+// a resource that does not exist) to the audit trail, as part of tx. The
+// actor comes from ctx (see handlers.WithActor).
+func (s *SQLiteStore) recordEvent(ctx context.Context, tx *sql.Tx, typ string, before, after *handlers.StringResource) error {
+	sr := after
+	if sr == nil {
+		sr = before
+	}
+	beforeJSON, err := resourceJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := resourceJSON(after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO string_events (namespace, type, string_id, value, actor, at, before, after) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ns, typ, sr.ID, sr.Value, handlers.ActorFrom(ctx), nowArg(ctx), beforeJSON, afterJSON)
+	return err
+}
+
+// resourceJSON encodes sr for a nullable TEXT column.
+func resourceJSON(sr *handlers.StringResource) (any, error) {
+	if sr == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(sr)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Events implements handlers.EventStore. Both indexes on string_events
+// lead with the namespace and end in the rowid, so the feed and a value's
+// history are read in order without sorting.
+func (s *SQLiteStore) Events(ctx context.Context, f handlers.EventFilter, limit, offset int) ([]handlers.Event, int, error) {
+	whereClauses := []string{"namespace = ?"}
+	args := []any{s.ns}
+	for _, c := range []struct {
+		clause string
+		arg    any
+		ok     bool
+	}{
+		{"value = ?", f.Value, f.Value != ""},
+		{"type = ?", f.Type, f.Type != ""},
+		{"actor = ?", f.Actor, f.Actor != ""},
+		{"at >= ?", f.Since.UTC().Format(time.RFC3339), !f.Since.IsZero()},
+		{"at < ?", f.Until.UTC().Format(time.RFC3339), !f.Until.IsZero()},
+		{"id > ?", f.AfterID, f.AfterID > 0},
+	} {
+		if c.ok {
+			whereClauses = append(whereClauses, c.clause)
+			args = append(args, c.arg)
+		}
+	}
+	where := " WHERE " + strings.Join(whereClauses, " AND ")
+
+	var total int
+	if err := s.rdb.QueryRowContext(ctx, `SELECT COUNT(*) FROM string_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, classifyError(err)
+	}
+	rows, err := s.rdb.QueryContext(ctx, `SELECT id, type, string_id, value, actor, at, before, after FROM string_events`+where+` ORDER BY id LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, classifyError(err)
+	}
+	defer rows.Close()
+
+	var events []handlers.Event
+	for rows.Next() {
+		var e handlers.Event
+		var atStr string
+		var beforeJSON, afterJSON sql.NullString
+		if err := rows.Scan(&e.ID, &e.Type, &e.StringID, &e.Value, &e.Actor, &atStr, &beforeJSON, &afterJSON); err != nil {
+			return nil, 0, err
+		}
+		if e.At, err = time.Parse(time.RFC3339, atStr); err != nil {
+			return nil, 0, err
+		}
+		if beforeJSON.Valid {
+			if err := json.Unmarshal([]byte(beforeJSON.String), &e.Before); err != nil {
+				return nil, 0, err
+			}
+		}
+		if afterJSON.Valid {
+			if err := json.Unmarshal([]byte(afterJSON.String), &e.After); err != nil {
+				return nil, 0, err
+			}
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, classifyError(err)
+	}
+	return events, total, nil
+}
+
+// explainQueryPlan returns the detail column of EXPLAIN QUERY PLAN, one entry
+// per plan step, e.g. "SEARCH strings USING INDEX idx_strings_length (length>?)".
+func (s *SQLiteStore) explainQueryPlan(ctx context.Context, query string, args []any) ([]string, error) {
+	rows, err := s.rdb.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, err
+		}
+		plan = append(plan, detail)
+	}
+	return plan, rows.Err()
+}
+
+// Delete removes a string resource
+func (s *SQLiteStore) Delete(ctx context.Context, value string) error {
+	return s.deleteOne(ctx, `value = ?`, value)
+}
+
+// deleteOne removes the row matching where, or returns ErrNotFound.
+func (s *SQLiteStore) deleteOne(ctx context.Context, where string, args ...any) error {
+	return classifyError(inTx(ctx, s.db, func(tx *sql.Tx) error {
+		n, err := s.remove(ctx, tx, handlers.EventDelete, where, args...)
+		if err == nil && n == 0 {
+			err = handlers.ErrNotFound
+		}
+		return err
+	}))
+}
+
+// Exists checks if a string exists
+func (s *SQLiteStore) Exists(ctx context.Context, value string) (bool, error) {
+	row := s.rdb.QueryRowContext(ctx, `SELECT 1 FROM strings WHERE namespace = ? AND value = ? AND `+liveClause, s.ns, value, nowArg(ctx))
+	var dummy int
+	err := row.Scan(&dummy)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, classifyError(err)
+	}
+	return true, nil
+}
+
+// buildListQuery translates filters into the SELECT and COUNT queries used by
+// List in namespace ns, along with the bound parameters shared by both.
+func buildListQuery(ns string, filters map[string]any, now string, limit, offset int) (string, string, []any) {
+	baseQuery := `SELECT ` + selectColumns + ` FROM strings`
+	countBaseQuery := `SELECT COUNT(*) FROM strings`
+
+	whereClauses, args := filterClauses(ns, filters, now)
+
+	// Build the final queries
+	query := baseQuery
+	countQuery := countBaseQuery
+
+	if len(whereClauses) > 0 {
+		whereStr := " WHERE " + strings.Join(whereClauses, " AND ")
+		query += whereStr
+		countQuery += whereStr
+	}
+
+	// Add pagination to the main query *after* filters
+	query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+
+	return query, countQuery, args
+}
+
+// filterClauses translates filters into WHERE conditions and their args,
+// starting with the namespace that leads every index. Trashed rows are
+// excluded unless filters hold include_deleted or deleted; rows expired at
+// now (a nowArg) are always excluded.
+func filterClauses(ns string, filters map[string]any, now string) ([]string, []any) {
+	whereClauses := []string{"namespace = ?", liveClause}
+	args := []any{ns, now}
+
+	switch {
+	case filters["deleted"] == true:
+		whereClauses = append(whereClauses, "deleted_at IS NOT NULL")
+	case filters["deleted"] == false, filters["include_deleted"] != true:
+		whereClauses = append(whereClauses, "deleted_at IS NULL")
+	}
+
+	if v, ok := filters["is_palindrome"]; ok {
+		whereClauses = append(whereClauses, "is_palindrome = ?")
+		args = append(args, boolToInt(v.(bool)))
+	}
+	if v, ok := filters["min_length"]; ok {
+		whereClauses = append(whereClauses, "length >= ?")
+		args = append(args, v.(int))
+	}
+	if v, ok := filters["max_length"]; ok {
+		whereClauses = append(whereClauses, "length <= ?")
+		args = append(args, v.(int))
+	}
+	if v, ok := filters["word_count"]; ok {
+		whereClauses = append(whereClauses, "word_count = ?")
+		args = append(args, v.(int))
+	}
+	if v, ok := filters["contains_character"]; ok {
+		// string_characters indexes each string's distinct characters
+		whereClauses = append(whereClauses, "id IN (SELECT string_id FROM string_characters WHERE namespace = ? AND character = ?)")
+		args = append(args, ns, v.(string))
+	}
+	// created_at is stored as RFC3339 in UTC, so string comparison orders correctly.
+	if v, ok := filters["created_after"]; ok {
+		whereClauses = append(whereClauses, "created_at >= ?")
+		args = append(args, v.(time.Time).UTC().Format(time.RFC3339))
+	}
+	if v, ok := filters["created_before"]; ok {
+		whereClauses = append(whereClauses, "created_at < ?")
+		args = append(args, v.(time.Time).UTC().Format(time.RFC3339))
+	}
+	if v, ok := filters["tag"]; ok {
+		whereClauses = append(whereClauses, "id IN (SELECT string_id FROM string_tags WHERE namespace = ? AND tag = ?)")
+		args = append(args, ns, v.(string))
+	}
+	// Sorted so that the same filters always give the same SQL
+	var metaKeys []string
+	for key := range filters {
+		if strings.HasPrefix(key, "meta.") {
+			metaKeys = append(metaKeys, key)
+		}
+	}
+	slices.Sort(metaKeys)
+	for _, key := range metaKeys {
+		whereClauses = append(whereClauses, "id IN (SELECT string_id FROM string_metadata WHERE namespace = ? AND key = ? AND text = ?)")
+		args = append(args, ns, strings.TrimPrefix(key, "meta."), filters[key].(string))
+	}
+
+	return whereClauses, args
+}
+
+// List retrieves filtered, paginated resources
+func (s *SQLiteStore) List(ctx context.Context, filters map[string]any, limit, offset int) ([]handlers.StringResource, int, error) {
+	query, countQuery, args := buildListQuery(s.ns, filters, nowArg(ctx), limit, offset)
+
+	// Run the main query
+	rows, err := s.rdb.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, classifyError(err)
+	}
+	defer rows.Close()
+
+	var results []handlers.StringResource
+	for rows.Next() {
+		sr, err := scanResource(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, *sr)
+	}
+	// A cancelled context ends iteration early; don't return partial results
+	if err := rows.Err(); err != nil {
+		return nil, 0, classifyError(err)
+	}
+
+	// Run the count query
+	var total int
+	row := s.rdb.QueryRowContext(ctx, countQuery, args...)
+	if err := row.Scan(&total); err != nil {
+		return nil, 0, classifyError(err)
+	}
+
+	return results, total, nil
+}
+
+// ExplainList reports the SQL that List would run for the given filters, its
+// bound parameters and SQLite's query plan. Only EXPLAIN QUERY PLAN runs;
+// SQLite gives no row estimate, and counting the matches would cost as much
+// as the List itself.
+func (s *SQLiteStore) ExplainList(ctx context.Context, filters map[string]any, limit, offset int) (*handlers.QueryPlan, error) {
+	query, countQuery, args := buildListQuery(s.ns, filters, nowArg(ctx), limit, offset)
+
+	plan := &handlers.QueryPlan{SQL: query, CountSQL: countQuery, Args: args}
+
+	var err error
+	if plan.Plan, err = s.explainQueryPlan(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// In implements handlers.NamespaceStore. The view shares the connection
+// pools; closing any of them closes them all.
+func (s *SQLiteStore) In(name string) handlers.StringStore {
+	if name == s.ns {
+		return s
+	}
+	view := *s
+	view.ns = name
+	return &view
+}
+
+// CreateNamespace implements handlers.NamespaceStore.
+func (s *SQLiteStore) CreateNamespace(ctx context.Context, ns handlers.Namespace) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO namespaces (name, max_strings, created_at) VALUES (?, ?, ?)`,
+		ns.Name, ns.MaxStrings, ns.CreatedAt.UTC().Format(time.RFC3339))
+	return classifyError(err)
+}
+
+// namespaceColumns lists the columns read by scanNamespace; it takes
+// nowArg(ctx) as its argument.
+const namespaceColumns = `name, max_strings, created_at,
+	(SELECT COUNT(*) FROM strings WHERE namespace = name) -
+	(SELECT COUNT(*) FROM strings WHERE namespace = name AND expires_at <= ?)`
+
+func scanNamespace(row interface{ Scan(dest ...any) error }) (*handlers.Namespace, error) {
+	var ns handlers.Namespace
+	var createdAtStr string
+	if err := row.Scan(&ns.Name, &ns.MaxStrings, &createdAtStr, &ns.Count); err != nil {
+		return nil, err
+	}
+	var err error
+	ns.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	return &ns, err
+}
+
+// GetNamespace implements handlers.NamespaceStore.
+func (s *SQLiteStore) GetNamespace(ctx context.Context, name string) (*handlers.Namespace, error) {
+	return getNamespace(ctx, s.rdb, name)
+}
+
+func getNamespace(ctx context.Context, q rowQuerier, name string) (*handlers.Namespace, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+namespaceColumns+` FROM namespaces WHERE name = ?`, nowArg(ctx), name)
+	ns, err := scanNamespace(row)
+	if err == sql.ErrNoRows {
+		return nil, handlers.ErrNotFound
+	}
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return ns, nil
+}
+
+// ListNamespaces implements handlers.NamespaceStore.
+func (s *SQLiteStore) ListNamespaces(ctx context.Context) ([]handlers.Namespace, error) {
+	rows, err := s.rdb.QueryContext(ctx, `SELECT `+namespaceColumns+` FROM namespaces ORDER BY name`, nowArg(ctx))
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+	var list []handlers.Namespace
+	for rows.Next() {
+		ns, err := scanNamespace(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *ns)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+	return list, nil
+}
+
+// SetNamespaceQuota implements handlers.NamespaceStore.
+func (s *SQLiteStore) SetNamespaceQuota(ctx context.Context, name string, maxStrings int) (*handlers.Namespace, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE namespaces SET max_strings = ? WHERE name = ?`, maxStrings, name)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, handlers.ErrNotFound
+	}
+	ns, err := getNamespace(ctx, tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, classifyError(err)
+	}
+	return ns, nil
+}
+
+// DeleteNamespace implements handlers.NamespaceStore. The triggers on
+// strings clear the side tables row by row; the namespace's audit trail
+// goes too.
+func (s *SQLiteStore) DeleteNamespace(ctx context.Context, name string) error {
+	if name == handlers.DefaultNamespace {
+		return fmt.Errorf("%w: the default namespace cannot be deleted", handlers.ErrConflict)
+	}
+	return classifyError(inTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM namespaces WHERE name = ?`, name)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return handlers.ErrNotFound
+		}
+		// The audit trail is append-only: the namespace's events stay, and
+		// every string removed with it gets a delete event
+		view := *s
+		view.ns = name
+		_, err = view.remove(ctx, tx, handlers.EventDelete, `1 = 1`)
+		return err
+	}))
+}
+
+// --- Helper Functions ---
+
+// classifyError wraps SQLite failures in the handlers sentinel errors so the
+// API can tell a duplicate value (409) or a busy database (503) from a bug.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	// database/sql does not export its "database is closed" error
+	if errors.Is(err, sql.ErrConnDone) || err.Error() == "sql: database is closed" {
+		return fmt.Errorf("%w: %v", handlers.ErrUnavailable, err)
+	}
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return fmt.Errorf("%w: %v", handlers.ErrConflict, err)
+	}
+	// Primary result code is the low byte of the extended code
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return fmt.Errorf("%w: %v", handlers.ErrUnavailable, err)
+	}
+	return err
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func intToBool(i int) bool {
+	return i != 0
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+	"github.com/kodevoid/string_analyzer/internals/storetest"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) handlers.StringStore { return newTestStore(t) })
+}
+
+// filterCases covers every filter supported by buildListQuery.
+var filterCases = map[string]map[string]any{
+	"is_palindrome":      {"is_palindrome": true},
+	"min_length":         {"min_length": 40},
+	"max_length":         {"max_length": 3},
+	"word_count":         {"word_count": 5},
+	"contains_character": {"contains_character": "x"},
+	"created_after":      {"created_after": time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+	"created_before":     {"created_before": time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+}
+
+// TestQueryPlansUseIndexes asserts that neither the list query nor its count
+// query falls back to a full scan of strings for any single filter.
+func TestQueryPlansUseIndexes(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	for name, filters := range filterCases {
+		query, countQuery, args := buildListQuery(handlers.DefaultNamespace, filters, nowArg(context.Background()), 25, 0)
+		for _, q := range []string{query, countQuery} {
+			plan, err := store.explainQueryPlan(ctx, q, args)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			usesIndex := false
+			for _, step := range plan {
+				if strings.HasPrefix(step, "SCAN strings") {
+					t.Errorf("%s: full table scan in plan %q for %s", name, plan, q)
+				}
+				if strings.Contains(step, "USING INDEX") || strings.Contains(step, "USING COVERING INDEX") ||
+					strings.Contains(step, "USING PRIMARY KEY") {
+					usesIndex = true
+				}
+			}
+			if !usesIndex {
+				t.Errorf("%s: expected an index in plan %q", name, plan)
+			}
+		}
+	}
+}
+
+func TestContainsCharacterIndex(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	for _, v := range []string{"a.b", `say "hi"`, "zebra", "plain"} {
+		if err := store.Create(ctx, newResource(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func(ch string) int {
+		_, total, err := store.List(ctx, map[string]any{"contains_character": ch}, 25, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return total
+	}
+	// "." and `"` are JSON path syntax and used to break json_extract lookups
+	for ch, want := range map[string]int{".": 1, `"`: 1, "a": 4, "z": 1, "q": 0} {
+		if got := count(ch); got != want {
+			t.Errorf("contains_character=%q: expected %d, got %d", ch, want, got)
+		}
+	}
+
+	// Triggers keep string_characters in sync with updates and deletes
+	sr, _ := store.Get(ctx, "zebra")
+	sr.Properties.CharacterFrequencyMap = map[string]int{"q": 1}
+	if err := store.UpdateProperties(ctx, sr); err != nil {
+		t.Fatal(err)
+	}
+	if count("z") != 0 || count("q") != 1 {
+		t.Error("Expected the character index to follow UpdateProperties")
+	}
+	if err := store.Delete(ctx, "zebra"); err != nil {
+		t.Fatal(err)
+	}
+	if count("q") != 0 {
+		t.Error("Expected the character index to follow Delete")
+	}
+}
+
+// BenchmarkListFilters compares List (page plus COUNT) per filter with the
+// schema before and after the add_filter_indexes migration. Rows default to
+// 1,000,000; set BENCH_ROWS for a quicker run:
+//
+//	BENCH_ROWS=100000 go test -run '^$' -bench BenchmarkListFilters
+func BenchmarkListFilters(b *testing.B) {
+	rows := 1_000_000
+	if v, err := strconv.Atoi(os.Getenv("BENCH_ROWS")); err == nil && v > 0 {
+		rows = v
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	store := &SQLiteStore{db: db, rdb: db, ns: handlers.DefaultNamespace}
+	ctx := context.Background()
+
+	// "before" is the schema as of add_analyzer_version, plus the
+	// namespace, deleted_at and expires_at columns and the empty annotation
+	// tables that List now reads (without their indexes)
+	if _, err := migrateUp(ctx, db, 2, false); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `ALTER TABLE strings ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+		ALTER TABLE strings ADD COLUMN deleted_at TEXT;
+		ALTER TABLE strings ADD COLUMN expires_at TEXT;
+		CREATE TABLE string_tags (namespace TEXT, tag TEXT, string_id TEXT);
+		CREATE TABLE string_metadata (namespace TEXT, string_id TEXT, key TEXT, value TEXT, text TEXT)`); err != nil {
+		b.Fatal(err)
+	}
+	if err := fillBenchDB(ctx, db, rows); err != nil {
+		b.Fatal(err)
+	}
+
+	run := func(phase string, cases map[string]map[string]any) {
+		for name, filters := range cases {
+			b.Run(phase+"/"+name, func(b *testing.B) {
+				for range b.N {
+					if _, _, err := store.List(ctx, filters, 25, 0); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+
+	// The old contains_character clause, since the new one needs string_characters
+	before := maps.Clone(filterCases)
+	delete(before, "contains_character")
+	run("before", before)
+	b.Run("before/contains_character", func(b *testing.B) {
+		const where = ` FROM strings WHERE json_extract(char_freq_map, '$.' || ?) IS NOT NULL`
+		for range b.N {
+			rows, err := db.QueryContext(ctx, `SELECT `+selectColumns+where+` LIMIT 25`, "x")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for rows.Next() {
+				if _, err := scanResource(rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+			rows.Close()
+			var n int
+			if err := db.QueryRowContext(ctx, `SELECT COUNT(*)`+where, "x").Scan(&n); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	if _, err := db.ExecContext(ctx, `ALTER TABLE strings DROP COLUMN namespace;
+		ALTER TABLE strings DROP COLUMN deleted_at;
+		ALTER TABLE strings DROP COLUMN expires_at;
+		DROP TABLE string_tags;
+		DROP TABLE string_metadata`); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := migrateUp(ctx, db, latestVersion(), false); err != nil {
+		b.Fatal(err)
+	}
+	run("after", filterCases)
+}
+
+// fillBenchDB inserts n synthetic strings of 1-8 words spread over 2025,
+// with one palindrome in 50. Only the palindromes contain an "x".
+func fillBenchDB(ctx context.Context, db *sql.DB, n int) error {
+	words := []string{"alpha", "level", "zebra", "noon", "kayak", "string", "quick", "dog", "radar", "the"}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := 365 * 24 * time.Hour / time.Duration(n)
+	return inTx(ctx, db, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, insertStringSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i := range n {
+			parts := make([]string, 1+i%8)
+			for j := range parts {
+				parts[j] = words[(i/(j+1)+j)%len(words)]
+			}
+			value := strings.Join(parts, " ") + " " + strconv.Itoa(i)
+			if i%50 == 0 {
+				digits := strconv.Itoa(i)
+				value = digits + "x" + reverse(digits)
+			}
+			sr := newResource(value)
+			sr.CreatedAt = start.Add(time.Duration(i) * step)
+			charMapJSON, err := json.Marshal(sr.Properties.CharacterFrequencyMap)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx, insertArgs(handlers.DefaultNamespace, sr, charMapJSON)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+func TestSQLiteConfig(t *testing.T) {
+	// "?" must be escaped in the URI, or the name would end at "config"
+	path := filepath.Join(t.TempDir(), "config?mode=ro.db")
+	store, err := OpenSQLiteStore(SQLiteConfig{Path: path, Synchronous: "full", BusyTimeout: 2 * time.Second, MaxReaders: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	for _, db := range []*sql.DB{store.db, store.rdb} {
+		var journal string
+		var synchronous, busy int
+		_ = db.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&journal)
+		_ = db.QueryRowContext(ctx, `PRAGMA synchronous`).Scan(&synchronous)
+		_ = db.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&busy)
+		if journal != "wal" || synchronous != 2 || busy != 2000 {
+			t.Errorf("Expected wal/FULL(2)/2000ms, got %s/%d/%d", journal, synchronous, busy)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected database file at %s: %v", path, err)
+	}
+	if _, err := store.rdb.ExecContext(ctx, `DELETE FROM strings`); err == nil {
+		t.Error("Expected the reader pool to reject writes")
+	}
+
+	for _, bad := range []SQLiteConfig{{Path: path, JournalMode: "wal; DROP TABLE strings"}, {Path: path, Synchronous: "sometimes"}, {Path: path, MaxReaders: -1}} {
+		if _, err := OpenSQLiteStore(bad); err == nil {
+			t.Errorf("Expected %+v to be rejected", bad)
+		}
+	}
+}
+
+// TestSQLiteConcurrencyStress runs mixed readers and writers against two
+// stores sharing one file, as two server processes would. No operation may
+// fail with anything but ErrNotFound (a reader racing a delete); in
+// particular SQLITE_BUSY must never leak out.
+func TestSQLiteConcurrencyStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	path := filepath.Join(t.TempDir(), "stress.db")
+	var stores []*SQLiteStore
+	for range 2 {
+		store, err := NewSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		stores = append(stores, store)
+	}
+	ctx := context.Background()
+
+	const writers, readers, opsPerWriter = 8, 8, 100
+	errs := make(chan error, writers*opsPerWriter+readers)
+	check := func(op string, err error) {
+		if err != nil && !errors.Is(err, handlers.ErrNotFound) {
+			errs <- fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var writersWG, readersWG sync.WaitGroup
+	done := make(chan struct{})
+	for w := range writers {
+		writersWG.Add(1)
+		go func() {
+			defer writersWG.Done()
+			store := stores[w%len(stores)]
+			for i := range opsPerWriter {
+				value := fmt.Sprintf("w%d-%d", w, i)
+				_, _, err := store.CreateIfAbsent(ctx, newResource(value))
+				check("create", err)
+				switch i % 3 {
+				case 1:
+					check("delete", store.Delete(ctx, value))
+				case 2:
+					sr := newResource(value)
+					sr.AnalyzerVersion = handlers.AnalyzerVersion
+					check("update", store.UpdateProperties(ctx, sr))
+				}
+			}
+		}()
+	}
+	for r := range readers {
+		readersWG.Add(1)
+		go func() {
+			defer readersWG.Done()
+			store := stores[r%len(stores)]
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				_, _, err := store.List(ctx, map[string]any{"contains_character": "w"}, 25, 0)
+				check("list", err)
+				_, err = store.Get(ctx, fmt.Sprintf("w%d-0", r))
+				check("get", err)
+			}
+		}()
+	}
+	writersWG.Wait()
+	close(done)
+	readersWG.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	// Every third value was deleted again
+	_, total, err := stores[0].List(ctx, nil, 1, 0)
+	if want := writers * (opsPerWriter - (opsPerWriter+1)/3); err != nil || total != want {
+		t.Errorf("Expected %d rows, got %d (%v)", want, total, err)
+	}
+}
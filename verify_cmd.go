@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/kodevoid/string_analyzer/internals/handlers"
+)
+
+const verifyUsage = `usage: string_analyzer verify [-db path]
+
+Re-hashes every stored value and re-computes its properties. Reports rows
+whose id or sha256_hash does not match the value (corrupt) and rows whose
+stored properties differ from ComputeProperties (drift). Exits 1 if any
+are found.
+`
+
+// verifyProblem is one finding of the verify subcommand.
+type verifyProblem struct {
+	Kind      string // "corrupt" or "drift"
+	Namespace string
+	ID        string
+	Value     string
+	Detail    string
+}
+
+func (p verifyProblem) String() string {
+	return fmt.Sprintf("%-7s %s %s %s: %s", p.Kind, p.Namespace, p.ID, strconv.Quote(p.Value), p.Detail)
+}
+
+// runVerify implements the verify subcommand and returns the exit code.
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, verifyUsage) }
+	dbPath := fs.String("db", defaultDBPath, "SQLite database file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := openExisting(*dbPath, true)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	version, err := checkSchema(ctx, db)
+	if err == nil && version < latestVersion() {
+		err = fmt.Errorf("schema version %d is behind %d; run migrate up first", version, latestVersion())
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "verify: %s: %v\n", *dbPath, err)
+		return 1
+	}
+
+	checked, problems, err := verifyStrings(ctx, db)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	corrupt := 0
+	for _, p := range problems {
+		fmt.Fprintln(stdout, p)
+		if p.Kind == "corrupt" {
+			corrupt++
+		}
+	}
+	fmt.Fprintf(stdout, "checked %d strings: %d corrupt, %d drifted\n", checked, corrupt, len(problems)-corrupt)
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// verifyStrings checks every row of the strings table, in all namespaces,
+// and returns how many it read and what was wrong with them. A corrupt row
+// is not also checked for drift.
+func verifyStrings(ctx context.Context, db *sql.DB) (int, []verifyProblem, error) {
+	rows, err := db.QueryContext(ctx, `SELECT namespace, id, value, length, is_palindrome, unique_characters, word_count, sha256_hash, char_freq_map
+		FROM strings ORDER BY namespace, id`)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	checked := 0
+	var problems []verifyProblem
+	for rows.Next() {
+		var p verifyProblem
+		var stored handlers.Properties
+		var isPalInt int
+		var charMapStr string
+		if err := rows.Scan(&p.Namespace, &p.ID, &p.Value, &stored.Length, &isPalInt,
+			&stored.UniqueCharacters, &stored.WordCount, &stored.SHA256Hash, &charMapStr); err != nil {
+			return checked, problems, err
+		}
+		stored.IsPalindrome = intToBool(isPalInt)
+		checked++
+
+		sum := sha256.Sum256([]byte(p.Value))
+		hash := hex.EncodeToString(sum[:])
+		var bad []string
+		if p.ID != hash {
+			bad = append(bad, "id does not match the SHA-256 of the value")
+		}
+		if stored.SHA256Hash != hash {
+			bad = append(bad, "sha256_hash does not match the SHA-256 of the value")
+		}
+		if err := json.Unmarshal([]byte(charMapStr), &stored.CharacterFrequencyMap); err != nil {
+			bad = append(bad, "char_freq_map is not valid JSON")
+		}
+		if len(bad) > 0 {
+			p.Kind, p.Detail = "corrupt", strings.Join(bad, "; ")
+			problems = append(problems, p)
+			continue
+		}
+
+		if diff := propertyDrift(stored, handlers.ComputeProperties(p.Value)); len(diff) > 0 {
+			p.Kind, p.Detail = "drift", strings.Join(diff, ", ")+" differ from ComputeProperties"
+			problems = append(problems, p)
+		}
+	}
+	return checked, problems, rows.Err()
+}
+
+// propertyDrift names the stored properties that differ from computed.
+func propertyDrift(stored, computed handlers.Properties) []string {
+	var diff []string
+	if stored.Length != computed.Length {
+		diff = append(diff, "length")
+	}
+	if stored.IsPalindrome != computed.IsPalindrome {
+		diff = append(diff, "is_palindrome")
+	}
+	if stored.UniqueCharacters != computed.UniqueCharacters {
+		diff = append(diff, "unique_characters")
+	}
+	if stored.WordCount != computed.WordCount {
+		diff = append(diff, "word_count")
+	}
+	if !maps.Equal(stored.CharacterFrequencyMap, computed.CharacterFrequencyMap) {
+		diff = append(diff, "char_freq_map")
+	}
+	return diff
+}